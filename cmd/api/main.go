@@ -1,11 +1,23 @@
 package main
 
 import (
+	"el-music-be/internal/analysis"
+	"el-music-be/internal/charts"
 	"el-music-be/internal/database"
+	"el-music-be/internal/entitlement"
 	"el-music-be/internal/handler"
+	"el-music-be/internal/hls"
+	"el-music-be/internal/home"
 	"el-music-be/internal/middleware"
+	"el-music-be/internal/radio"
+	"el-music-be/internal/recommend"
+	"el-music-be/internal/releaseradar"
+	"el-music-be/internal/stats"
+	"el-music-be/internal/storage"
+	"el-music-be/internal/streaming"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/gorilla/mux"
 )
@@ -13,8 +25,9 @@ import (
 func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS, DELETE")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, OPTIONS, DELETE")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Range, If-None-Match")
+		w.Header().Set("Access-Control-Expose-Headers", "Accept-Ranges, Content-Range, Content-Length, ETag")
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
 			return
@@ -23,18 +36,78 @@ func corsMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// ensurePlayEventPartitions keeps monthly play_events partitions for the
+// current and next month in place for as long as the server runs.
+func ensurePlayEventPartitions(store *database.PostgresStore) {
+	for {
+		now := time.Now()
+		thisMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+		for _, month := range []time.Time{thisMonth, thisMonth.AddDate(0, 1, 0)} {
+			if err := store.EnsurePlayEventPartition(month); err != nil {
+				log.Printf("Could not create play_events partition for %s: %v", month.Format("2006-01"), err)
+			}
+		}
+		time.Sleep(24 * time.Hour)
+	}
+}
+
+// rollUpPlayCounts counts the plays of every full day but the last into
+// songs.play_count, leaving a day for late plays to arrive.
+func rollUpPlayCounts(store *database.PostgresStore) {
+	for {
+		today := time.Now().UTC().Truncate(24 * time.Hour)
+		if err := store.RollUpPlayCounts(today.AddDate(0, 0, -1)); err != nil {
+			log.Printf("Could not roll up play counts: %v", err)
+		}
+		time.Sleep(time.Hour)
+	}
+}
+
 func main() {
 	store, err := database.NewPostgresStore()
 	if err != nil {
 		log.Fatal("Could not connect to the database: ", err)
 	}
+	backend, err := storage.NewBackendFromEnv()
+	if err != nil {
+		log.Fatal("Could not initialise storage: ", err)
+	}
+
+	go ensurePlayEventPartitions(store)
+	go rollUpPlayCounts(store)
+
+	recommender := recommend.NewEngine(store)
+	go recommender.Run(6 * time.Hour)
 
-	songHandler := handler.NewSongHandler(store)
+	go releaseradar.NewGenerator(store).Run()
+	go hls.NewPackager(store, backend).Run(time.Minute)
+	go analysis.NewAnalyzer(store, backend).Run(time.Minute)
+	go charts.NewGenerator(store).Run(10 * time.Minute)
+
+	summarizer := stats.NewSummarizer(store)
+	go summarizer.Run(time.Hour)
+
+	songHandler := handler.NewSongHandler(store, recommender)
 	authHandler := handler.NewAuthHandler(store)
 	playlistHandler := handler.NewPlaylistHandler(store)
 	searchHandler := handler.NewSearchHandler(store)
 	lyricsHandler := handler.NewLyricsHandler(store)
 	paymentHandler := handler.NewPaymentHandler(store)
+	playHandler := handler.NewPlayHandler(store)
+	libraryHandler := handler.NewLibraryHandler(store)
+	artistHandler := handler.NewArtistHandler(store)
+	adminSongHandler := handler.NewAdminSongHandler(store)
+	adminImportHandler := handler.NewAdminImportHandler(store)
+	adminCategoryHandler := handler.NewAdminCategoryHandler(store)
+	homeHandler := handler.NewHomeHandler(store, home.NewFeed(store))
+	chartHandler := handler.NewChartHandler(store)
+	radioHandler := handler.NewRadioHandler(radio.NewEngine(store))
+	statsHandler := handler.NewStatsHandler(summarizer)
+	adminUploadHandler := handler.NewAdminUploadHandler(store, backend)
+	signer := streaming.NewSignerFromEnv()
+	policy := entitlement.DefaultPolicy()
+	streamHandler := handler.NewStreamHandler(store, backend, signer, policy)
+	offlineHandler := handler.NewOfflineHandler(store, signer, policy)
 
 	r := mux.NewRouter()
 	api := r.PathPrefix("/api/v1").Subrouter()
@@ -46,20 +119,93 @@ func main() {
 	authRoutes.HandleFunc("/forgot-password", authHandler.HandleForgotPassword).Methods("POST")
 	authRoutes.HandleFunc("/reset-password", authHandler.HandleResetPassword).Methods("POST")
 
+	api.HandleFunc("/wrapped/shared/{token}", statsHandler.HandleGetSharedWrapped).Methods("GET")
+	api.HandleFunc("/covers/{name}", adminUploadHandler.HandleGetCover).Methods("GET")
+	api.HandleFunc("/stream/{songId}/audio", streamHandler.HandleStreamAudio).Methods("GET", "HEAD")
+	api.HandleFunc("/stream/{songId}/hls/{quality}/index.m3u8", streamHandler.HandleGetMediaPlaylist).Methods("GET")
+	api.HandleFunc("/stream/{songId}/hls/{quality}/{segment:[0-9]+}.mp3", streamHandler.HandleGetSegment).Methods("GET", "HEAD")
+
 	protectedRoutes := api.PathPrefix("").Subrouter()
 	protectedRoutes.Use(middleware.JWTMiddleware(store))
+	protectedRoutes.HandleFunc("/home", homeHandler.HandleGetHome).Methods("GET")
 	protectedRoutes.HandleFunc("/songs/recently-played", songHandler.HandleGetRecentlyPlayed).Methods("GET")
+	protectedRoutes.HandleFunc("/plays", playHandler.HandleRecordPlay).Methods("POST")
 	protectedRoutes.HandleFunc("/songs/made-for-you", songHandler.HandleGetMadeForYou).Methods("GET")
+	protectedRoutes.HandleFunc("/songs/{id}", songHandler.HandleGetSong).Methods("GET")
+	protectedRoutes.HandleFunc("/songs/{id}/analysis", songHandler.HandleGetSongAnalysis).Methods("GET")
 	protectedRoutes.HandleFunc("/categories/search", songHandler.HandleGetSearchCategories).Methods("GET")
+	protectedRoutes.HandleFunc("/categories/{id}", songHandler.HandleGetCategory).Methods("GET")
+	protectedRoutes.HandleFunc("/me/categories", songHandler.HandleGetMyCategories).Methods("GET")
+	protectedRoutes.HandleFunc("/me/categories", songHandler.HandleSetMyCategories).Methods("PUT")
+	protectedRoutes.HandleFunc("/me/country", homeHandler.HandleSetMyCountry).Methods("PUT")
+	protectedRoutes.HandleFunc("/me/stats", statsHandler.HandleGetMyStats).Methods("GET")
+	protectedRoutes.HandleFunc("/me/wrapped/{year:[0-9]+}", statsHandler.HandleGetMyWrapped).Methods("GET")
+	protectedRoutes.HandleFunc("/me/library/songs", libraryHandler.HandleGetLikedSongs).Methods("GET")
+	protectedRoutes.HandleFunc("/me/library/songs/contains", libraryHandler.HandleLibraryContains).Methods("GET")
+	protectedRoutes.HandleFunc("/me/library/songs/{id}", libraryHandler.HandleLikeSong).Methods("PUT")
+	protectedRoutes.HandleFunc("/me/library/songs/{id}", libraryHandler.HandleUnlikeSong).Methods("DELETE")
+	protectedRoutes.HandleFunc("/me/following/artists", artistHandler.HandleGetFollowedArtists).Methods("GET")
+	protectedRoutes.HandleFunc("/me/following/artists/{id}", artistHandler.HandleFollowArtist).Methods("PUT")
+	protectedRoutes.HandleFunc("/me/following/artists/{id}", artistHandler.HandleUnfollowArtist).Methods("DELETE")
 	protectedRoutes.HandleFunc("/playlists", playlistHandler.HandleGetUserPlaylists).Methods("GET")
 	protectedRoutes.HandleFunc("/playlists", playlistHandler.HandleCreatePlaylist).Methods("POST")
+	protectedRoutes.HandleFunc("/playlists/search", searchHandler.HandleSearchPlaylists).Methods("GET")
+	protectedRoutes.HandleFunc("/playlists/shared/{token}", playlistHandler.HandleGetSharedPlaylist).Methods("GET")
 	protectedRoutes.HandleFunc("/playlists/{id}", playlistHandler.HandleGetPlaylistByID).Methods("GET")
+	protectedRoutes.HandleFunc("/playlists/{id}", playlistHandler.HandleUpdatePlaylist).Methods("PATCH")
+	protectedRoutes.HandleFunc("/playlists/{id}", playlistHandler.HandleDeletePlaylist).Methods("DELETE")
 	protectedRoutes.HandleFunc("/playlists/{id}/songs", playlistHandler.HandleAddSongToPlaylist).Methods("POST")
+	protectedRoutes.HandleFunc("/playlists/{id}/songs/batch-add", playlistHandler.HandleAddSongsToPlaylist).Methods("POST")
+	protectedRoutes.HandleFunc("/playlists/{id}/entries/batch-remove", playlistHandler.HandleRemovePlaylistEntries).Methods("POST")
+	protectedRoutes.HandleFunc("/playlists/{id}/share-token", playlistHandler.HandleRegenerateShareToken).Methods("POST")
+	protectedRoutes.HandleFunc("/playlists/{id}/reorder", playlistHandler.HandleReorderPlaylist).Methods("POST")
 	protectedRoutes.HandleFunc("/playlists/{playlistId}/songs/{songId}", playlistHandler.HandleRemoveSongFromPlaylist).Methods("DELETE")
+	protectedRoutes.HandleFunc("/playlists/{playlistId}/entries/{entryId}", playlistHandler.HandleRemovePlaylistEntry).Methods("DELETE")
+	protectedRoutes.HandleFunc("/playlists/{playlistId}/positions/{position:[0-9]+}", playlistHandler.HandleRemovePlaylistPosition).Methods("DELETE")
+	protectedRoutes.HandleFunc("/artists/{id}", artistHandler.HandleGetArtist).Methods("GET")
+	protectedRoutes.HandleFunc("/artists/{id}/top-songs", artistHandler.HandleGetArtistTopSongs).Methods("GET")
+	protectedRoutes.HandleFunc("/artists/{id}/albums", artistHandler.HandleGetArtistAlbums).Methods("GET")
+	protectedRoutes.HandleFunc("/albums/{id}", artistHandler.HandleGetAlbum).Methods("GET")
+	protectedRoutes.HandleFunc("/charts", chartHandler.HandleListCharts).Methods("GET")
+	protectedRoutes.HandleFunc("/charts/{chartId}", chartHandler.HandleGetChart).Methods("GET")
+	protectedRoutes.HandleFunc("/radio", radioHandler.HandleGetRadio).Methods("GET")
+	protectedRoutes.HandleFunc("/autoplay", radioHandler.HandleGetAutoplay).Methods("GET")
 	protectedRoutes.HandleFunc("/search", searchHandler.HandleSearchSongs).Methods("GET")
+	protectedRoutes.HandleFunc("/stream/{songId}/master.m3u8", streamHandler.HandleGetMasterPlaylist).Methods("GET")
+	protectedRoutes.HandleFunc("/stream/{songId}", streamHandler.HandleGetStreamURL).Methods("GET")
+	protectedRoutes.HandleFunc("/offline/licenses", offlineHandler.HandleGetLicenses).Methods("GET")
+	protectedRoutes.HandleFunc("/offline/licenses", offlineHandler.HandleGrantLicense).Methods("POST")
+	protectedRoutes.HandleFunc("/offline/licenses/renew", offlineHandler.HandleRenewLicenses).Methods("POST")
+	protectedRoutes.HandleFunc("/offline/licenses/{id}", offlineHandler.HandleRevokeLicense).Methods("DELETE")
 	protectedRoutes.HandleFunc("/lyrics/{songId}", lyricsHandler.HandleGetLyrics).Methods("GET")
 	protectedRoutes.HandleFunc("/payments/charge", paymentHandler.HandleCreateTransaction).Methods("POST")
 
+	adminRoutes := protectedRoutes.PathPrefix("/admin").Subrouter()
+	adminRoutes.Use(middleware.RequireAdmin)
+	adminRoutes.HandleFunc("/songs", adminSongHandler.HandleListSongs).Methods("GET")
+	adminRoutes.HandleFunc("/songs", adminSongHandler.HandleCreateSong).Methods("POST")
+	adminRoutes.HandleFunc("/songs/{id}", adminSongHandler.HandleGetSong).Methods("GET")
+	adminRoutes.HandleFunc("/songs/{id}", adminSongHandler.HandleUpdateSong).Methods("PUT")
+	adminRoutes.HandleFunc("/songs/{id}", adminSongHandler.HandleDeleteSong).Methods("DELETE")
+	adminRoutes.HandleFunc("/songs/{id}/restore", adminSongHandler.HandleRestoreSong).Methods("POST")
+	adminRoutes.HandleFunc("/songs/{id}/audit", adminSongHandler.HandleGetSongAuditLog).Methods("GET")
+	adminRoutes.HandleFunc("/songs/{id}/publish", adminUploadHandler.HandlePublishSong).Methods("POST")
+	adminRoutes.HandleFunc("/songs/{id}/renditions", adminUploadHandler.HandleUploadRendition).Methods("POST")
+	adminRoutes.HandleFunc("/uploads", adminUploadHandler.HandleUploadSong).Methods("POST")
+	adminRoutes.HandleFunc("/imports", adminImportHandler.HandleImport).Methods("POST")
+	adminRoutes.HandleFunc("/imports/{id}/report", adminImportHandler.HandleGetImportReport).Methods("GET")
+	adminRoutes.HandleFunc("/home/shelves", homeHandler.HandleListShelves).Methods("GET")
+	adminRoutes.HandleFunc("/home/shelves", homeHandler.HandleCreateShelf).Methods("POST")
+	adminRoutes.HandleFunc("/home/shelves/order", homeHandler.HandleReorderShelves).Methods("PUT")
+	adminRoutes.HandleFunc("/home/shelves/{id}", homeHandler.HandleUpdateShelf).Methods("PUT")
+	adminRoutes.HandleFunc("/home/shelves/{id}", homeHandler.HandleDeleteShelf).Methods("DELETE")
+	adminRoutes.HandleFunc("/categories/{id}/songs", adminCategoryHandler.HandleAddCategorySong).Methods("POST")
+	adminRoutes.HandleFunc("/categories/{id}/songs", adminCategoryHandler.HandleReplaceCategorySongs).Methods("PUT")
+	adminRoutes.HandleFunc("/categories/{id}/songs/{songId}", adminCategoryHandler.HandleRemoveCategorySong).Methods("DELETE")
+	adminRoutes.HandleFunc("/categories/{id}/playlists", adminCategoryHandler.HandleAddCategoryPlaylist).Methods("POST")
+	adminRoutes.HandleFunc("/categories/{id}/playlists", adminCategoryHandler.HandleReplaceCategoryPlaylists).Methods("PUT")
+	adminRoutes.HandleFunc("/categories/{id}/playlists/{playlistId}", adminCategoryHandler.HandleRemoveCategoryPlaylist).Methods("DELETE")
+
 	handler := corsMiddleware(r)
 
 	log.Println("Starting server on :8080")
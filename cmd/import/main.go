@@ -0,0 +1,81 @@
+package main
+
+import (
+	"el-music-be/internal/catalogimport"
+	"el-music-be/internal/database"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+)
+
+func main() {
+	file := flag.String("file", "", "CSV or JSON manifest to import")
+	adminEmail := flag.String("admin", "", "email of the admin the changes are recorded under")
+	dryRun := flag.Bool("dry-run", false, "validate the manifest without changing the catalog")
+	batchSize := flag.Int("batch-size", catalogimport.DefaultBatchSize, "songs written per transaction")
+	reportPath := flag.String("report", "", "write the import report as CSV to this path")
+	flag.Parse()
+	if *file == "" || *adminEmail == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	store, err := database.NewPostgresStore()
+	if err != nil {
+		log.Fatal("Could not connect to the database: ", err)
+	}
+	admin, err := store.GetUserByEmail(*adminEmail)
+	if err != nil || !admin.IsAdmin {
+		log.Fatalf("%s is not an admin", *adminEmail)
+	}
+
+	f, err := os.Open(*file)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	rows, err := catalogimport.Parse(*file, "", f)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	importer := catalogimport.NewImporter(store)
+	report, err := importer.Import(rows, catalogimport.Options{AdminID: admin.ID, DryRun: *dryRun, BatchSize: *batchSize})
+	if err != nil {
+		log.Fatal("Import failed: ", err)
+	}
+	encoded, err := json.Marshal(report)
+	if err != nil {
+		log.Fatal(err)
+	}
+	report.ID, err = store.SaveImportReport(admin.ID, *file, *dryRun, encoded)
+	if err != nil {
+		log.Printf("Could not save import report: %v", err)
+	}
+
+	if *reportPath != "" {
+		out, err := os.Create(*reportPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := report.WriteCSV(out); err != nil {
+			log.Fatal(err)
+		}
+		if err := out.Close(); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	for _, row := range report.Rows {
+		if len(row.Errors) > 0 {
+			fmt.Printf("line %d (%s): %s: %v\n", row.Line, row.ISRC, row.Status, row.Errors)
+		}
+	}
+	fmt.Printf("%d rows: %d created, %d updated, %d invalid, %d failed (dry run: %t, report %s)\n",
+		report.Total, report.Created, report.Updated, report.Invalid, report.Failed, report.DryRun, report.ID)
+	if report.Invalid > 0 || report.Failed > 0 {
+		os.Exit(1)
+	}
+}
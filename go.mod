@@ -11,4 +11,14 @@ require (
 
 require github.com/google/uuid v1.6.0
 
-require github.com/midtrans/midtrans-go v1.3.8
+require (
+	github.com/hajimehoshi/go-mp3 v0.3.4
+	github.com/mewkiz/flac v1.0.14
+	github.com/midtrans/midtrans-go v1.3.8
+)
+
+require (
+	github.com/icza/bitio v1.1.0 // indirect
+	github.com/mewkiz/pkg v0.0.0-20250417130911-3f050ff8c56d // indirect
+	github.com/mewpkg/term v0.0.0-20241026122259-37a80af23985 // indirect
+)
@@ -0,0 +1,112 @@
+// Package analysis runs the background job that decodes ingested audio and
+// measures its loudness, waveform, tempo and silence.
+package analysis
+
+import (
+	"el-music-be/internal/audio"
+	"el-music-be/internal/database"
+	"el-music-be/internal/loudness"
+	"el-music-be/internal/storage"
+	"errors"
+	"io"
+	"log"
+	"math"
+	"time"
+)
+
+const analysisBatchSize = 20
+
+type Analyzer struct {
+	Store   *database.PostgresStore
+	Storage storage.Backend
+}
+
+func NewAnalyzer(store *database.PostgresStore, backend storage.Backend) *Analyzer {
+	return &Analyzer{Store: store, Storage: backend}
+}
+
+// Run analyses pending songs every interval, forever.
+func (a *Analyzer) Run(interval time.Duration) {
+	for {
+		if err := a.AnalyzePending(); err != nil {
+			log.Printf("Audio analysis job failed: %v", err)
+		}
+		time.Sleep(interval)
+	}
+}
+
+func (a *Analyzer) AnalyzePending() error {
+	sources, err := a.Store.GetSongsPendingAnalysis(analysisBatchSize)
+	if err != nil {
+		return err
+	}
+	for _, src := range sources {
+		if err := a.AnalyzeSong(src); err != nil {
+			log.Printf("Could not analyse song %s: %v", src.SongID, err)
+		}
+	}
+	return nil
+}
+
+// AnalyzeSong measures one rendition. Files that cannot be decoded are
+// recorded as failed. Storage errors are recorded to be retried later, so a
+// missing file does not hold up the queue, and returned.
+func (a *Analyzer) AnalyzeSong(src database.AnalysisSource) error {
+	object, _, err := a.Storage.Open(src.AudioKey)
+	if err != nil {
+		if saveErr := a.Store.SaveSongAnalysisRetry(src.SongID, src.AudioKey, err.Error()); saveErr != nil {
+			return saveErr
+		}
+		return err
+	}
+	defer object.Close()
+
+	result, err := analyze(object, src.AudioFormat)
+	if err != nil {
+		log.Printf("Could not decode audio of song %s: %v", src.SongID, err)
+		return a.Store.SaveSongAnalysis(src.SongID, src.AudioKey, nil, err.Error())
+	}
+	result.SongID = src.SongID
+	return a.Store.SaveSongAnalysis(src.SongID, src.AudioKey, result, "")
+}
+
+// analyze decodes the audio once and feeds it to the loudness meter and the
+// feature extractor together.
+func analyze(r io.Reader, format string) (*database.SongAnalysis, error) {
+	decoder, err := audio.NewDecoder(r, format)
+	if err != nil {
+		return nil, err
+	}
+	meter := loudness.NewMeter(decoder.SampleRate(), decoder.Channels())
+	features := newFeatureExtractor(decoder.SampleRate(), decoder.Channels())
+	buf := make([]float64, 8192*decoder.Channels())
+	for {
+		n, err := decoder.ReadSamples(buf)
+		meter.Write(buf[:n])
+		features.Write(buf[:n])
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	features.finish()
+	if features.frameCount == 0 {
+		return nil, errors.New("no audio decoded")
+	}
+
+	result := &database.SongAnalysis{
+		DurationMs: features.durationMs(),
+		BPM:        features.tempo(),
+		TrackPeak:  math.Round(meter.Peak()*1e6) / 1e6,
+		Waveform:   features.waveform(),
+	}
+	result.LeadingSilenceMs, result.TrailingSilenceMs = features.silence()
+	if lufs := meter.IntegratedLoudness(); !math.IsInf(lufs, 0) {
+		lufs = math.Round(lufs*100) / 100
+		gain := math.Round(loudness.ReplayGain(lufs)*100) / 100
+		result.LoudnessLUFS, result.ReplayGainDB = &lufs, &gain
+	}
+	return result, nil
+}
@@ -0,0 +1,195 @@
+package analysis
+
+import (
+	"el-music-be/internal/database"
+	"math"
+)
+
+const (
+	// waveformBucketFrames is the resolution the waveform is recorded at
+	// before it is downsampled, about 6 ms at 44.1 kHz.
+	waveformBucketFrames = 256
+	// silenceThreshold is -60 dBFS.
+	silenceThreshold = 0.001
+	// onsetRate is about how many onset envelope values are taken per
+	// second.
+	onsetRate = 100
+	minBPM    = 60
+	maxBPM    = 200
+	// minTempoSeconds is the shortest audio a tempo is estimated for.
+	minTempoSeconds = 5
+)
+
+// waveformResolutions are the point counts clients can pick from: a small
+// thumbnail, a phone-width player and a full-width desktop player.
+var waveformResolutions = []int{100, 400, 1600}
+
+// featureExtractor collects the waveform, silence and onset envelope of
+// interleaved samples in a single pass.
+type featureExtractor struct {
+	sampleRate int
+	channels   int
+
+	peaks      []float64
+	bucketPeak float64
+	bucketFill int
+
+	onsets     []float64
+	hopFrames  int
+	hopEnergy  float64
+	hopFill    int
+	lastLevel  float64
+	haveLevel  bool
+	frameCount int64
+}
+
+func newFeatureExtractor(sampleRate, channels int) *featureExtractor {
+	return &featureExtractor{
+		sampleRate: sampleRate,
+		channels:   channels,
+		hopFrames:  max(1, sampleRate/onsetRate),
+	}
+}
+
+func (f *featureExtractor) Write(samples []float64) {
+	for i := 0; i+f.channels <= len(samples); i += f.channels {
+		var mono float64
+		for ch := 0; ch < f.channels; ch++ {
+			x := samples[i+ch]
+			if a := math.Abs(x); a > f.bucketPeak {
+				f.bucketPeak = a
+			}
+			mono += x
+		}
+		mono /= float64(f.channels)
+		f.frameCount++
+
+		if f.bucketFill++; f.bucketFill == waveformBucketFrames {
+			f.peaks = append(f.peaks, f.bucketPeak)
+			f.bucketPeak, f.bucketFill = 0, 0
+		}
+
+		f.hopEnergy += mono * mono
+		if f.hopFill++; f.hopFill == f.hopFrames {
+			// Onset strength is the rise in compressed energy from one hop
+			// to the next.
+			level := math.Log1p(1000 * f.hopEnergy / float64(f.hopFrames))
+			if f.haveLevel {
+				f.onsets = append(f.onsets, math.Max(0, level-f.lastLevel))
+			}
+			f.lastLevel, f.haveLevel = level, true
+			f.hopEnergy, f.hopFill = 0, 0
+		}
+	}
+}
+
+func (f *featureExtractor) finish() {
+	if f.bucketFill > 0 {
+		f.peaks = append(f.peaks, f.bucketPeak)
+		f.bucketPeak, f.bucketFill = 0, 0
+	}
+}
+
+func (f *featureExtractor) durationMs() int {
+	return int(f.frameCount * 1000 / int64(f.sampleRate))
+}
+
+func (f *featureExtractor) bucketMs(buckets int) int {
+	return int(int64(buckets) * waveformBucketFrames * 1000 / int64(f.sampleRate))
+}
+
+// silence returns how long the audio is silent at its start and at its end.
+func (f *featureExtractor) silence() (leadingMs, trailingMs int) {
+	first, last := -1, -1
+	for i, p := range f.peaks {
+		if p > silenceThreshold {
+			if first < 0 {
+				first = i
+			}
+			last = i
+		}
+	}
+	if first < 0 {
+		return f.durationMs(), 0
+	}
+	leadingMs = f.bucketMs(first)
+	trailingMs = max(0, f.durationMs()-f.bucketMs(last+1))
+	return leadingMs, trailingMs
+}
+
+// waveform downsamples the recorded peaks to every resolution, keeping the
+// loudest peak of each point so short transients stay visible.
+func (f *featureExtractor) waveform() []database.WaveformLevel {
+	levels := make([]database.WaveformLevel, 0, len(waveformResolutions))
+	for _, points := range waveformResolutions {
+		level := database.WaveformLevel{Points: points, Peaks: make([]float64, points)}
+		if len(f.peaks) > 0 {
+			for i := range level.Peaks {
+				start := i * len(f.peaks) / points
+				end := max(start+1, (i+1)*len(f.peaks)/points)
+				var peak float64
+				for _, p := range f.peaks[start:min(end, len(f.peaks))] {
+					peak = math.Max(peak, p)
+				}
+				level.Peaks[i] = math.Round(math.Min(peak, 1)*1000) / 1000
+			}
+		}
+		levels = append(levels, level)
+	}
+	return levels
+}
+
+// tempo estimates the beats per minute from the autocorrelation of the onset
+// envelope, weighted towards 120 BPM to settle octave ambiguity the way
+// listeners usually do. It returns nil when no periodicity stands out.
+func (f *featureExtractor) tempo() *float64 {
+	env := f.onsets
+	envRate := float64(f.sampleRate) / float64(f.hopFrames)
+	if float64(len(env)) < minTempoSeconds*envRate {
+		return nil
+	}
+	var mean float64
+	for _, v := range env {
+		mean += v
+	}
+	mean /= float64(len(env))
+	centered := make([]float64, len(env))
+	for i, v := range env {
+		centered[i] = v - mean
+	}
+
+	minLag := max(2, int(60*envRate/maxBPM))
+	maxLag := int(math.Ceil(60 * envRate / minBPM))
+	if maxLag+1 >= len(centered) {
+		return nil
+	}
+	scores := make([]float64, maxLag+2)
+	bestLag, bestScore := 0, 0.0
+	for lag := minLag - 1; lag <= maxLag+1; lag++ {
+		var sum float64
+		for i := lag; i < len(centered); i++ {
+			sum += centered[i] * centered[i-lag]
+		}
+		scores[lag] = sum / float64(len(centered)-lag)
+		if lag < minLag || lag > maxLag {
+			continue
+		}
+		octaves := math.Log2(float64(lag) / (60 * envRate / 120))
+		weighted := scores[lag] * math.Exp(-0.5*octaves*octaves)
+		if weighted > bestScore {
+			bestLag, bestScore = lag, weighted
+		}
+	}
+	if bestLag == 0 {
+		return nil
+	}
+	// Parabolic interpolation between neighbouring lags gives sub-hop
+	// precision.
+	lag := float64(bestLag)
+	a, b, c := scores[bestLag-1], scores[bestLag], scores[bestLag+1]
+	if denom := a - 2*b + c; denom < 0 {
+		lag += 0.5 * (a - c) / denom
+	}
+	bpm := math.Round(60*envRate/lag*10) / 10
+	return &bpm
+}
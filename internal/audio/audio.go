@@ -0,0 +1,146 @@
+// Package audio reads audio files in pure Go: container probing and tag
+// metadata for MP3 (ID3), FLAC, Ogg (Vorbis and Opus), MP4/M4A and WAV, and
+// PCM decoding of MP3, FLAC and WAV.
+package audio
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var ErrUnsupportedFormat = errors.New("unsupported audio format")
+
+const (
+	FormatMP3  = "mp3"
+	FormatFLAC = "flac"
+	FormatOgg  = "ogg"
+	FormatM4A  = "m4a"
+	FormatWAV  = "wav"
+)
+
+// maxTagSize bounds how much tag data is read into memory, which matters for
+// files with large embedded cover art.
+const maxTagSize = 32 << 20
+
+var contentTypes = map[string]string{
+	FormatMP3:  "audio/mpeg",
+	FormatFLAC: "audio/flac",
+	FormatOgg:  "audio/ogg",
+	FormatM4A:  "audio/mp4",
+	FormatWAV:  "audio/wav",
+}
+
+var isoDate = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}`)
+
+type Picture struct {
+	MIMEType string
+	Data     []byte
+}
+
+type Metadata struct {
+	Format      string
+	Title       string
+	Artist      string
+	AlbumArtist string
+	Album       string
+	Genre       string
+	TrackNumber int
+	Date        string
+	DurationMs  int
+	SampleRate  int
+	Channels    int
+	Picture     *Picture
+}
+
+// ContentType returns the MIME type of an audio format.
+func ContentType(format string) string {
+	return contentTypes[format]
+}
+
+// ReleaseDate returns the tagged date as YYYY-MM-DD when the tag holds a
+// full date, or "" when it only holds a year or nothing usable.
+func (m *Metadata) ReleaseDate() string {
+	if isoDate.MatchString(m.Date) {
+		return m.Date[:10]
+	}
+	return ""
+}
+
+// DetectFormat identifies the container from the first bytes of a file.
+func DetectFormat(header []byte) (string, error) {
+	switch {
+	case bytes.HasPrefix(header, []byte("ID3")):
+		return FormatMP3, nil
+	case bytes.HasPrefix(header, []byte("fLaC")):
+		return FormatFLAC, nil
+	case bytes.HasPrefix(header, []byte("OggS")):
+		return FormatOgg, nil
+	case len(header) >= 12 && string(header[:4]) == "RIFF" && string(header[8:12]) == "WAVE":
+		return FormatWAV, nil
+	case len(header) >= 8 && string(header[4:8]) == "ftyp":
+		return FormatM4A, nil
+	case len(header) >= 4 && isMPEGFrameSync(header):
+		if _, err := parseFrameHeader(header); err == nil {
+			return FormatMP3, nil
+		}
+	}
+	return "", ErrUnsupportedFormat
+}
+
+// ReadMetadata probes the format of r and reads its tags and duration.
+func ReadMetadata(r io.ReadSeeker, size int64) (*Metadata, error) {
+	header := make([]byte, 12)
+	n, err := io.ReadFull(r, header)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	format, err := DetectFormat(header[:n])
+	if err != nil {
+		return nil, err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	m := &Metadata{Format: format}
+	switch format {
+	case FormatMP3:
+		err = readMP3(r, size, m)
+	case FormatFLAC:
+		err = readFLAC(r, m)
+	case FormatOgg:
+		err = readOgg(r, size, m)
+	case FormatM4A:
+		err = readMP4(r, size, m)
+	case FormatWAV:
+		err = readWAV(r, m)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// parseTrackNumber reads "3" or "3/12".
+func parseTrackNumber(value string) int {
+	value, _, _ = strings.Cut(strings.TrimSpace(value), "/")
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+func readSized(r io.Reader, n int64) ([]byte, error) {
+	if n < 0 || n > maxTagSize {
+		return nil, errors.New("tag too large")
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
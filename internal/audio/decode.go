@@ -0,0 +1,127 @@
+package audio
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+
+	"github.com/hajimehoshi/go-mp3"
+	"github.com/mewkiz/flac"
+)
+
+// PCMReader yields decoded audio as interleaved samples scaled to [-1, 1].
+type PCMReader interface {
+	SampleRate() int
+	Channels() int
+	// ReadSamples fills buf with whole sample frames and returns the number
+	// of samples written, or io.EOF at the end of the stream.
+	ReadSamples(buf []float64) (int, error)
+}
+
+// NewDecoder decodes MP3, FLAC and WAV files.
+func NewDecoder(r io.Reader, format string) (PCMReader, error) {
+	switch format {
+	case FormatMP3:
+		// go-mp3 cannot tell mono files apart, so the channel mode is read
+		// from the first frame header. Wrapping the stream in a
+		// bufio.Reader also hides Seek, which keeps go-mp3 from scanning
+		// the whole file up front to compute its length.
+		br := bufio.NewReaderSize(r, 16<<10)
+		if header, _ := br.Peek(10); ID3v2Size(header) > 0 {
+			if _, err := br.Discard(int(ID3v2Size(header))); err != nil {
+				return nil, err
+			}
+		}
+		channels := 2
+		if probe, _ := br.Peek(16 << 10); len(probe) > 0 {
+			if _, h, err := FindFrame(probe); err == nil {
+				channels = h.Channels
+			}
+		}
+		d, err := mp3.NewDecoder(br)
+		if err != nil {
+			return nil, err
+		}
+		return &mp3Decoder{d: d, channels: channels}, nil
+	case FormatFLAC:
+		stream, err := flac.New(r)
+		if err != nil {
+			return nil, err
+		}
+		return &flacDecoder{stream: stream}, nil
+	case FormatWAV:
+		return newWAVDecoder(r)
+	}
+	return nil, ErrUnsupportedFormat
+}
+
+// mp3Decoder adapts go-mp3, which always outputs 16 bit stereo. Mono files
+// come out with both channels the same and are handed out as one channel, so
+// they are not measured as dual mono.
+type mp3Decoder struct {
+	d        *mp3.Decoder
+	channels int
+	raw      []byte
+}
+
+func (m *mp3Decoder) SampleRate() int { return m.d.SampleRate() }
+func (m *mp3Decoder) Channels() int   { return m.channels }
+
+func (m *mp3Decoder) ReadSamples(buf []float64) (int, error) {
+	n := len(buf) / m.channels * 4
+	if cap(m.raw) < n {
+		m.raw = make([]byte, n)
+	}
+	raw := m.raw[:n]
+	read, err := io.ReadFull(m.d, raw)
+	frames := read / 4
+	for i := 0; i < frames; i++ {
+		for ch := 0; ch < m.channels; ch++ {
+			buf[i*m.channels+ch] = float64(int16(binary.LittleEndian.Uint16(raw[4*i+2*ch:]))) / 32768
+		}
+	}
+	if frames > 0 {
+		return frames * m.channels, nil
+	}
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return 0, err
+}
+
+// flacDecoder hands out the samples of one FLAC frame at a time.
+type flacDecoder struct {
+	stream  *flac.Stream
+	pending []float64
+}
+
+func (f *flacDecoder) SampleRate() int { return int(f.stream.Info.SampleRate) }
+func (f *flacDecoder) Channels() int   { return int(f.stream.Info.NChannels) }
+
+func (f *flacDecoder) ReadSamples(buf []float64) (int, error) {
+	channels := f.Channels()
+	for len(f.pending) == 0 {
+		frame, err := f.stream.ParseNext()
+		if err != nil {
+			return 0, err
+		}
+		scale := float64(int64(1) << (frame.BitsPerSample - 1))
+		if frame.BitsPerSample == 0 {
+			scale = float64(int64(1) << (f.stream.Info.BitsPerSample - 1))
+		}
+		samples := int(frame.BlockSize)
+		for i := 0; i < samples; i++ {
+			for ch := 0; ch < channels && ch < len(frame.Subframes); ch++ {
+				f.pending = append(f.pending, float64(frame.Subframes[ch].Samples[i])/scale)
+			}
+		}
+	}
+	n := min(len(buf), len(f.pending))
+	n -= n % channels
+	if n == 0 {
+		n = min(len(f.pending), channels)
+	}
+	copy(buf, f.pending[:n])
+	f.pending = f.pending[n:]
+	return n, nil
+}
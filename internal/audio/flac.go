@@ -0,0 +1,192 @@
+package audio
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+)
+
+const (
+	flacBlockStreamInfo    = 0
+	flacBlockVorbisComment = 4
+	flacBlockPicture       = 6
+)
+
+// FLACStreamInfo is the content of the mandatory STREAMINFO block.
+type FLACStreamInfo struct {
+	MinBlockSize  int
+	MaxBlockSize  int
+	SampleRate    int
+	Channels      int
+	BitsPerSample int
+	TotalSamples  int64
+}
+
+func parseFLACStreamInfo(b []byte) (FLACStreamInfo, error) {
+	var info FLACStreamInfo
+	if len(b) < 18 {
+		return info, errors.New("short FLAC STREAMINFO block")
+	}
+	info.MinBlockSize = int(binary.BigEndian.Uint16(b[0:2]))
+	info.MaxBlockSize = int(binary.BigEndian.Uint16(b[2:4]))
+	packed := binary.BigEndian.Uint64(b[10:18])
+	info.SampleRate = int(packed >> 44)
+	info.Channels = int(packed>>41&0x7) + 1
+	info.BitsPerSample = int(packed>>36&0x1f) + 1
+	info.TotalSamples = int64(packed & 0xfffffffff)
+	return info, nil
+}
+
+// readFLACMetadataBlocks walks the metadata blocks after the "fLaC" marker,
+// calling fn for each, and leaves r at the first audio frame.
+func readFLACMetadataBlocks(r io.Reader, fn func(blockType byte, data []byte) error) error {
+	marker := make([]byte, 4)
+	if _, err := io.ReadFull(r, marker); err != nil {
+		return err
+	}
+	if string(marker) != "fLaC" {
+		return ErrUnsupportedFormat
+	}
+	header := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return err
+		}
+		last := header[0]&0x80 != 0
+		blockType := header[0] & 0x7f
+		length := int64(header[1])<<16 | int64(header[2])<<8 | int64(header[3])
+		data, err := readSized(r, length)
+		if err != nil {
+			return err
+		}
+		if err := fn(blockType, data); err != nil {
+			return err
+		}
+		if last {
+			return nil
+		}
+	}
+}
+
+func readFLAC(r io.Reader, m *Metadata) error {
+	return readFLACMetadataBlocks(r, func(blockType byte, data []byte) error {
+		switch blockType {
+		case flacBlockStreamInfo:
+			info, err := parseFLACStreamInfo(data)
+			if err != nil {
+				return err
+			}
+			m.SampleRate = info.SampleRate
+			m.Channels = info.Channels
+			if info.SampleRate > 0 {
+				m.DurationMs = int(info.TotalSamples * 1000 / int64(info.SampleRate))
+			}
+		case flacBlockVorbisComment:
+			applyVorbisComments(parseVorbisComments(data), m)
+		case flacBlockPicture:
+			if p, pictureType, ok := parseFLACPicture(data); ok && (m.Picture == nil || pictureType == 3) {
+				m.Picture = p
+			}
+		}
+		return nil
+	})
+}
+
+// parseFLACPicture reads a FLAC PICTURE block, which Ogg files also embed
+// base64 encoded in the METADATA_BLOCK_PICTURE comment.
+func parseFLACPicture(b []byte) (*Picture, uint32, bool) {
+	next := func(n int) ([]byte, bool) {
+		if n < 0 || n > len(b) {
+			return nil, false
+		}
+		v := b[:n]
+		b = b[n:]
+		return v, true
+	}
+	u32 := func() (uint32, bool) {
+		v, ok := next(4)
+		if !ok {
+			return 0, false
+		}
+		return binary.BigEndian.Uint32(v), true
+	}
+	pictureType, ok := u32()
+	if !ok {
+		return nil, 0, false
+	}
+	mimeLen, ok := u32()
+	if !ok {
+		return nil, 0, false
+	}
+	mime, ok := next(int(mimeLen))
+	if !ok {
+		return nil, 0, false
+	}
+	descLen, ok := u32()
+	if !ok {
+		return nil, 0, false
+	}
+	if _, ok := next(int(descLen) + 16); !ok {
+		return nil, 0, false
+	}
+	dataLen, ok := u32()
+	if !ok {
+		return nil, 0, false
+	}
+	data, ok := next(int(dataLen))
+	if !ok || len(data) == 0 {
+		return nil, 0, false
+	}
+	return &Picture{MIMEType: string(mime), Data: data}, pictureType, true
+}
+
+// parseVorbisComments reads a little endian vorbis comment list into a map of
+// upper case field names to their first value.
+func parseVorbisComments(b []byte) map[string]string {
+	comments := make(map[string]string)
+	if len(b) < 4 {
+		return comments
+	}
+	vendorLen := int(binary.LittleEndian.Uint32(b))
+	if 4+vendorLen+4 > len(b) {
+		return comments
+	}
+	b = b[4+vendorLen:]
+	count := int(binary.LittleEndian.Uint32(b))
+	b = b[4:]
+	for i := 0; i < count && len(b) >= 4; i++ {
+		length := int(binary.LittleEndian.Uint32(b))
+		if length < 0 || 4+length > len(b) {
+			break
+		}
+		key, value, found := strings.Cut(string(b[4:4+length]), "=")
+		b = b[4+length:]
+		key = strings.ToUpper(key)
+		if _, exists := comments[key]; found && !exists {
+			comments[key] = value
+		}
+	}
+	return comments
+}
+
+func applyVorbisComments(c map[string]string, m *Metadata) {
+	m.Title = strings.TrimSpace(c["TITLE"])
+	m.Artist = strings.TrimSpace(c["ARTIST"])
+	m.AlbumArtist = strings.TrimSpace(c["ALBUMARTIST"])
+	if m.AlbumArtist == "" {
+		m.AlbumArtist = strings.TrimSpace(c["ALBUM ARTIST"])
+	}
+	m.Album = strings.TrimSpace(c["ALBUM"])
+	m.Genre = strings.TrimSpace(c["GENRE"])
+	m.TrackNumber = parseTrackNumber(c["TRACKNUMBER"])
+	m.Date = strings.TrimSpace(c["DATE"])
+	if encoded := c["METADATA_BLOCK_PICTURE"]; encoded != "" && m.Picture == nil {
+		if raw, err := base64.StdEncoding.DecodeString(encoded); err == nil {
+			if p, _, ok := parseFLACPicture(raw); ok {
+				m.Picture = p
+			}
+		}
+	}
+}
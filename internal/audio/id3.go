@@ -0,0 +1,370 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"regexp"
+	"strings"
+	"unicode/utf16"
+)
+
+var genreReference = regexp.MustCompile(`^\((\d+)\)`)
+
+func syncsafe(b []byte) int64 {
+	return int64(b[0]&0x7f)<<21 | int64(b[1]&0x7f)<<14 | int64(b[2]&0x7f)<<7 | int64(b[3]&0x7f)
+}
+
+// ID3v2Size returns the total size of the ID3v2 tag at the start of header,
+// or 0 when there is none.
+func ID3v2Size(header []byte) int64 {
+	if len(header) < 10 || !bytes.HasPrefix(header, []byte("ID3")) {
+		return 0
+	}
+	size := 10 + syncsafe(header[6:10])
+	if header[5]&0x10 != 0 {
+		size += 10
+	}
+	return size
+}
+
+func readMP3(r io.ReadSeeker, size int64, m *Metadata) error {
+	header := make([]byte, 10)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return err
+	}
+	audioStart := ID3v2Size(header)
+	if audioStart > 0 {
+		body, err := readSized(r, syncsafe(header[6:10]))
+		if err != nil {
+			return err
+		}
+		parseID3v2(header, body, m)
+	}
+	audioEnd := size
+	if size >= 128 {
+		if _, err := r.Seek(size-128, io.SeekStart); err != nil {
+			return err
+		}
+		v1 := make([]byte, 128)
+		if _, err := io.ReadFull(r, v1); err != nil {
+			return err
+		}
+		if bytes.HasPrefix(v1, []byte("TAG")) {
+			audioEnd -= 128
+			parseID3v1(v1, m)
+		}
+	}
+	return readMPEGDuration(r, audioStart, audioEnd, m)
+}
+
+func readMPEGDuration(r io.ReadSeeker, audioStart, audioEnd int64, m *Metadata) error {
+	if _, err := r.Seek(audioStart, io.SeekStart); err != nil {
+		return err
+	}
+	buf := make([]byte, 64<<10)
+	n, err := io.ReadFull(r, buf)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	offset, h, err := FindFrame(buf[:n])
+	if err != nil {
+		return err
+	}
+	m.SampleRate = h.SampleRate
+	m.Channels = h.Channels
+	if frames, ok := vbrFrameCount(buf[offset:n], h); ok {
+		m.DurationMs = int(int64(frames) * int64(h.SamplesPerFrame) * 1000 / int64(h.SampleRate))
+		return nil
+	}
+	audioBytes := audioEnd - audioStart - int64(offset)
+	if m.DurationMs == 0 && audioBytes > 0 {
+		m.DurationMs = int(audioBytes * 8 / int64(h.BitrateKbps))
+	}
+	return nil
+}
+
+// parseID3v2 reads the frames of an ID3v2.2, v2.3 or v2.4 tag body.
+func parseID3v2(header, body []byte, m *Metadata) {
+	version := header[3]
+	flags := header[5]
+	if flags&0x80 != 0 && version < 4 {
+		body = removeUnsync(body)
+	}
+	if flags&0x40 != 0 && version >= 3 && len(body) >= 4 {
+		extSize := int64(binary.BigEndian.Uint32(body))
+		if version == 4 {
+			extSize = syncsafe(body)
+		} else {
+			extSize += 4
+		}
+		if extSize > int64(len(body)) {
+			return
+		}
+		body = body[extSize:]
+	}
+
+	idLen, headerLen := 4, 10
+	if version == 2 {
+		idLen, headerLen = 3, 6
+	}
+	var year, dayMonth string
+	for len(body) >= headerLen {
+		id := string(body[:idLen])
+		if id[0] == 0 {
+			break
+		}
+		var frameSize int64
+		var formatFlags byte
+		switch version {
+		case 2:
+			frameSize = int64(body[3])<<16 | int64(body[4])<<8 | int64(body[5])
+		case 3:
+			frameSize = int64(binary.BigEndian.Uint32(body[4:8]))
+			formatFlags = body[9]
+		default:
+			frameSize = syncsafe(body[4:8])
+			formatFlags = body[9]
+		}
+		if frameSize <= 0 || int64(headerLen)+frameSize > int64(len(body)) {
+			break
+		}
+		data := body[headerLen : int64(headerLen)+frameSize]
+		body = body[int64(headerLen)+frameSize:]
+
+		data, ok := frameData(version, formatFlags, data)
+		if !ok || len(data) == 0 {
+			continue
+		}
+		switch id {
+		case "TIT2", "TT2":
+			m.Title = decodeID3Text(data)
+		case "TPE1", "TP1":
+			m.Artist = decodeID3Text(data)
+		case "TPE2", "TP2":
+			m.AlbumArtist = decodeID3Text(data)
+		case "TALB", "TAL":
+			m.Album = decodeID3Text(data)
+		case "TCON", "TCO":
+			m.Genre = cleanGenre(decodeID3Text(data))
+		case "TRCK", "TRK":
+			m.TrackNumber = parseTrackNumber(decodeID3Text(data))
+		case "TDRC", "TDRL":
+			if m.Date == "" {
+				m.Date = decodeID3Text(data)
+			}
+		case "TYER", "TYE":
+			year = decodeID3Text(data)
+		case "TDAT", "TDA":
+			dayMonth = decodeID3Text(data)
+		case "TLEN", "TLE":
+			m.DurationMs = parseTrackNumber(decodeID3Text(data))
+		case "APIC":
+			setPicture(m, parseAPIC(data))
+		case "PIC":
+			setPicture(m, parsePIC(data))
+		}
+	}
+	if m.Date == "" && year != "" {
+		m.Date = year
+		if len(dayMonth) == 4 {
+			m.Date = year + "-" + dayMonth[2:4] + "-" + dayMonth[0:2]
+		}
+	}
+}
+
+// frameData strips the per-frame extras of v2.3 and v2.4 frames. Compressed
+// and encrypted frames are skipped.
+func frameData(version, formatFlags byte, data []byte) ([]byte, bool) {
+	switch version {
+	case 3:
+		if formatFlags&0xC0 != 0 {
+			return nil, false
+		}
+		if formatFlags&0x20 != 0 {
+			if len(data) < 1 {
+				return nil, false
+			}
+			data = data[1:]
+		}
+	case 4:
+		if formatFlags&0x0C != 0 {
+			return nil, false
+		}
+		if formatFlags&0x40 != 0 {
+			if len(data) < 1 {
+				return nil, false
+			}
+			data = data[1:]
+		}
+		if formatFlags&0x01 != 0 {
+			if len(data) < 4 {
+				return nil, false
+			}
+			data = data[4:]
+		}
+		if formatFlags&0x02 != 0 {
+			data = removeUnsync(data)
+		}
+	}
+	return data, true
+}
+
+func removeUnsync(b []byte) []byte {
+	out := make([]byte, 0, len(b))
+	for i := 0; i < len(b); i++ {
+		out = append(out, b[i])
+		if b[i] == 0xFF && i+1 < len(b) && b[i+1] == 0x00 {
+			i++
+		}
+	}
+	return out
+}
+
+func decodeID3Text(data []byte) string {
+	if len(data) == 0 {
+		return ""
+	}
+	text, _ := decodeID3String(data[0], data[1:], false)
+	return strings.TrimSpace(text)
+}
+
+// decodeID3String decodes text in one of the four ID3 encodings. With
+// terminated set it stops at the first null terminator and also returns the
+// bytes after it; otherwise it keeps the first of several null separated
+// values.
+func decodeID3String(encoding byte, b []byte, terminated bool) (string, []byte) {
+	wide := encoding == 1 || encoding == 2
+	end, next := len(b), len(b)
+	if wide {
+		for i := 0; i+1 < len(b); i += 2 {
+			if b[i] == 0 && b[i+1] == 0 {
+				end, next = i, i+2
+				break
+			}
+		}
+	} else if i := bytes.IndexByte(b, 0); i >= 0 {
+		end, next = i, i+1
+	}
+	rest := b[next:]
+	if !terminated {
+		rest = nil
+	}
+	text := b[:end]
+	switch encoding {
+	case 0:
+		runes := make([]rune, len(text))
+		for i, c := range text {
+			runes[i] = rune(c)
+		}
+		return string(runes), rest
+	case 1, 2:
+		bigEndian := encoding == 2
+		if len(text) >= 2 {
+			if text[0] == 0xFF && text[1] == 0xFE {
+				bigEndian, text = false, text[2:]
+			} else if text[0] == 0xFE && text[1] == 0xFF {
+				bigEndian, text = true, text[2:]
+			}
+		}
+		units := make([]uint16, len(text)/2)
+		for i := range units {
+			if bigEndian {
+				units[i] = binary.BigEndian.Uint16(text[2*i:])
+			} else {
+				units[i] = binary.LittleEndian.Uint16(text[2*i:])
+			}
+		}
+		return string(utf16.Decode(units)), rest
+	default:
+		return string(text), rest
+	}
+}
+
+type id3Picture struct {
+	pictureType byte
+	picture     Picture
+}
+
+func parseAPIC(data []byte) *id3Picture {
+	if len(data) < 4 {
+		return nil
+	}
+	encoding := data[0]
+	mimeEnd := bytes.IndexByte(data[1:], 0)
+	if mimeEnd < 0 || 1+mimeEnd+2 > len(data) {
+		return nil
+	}
+	mime := string(data[1 : 1+mimeEnd])
+	pictureType := data[1+mimeEnd+1]
+	_, rest := decodeID3String(encoding, data[1+mimeEnd+2:], true)
+	if len(rest) == 0 {
+		return nil
+	}
+	if !strings.Contains(mime, "/") {
+		mime = "image/" + strings.ToLower(mime)
+	}
+	return &id3Picture{pictureType: pictureType, picture: Picture{MIMEType: mime, Data: rest}}
+}
+
+func parsePIC(data []byte) *id3Picture {
+	if len(data) < 6 {
+		return nil
+	}
+	mime := "image/jpeg"
+	if strings.EqualFold(string(data[1:4]), "PNG") {
+		mime = "image/png"
+	}
+	_, rest := decodeID3String(data[0], data[5:], true)
+	if len(rest) == 0 {
+		return nil
+	}
+	return &id3Picture{pictureType: data[4], picture: Picture{MIMEType: mime, Data: rest}}
+}
+
+// setPicture keeps the front cover (picture type 3) over any other picture.
+func setPicture(m *Metadata, p *id3Picture) {
+	if p == nil {
+		return
+	}
+	if m.Picture == nil || p.pictureType == 3 {
+		pic := p.picture
+		m.Picture = &pic
+	}
+}
+
+func parseID3v1(tag []byte, m *Metadata) {
+	field := func(b []byte) string {
+		if i := bytes.IndexByte(b, 0); i >= 0 {
+			b = b[:i]
+		}
+		runes := make([]rune, len(b))
+		for i, c := range b {
+			runes[i] = rune(c)
+		}
+		return strings.TrimSpace(string(runes))
+	}
+	if m.Title == "" {
+		m.Title = field(tag[3:33])
+	}
+	if m.Artist == "" {
+		m.Artist = field(tag[33:63])
+	}
+	if m.Album == "" {
+		m.Album = field(tag[63:93])
+	}
+	if m.Date == "" {
+		m.Date = field(tag[93:97])
+	}
+	if m.TrackNumber == 0 && tag[125] == 0 && tag[126] != 0 {
+		m.TrackNumber = int(tag[126])
+	}
+}
+
+// cleanGenre turns ID3v1 style references such as "(17)Rock" into "Rock".
+func cleanGenre(genre string) string {
+	if m := genreReference.FindStringIndex(genre); m != nil && m[1] < len(genre) {
+		return strings.TrimSpace(genre[m[1]:])
+	}
+	return genre
+}
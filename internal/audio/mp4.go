@@ -0,0 +1,226 @@
+package audio
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+)
+
+var errInvalidAtom = errors.New("invalid MP4 atom")
+
+type mp4Atom struct {
+	kind string
+	data []byte
+}
+
+// parseAtoms splits a buffer into its child atoms.
+func parseAtoms(b []byte) ([]mp4Atom, error) {
+	var atoms []mp4Atom
+	for len(b) >= 8 {
+		size := int64(binary.BigEndian.Uint32(b))
+		kind := string(b[4:8])
+		headerLen := int64(8)
+		switch size {
+		case 0:
+			size = int64(len(b))
+		case 1:
+			if len(b) < 16 {
+				return nil, errInvalidAtom
+			}
+			size = int64(binary.BigEndian.Uint64(b[8:16]))
+			headerLen = 16
+		}
+		if size < headerLen || size > int64(len(b)) {
+			return nil, errInvalidAtom
+		}
+		atoms = append(atoms, mp4Atom{kind: kind, data: b[headerLen:size]})
+		b = b[size:]
+	}
+	return atoms, nil
+}
+
+func findAtom(atoms []mp4Atom, kind string) (mp4Atom, bool) {
+	for _, a := range atoms {
+		if a.kind == kind {
+			return a, true
+		}
+	}
+	return mp4Atom{}, false
+}
+
+// findMoov walks the top level atoms, which are too big to load as a whole
+// because of mdat, and returns the content of moov.
+func findMoov(r io.ReadSeeker, size int64) ([]byte, error) {
+	var offset int64
+	header := make([]byte, 16)
+	for offset+8 <= size {
+		if _, err := r.Seek(offset, io.SeekStart); err != nil {
+			return nil, err
+		}
+		if _, err := io.ReadFull(r, header[:8]); err != nil {
+			return nil, err
+		}
+		atomSize := int64(binary.BigEndian.Uint32(header))
+		kind := string(header[4:8])
+		headerLen := int64(8)
+		switch atomSize {
+		case 0:
+			atomSize = size - offset
+		case 1:
+			if _, err := io.ReadFull(r, header[8:16]); err != nil {
+				return nil, err
+			}
+			atomSize = int64(binary.BigEndian.Uint64(header[8:16]))
+			headerLen = 16
+		}
+		if atomSize < headerLen {
+			return nil, errInvalidAtom
+		}
+		if kind == "moov" {
+			return readSized(r, atomSize-headerLen)
+		}
+		offset += atomSize
+	}
+	return nil, errors.New("MP4 file has no moov atom")
+}
+
+func readMP4(r io.ReadSeeker, size int64, m *Metadata) error {
+	moov, err := findMoov(r, size)
+	if err != nil {
+		return err
+	}
+	children, err := parseAtoms(moov)
+	if err != nil {
+		return err
+	}
+	if mvhd, ok := findAtom(children, "mvhd"); ok {
+		m.DurationMs = mvhdDurationMs(mvhd.data)
+	}
+	if trak, ok := findAtom(children, "trak"); ok {
+		readMP4SampleEntry(trak.data, m)
+	}
+	udta, ok := findAtom(children, "udta")
+	if !ok {
+		return nil
+	}
+	udtaChildren, err := parseAtoms(udta.data)
+	if err != nil {
+		return nil
+	}
+	meta, ok := findAtom(udtaChildren, "meta")
+	if !ok || len(meta.data) < 4 {
+		return nil
+	}
+	// meta is a full atom: skip its version and flags.
+	metaChildren, err := parseAtoms(meta.data[4:])
+	if err != nil {
+		return nil
+	}
+	ilst, ok := findAtom(metaChildren, "ilst")
+	if !ok {
+		return nil
+	}
+	items, err := parseAtoms(ilst.data)
+	if err != nil {
+		return nil
+	}
+	for _, item := range items {
+		applyMP4Item(item, m)
+	}
+	return nil
+}
+
+func mvhdDurationMs(b []byte) int {
+	if len(b) < 4 {
+		return 0
+	}
+	var timescale, duration uint64
+	if b[0] == 1 {
+		if len(b) < 32 {
+			return 0
+		}
+		timescale = uint64(binary.BigEndian.Uint32(b[20:24]))
+		duration = binary.BigEndian.Uint64(b[24:32])
+	} else {
+		if len(b) < 20 {
+			return 0
+		}
+		timescale = uint64(binary.BigEndian.Uint32(b[12:16]))
+		duration = uint64(binary.BigEndian.Uint32(b[16:20]))
+	}
+	if timescale == 0 {
+		return 0
+	}
+	return int(duration * 1000 / timescale)
+}
+
+// readMP4SampleEntry reads channel count and sample rate from the first
+// audio sample entry (trak/mdia/minf/stbl/stsd).
+func readMP4SampleEntry(trak []byte, m *Metadata) {
+	atoms, err := parseAtoms(trak)
+	for _, path := range []string{"mdia", "minf", "stbl", "stsd"} {
+		if err != nil {
+			return
+		}
+		a, ok := findAtom(atoms, path)
+		if !ok {
+			return
+		}
+		if path == "stsd" {
+			// version, flags and entry count precede the sample entries.
+			if len(a.data) < 8 {
+				return
+			}
+			atoms, err = parseAtoms(a.data[8:])
+			break
+		}
+		atoms, err = parseAtoms(a.data)
+	}
+	if err != nil || len(atoms) == 0 || len(atoms[0].data) < 28 {
+		return
+	}
+	entry := atoms[0].data
+	m.Channels = int(binary.BigEndian.Uint16(entry[16:18]))
+	m.SampleRate = int(binary.BigEndian.Uint32(entry[24:28]) >> 16)
+}
+
+func applyMP4Item(item mp4Atom, m *Metadata) {
+	children, err := parseAtoms(item.data)
+	if err != nil {
+		return
+	}
+	data, ok := findAtom(children, "data")
+	if !ok || len(data.data) < 8 {
+		return
+	}
+	dataType := binary.BigEndian.Uint32(data.data[:4]) & 0xffffff
+	value := data.data[8:]
+	text := strings.TrimSpace(string(value))
+	switch item.kind {
+	case "\xa9nam":
+		m.Title = text
+	case "\xa9ART":
+		m.Artist = text
+	case "aART":
+		m.AlbumArtist = text
+	case "\xa9alb":
+		m.Album = text
+	case "\xa9gen":
+		m.Genre = text
+	case "\xa9day":
+		m.Date = text
+	case "trkn":
+		if len(value) >= 4 {
+			m.TrackNumber = int(binary.BigEndian.Uint16(value[2:4]))
+		}
+	case "covr":
+		mime := "image/jpeg"
+		if dataType == 14 {
+			mime = "image/png"
+		}
+		if len(value) > 0 {
+			m.Picture = &Picture{MIMEType: mime, Data: value}
+		}
+	}
+}
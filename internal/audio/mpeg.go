@@ -0,0 +1,211 @@
+package audio
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+var errInvalidFrame = errors.New("invalid MPEG audio frame header")
+
+const (
+	mpegVersion25 = 0
+	mpegVersion2  = 2
+	mpegVersion1  = 3
+)
+
+var mpegBitrates = map[[2]int][15]int{
+	{mpegVersion1, 1}: {0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448},
+	{mpegVersion1, 2}: {0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},
+	{mpegVersion1, 3}: {0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+	{mpegVersion2, 1}: {0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+	{mpegVersion2, 2}: {0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+	{mpegVersion2, 3}: {0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+}
+
+var mpegSampleRates = map[int][3]int{
+	mpegVersion1:  {44100, 48000, 32000},
+	mpegVersion2:  {22050, 24000, 16000},
+	mpegVersion25: {11025, 12000, 8000},
+}
+
+// FrameHeader describes one MPEG audio frame.
+type FrameHeader struct {
+	Version         int
+	Layer           int
+	BitrateKbps     int
+	SampleRate      int
+	Channels        int
+	Padding         bool
+	Size            int
+	SamplesPerFrame int
+}
+
+func isMPEGFrameSync(b []byte) bool {
+	return len(b) >= 2 && b[0] == 0xFF && b[1]&0xE0 == 0xE0
+}
+
+// ParseFrameHeader decodes the 4 byte header at the start of b.
+func ParseFrameHeader(b []byte) (FrameHeader, error) {
+	return parseFrameHeader(b)
+}
+
+func parseFrameHeader(b []byte) (FrameHeader, error) {
+	var h FrameHeader
+	if len(b) < 4 || !isMPEGFrameSync(b) {
+		return h, errInvalidFrame
+	}
+	h.Version = int(b[1]>>3) & 3
+	layerBits := int(b[1]>>1) & 3
+	if h.Version == 1 || layerBits == 0 {
+		return h, errInvalidFrame
+	}
+	h.Layer = 4 - layerBits
+	bitrateIndex := int(b[2] >> 4)
+	sampleRateIndex := int(b[2]>>2) & 3
+	if bitrateIndex == 0 || bitrateIndex == 15 || sampleRateIndex == 3 {
+		return h, errInvalidFrame
+	}
+	tableVersion := h.Version
+	if tableVersion == mpegVersion25 {
+		tableVersion = mpegVersion2
+	}
+	h.BitrateKbps = mpegBitrates[[2]int{tableVersion, h.Layer}][bitrateIndex]
+	h.SampleRate = mpegSampleRates[h.Version][sampleRateIndex]
+	h.Padding = b[2]&0x02 != 0
+	h.Channels = 2
+	if b[3]>>6 == 3 {
+		h.Channels = 1
+	}
+	padding := 0
+	if h.Padding {
+		padding = 1
+	}
+	switch {
+	case h.Layer == 1:
+		h.SamplesPerFrame = 384
+		h.Size = (12*h.BitrateKbps*1000/h.SampleRate + padding) * 4
+	case h.Layer == 3 && h.Version != mpegVersion1:
+		h.SamplesPerFrame = 576
+		h.Size = 72*h.BitrateKbps*1000/h.SampleRate + padding
+	default:
+		h.SamplesPerFrame = 1152
+		h.Size = 144*h.BitrateKbps*1000/h.SampleRate + padding
+	}
+	return h, nil
+}
+
+// sideInfoSize is the size of the layer III side information that follows
+// the frame header.
+func (h FrameHeader) sideInfoSize() int {
+	if h.Version == mpegVersion1 {
+		if h.Channels == 1 {
+			return 17
+		}
+		return 32
+	}
+	if h.Channels == 1 {
+		return 9
+	}
+	return 17
+}
+
+// FindFrame returns the offset of the first frame header in buf that is
+// followed by another valid frame header, which rules out false syncs in
+// tag or garbage data.
+func FindFrame(buf []byte) (int, FrameHeader, error) {
+	for i := 0; i+4 <= len(buf); i++ {
+		if buf[i] != 0xFF {
+			continue
+		}
+		h, err := parseFrameHeader(buf[i:])
+		if err != nil {
+			continue
+		}
+		next := i + h.Size
+		if next+4 <= len(buf) {
+			nh, err := parseFrameHeader(buf[next:])
+			if err != nil || nh.Version != h.Version || nh.Layer != h.Layer || nh.SampleRate != h.SampleRate {
+				continue
+			}
+		}
+		return i, h, nil
+	}
+	return 0, FrameHeader{}, errInvalidFrame
+}
+
+// vbrFrameCount reads the total frame count from a Xing/Info or VBRI header
+// inside the first frame, if there is one.
+func vbrFrameCount(frame []byte, h FrameHeader) (int, bool) {
+	xing := 4 + h.sideInfoSize()
+	if len(frame) >= xing+12 {
+		tag := frame[xing : xing+4]
+		if bytes.Equal(tag, []byte("Xing")) || bytes.Equal(tag, []byte("Info")) {
+			flags := binary.BigEndian.Uint32(frame[xing+4:])
+			if flags&1 != 0 {
+				return int(binary.BigEndian.Uint32(frame[xing+8:])), true
+			}
+		}
+	}
+	if len(frame) >= 36+18 && bytes.Equal(frame[36:40], []byte("VBRI")) {
+		return int(binary.BigEndian.Uint32(frame[36+14:])), true
+	}
+	return 0, false
+}
+
+// ReadMPEGFrames calls fn for every audio frame of an MP3 stream, skipping a
+// leading ID3v2 tag, the Xing/Info/VBRI header frame and anything that is not
+// a frame. It stops at a trailing ID3v1 or APE tag. The frame slice is only
+// valid during the call.
+func ReadMPEGFrames(r io.Reader, fn func(h FrameHeader, frame []byte) error) error {
+	br := bufio.NewReaderSize(r, 16<<10)
+	if header, _ := br.Peek(10); ID3v2Size(header) > 0 {
+		if _, err := br.Discard(int(ID3v2Size(header))); err != nil {
+			return err
+		}
+	}
+	first := true
+	skipped := 0
+	for {
+		b, _ := br.Peek(8)
+		if len(b) < 4 || bytes.HasPrefix(b, []byte("TAG")) || bytes.HasPrefix(b, []byte("APETAGEX")) {
+			return nil
+		}
+		h, err := parseFrameHeader(b)
+		if err != nil {
+			// Resynchronise on the next byte, but give up on files that are
+			// mostly garbage.
+			if skipped++; skipped > 64<<10 {
+				return errInvalidFrame
+			}
+			br.Discard(1)
+			continue
+		}
+		skipped = 0
+		frame, err := br.Peek(h.Size)
+		if err != nil {
+			// A truncated last frame cannot be decoded anyway.
+			return nil
+		}
+		if !(first && isVBRHeaderFrame(frame, h)) {
+			if err := fn(h, frame); err != nil {
+				return err
+			}
+		}
+		first = false
+		br.Discard(h.Size)
+	}
+}
+
+func isVBRHeaderFrame(frame []byte, h FrameHeader) bool {
+	xing := 4 + h.sideInfoSize()
+	if len(frame) >= xing+4 {
+		tag := frame[xing : xing+4]
+		if bytes.Equal(tag, []byte("Xing")) || bytes.Equal(tag, []byte("Info")) {
+			return true
+		}
+	}
+	return len(frame) >= 40 && bytes.Equal(frame[36:40], []byte("VBRI"))
+}
@@ -0,0 +1,152 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+var errInvalidOggPage = errors.New("invalid Ogg page")
+
+type oggPage struct {
+	headerType byte
+	granule    int64
+	serial     uint32
+	segments   []byte
+	data       []byte
+}
+
+func readOggPage(r io.Reader) (*oggPage, error) {
+	header := make([]byte, 27)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if string(header[:4]) != "OggS" {
+		return nil, errInvalidOggPage
+	}
+	p := &oggPage{
+		headerType: header[5],
+		granule:    int64(binary.LittleEndian.Uint64(header[6:14])),
+		serial:     binary.LittleEndian.Uint32(header[14:18]),
+		segments:   make([]byte, header[26]),
+	}
+	if _, err := io.ReadFull(r, p.segments); err != nil {
+		return nil, err
+	}
+	size := 0
+	for _, s := range p.segments {
+		size += int(s)
+	}
+	p.data = make([]byte, size)
+	if _, err := io.ReadFull(r, p.data); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// oggPacketReader reassembles the packets of the first logical stream in a
+// file from its pages.
+type oggPacketReader struct {
+	r       io.Reader
+	serial  uint32
+	started bool
+	pending [][]byte
+	partial []byte
+}
+
+func (pr *oggPacketReader) next() ([]byte, error) {
+	for len(pr.pending) == 0 {
+		page, err := readOggPage(pr.r)
+		if err != nil {
+			return nil, err
+		}
+		if !pr.started {
+			pr.serial, pr.started = page.serial, true
+		}
+		if page.serial != pr.serial {
+			continue
+		}
+		offset := 0
+		for _, segment := range page.segments {
+			pr.partial = append(pr.partial, page.data[offset:offset+int(segment)]...)
+			offset += int(segment)
+			if len(pr.partial) > maxTagSize {
+				return nil, errors.New("ogg packet too large")
+			}
+			if segment < 255 {
+				pr.pending = append(pr.pending, pr.partial)
+				pr.partial = nil
+			}
+		}
+	}
+	packet := pr.pending[0]
+	pr.pending = pr.pending[1:]
+	return packet, nil
+}
+
+func readOgg(r io.ReadSeeker, size int64, m *Metadata) error {
+	pr := &oggPacketReader{r: r}
+	ident, err := pr.next()
+	if err != nil {
+		return err
+	}
+	var preSkip int64
+	var commentPrefix []byte
+	switch {
+	case len(ident) >= 16 && bytes.HasPrefix(ident, []byte("\x01vorbis")):
+		m.Channels = int(ident[11])
+		m.SampleRate = int(binary.LittleEndian.Uint32(ident[12:16]))
+		commentPrefix = []byte("\x03vorbis")
+	case len(ident) >= 19 && bytes.HasPrefix(ident, []byte("OpusHead")):
+		m.Channels = int(ident[9])
+		preSkip = int64(binary.LittleEndian.Uint16(ident[10:12]))
+		// Opus granule positions always count 48 kHz samples.
+		m.SampleRate = 48000
+		commentPrefix = []byte("OpusTags")
+	default:
+		return ErrUnsupportedFormat
+	}
+	comments, err := pr.next()
+	if err != nil {
+		return err
+	}
+	if bytes.HasPrefix(comments, commentPrefix) {
+		applyVorbisComments(parseVorbisComments(comments[len(commentPrefix):]), m)
+	}
+
+	granule, err := lastOggGranule(r, size, pr.serial)
+	if err != nil {
+		return err
+	}
+	if granule > preSkip && m.SampleRate > 0 {
+		m.DurationMs = int((granule - preSkip) * 1000 / int64(m.SampleRate))
+	}
+	return nil
+}
+
+// lastOggGranule finds the granule position of the last page of a stream,
+// which is its length in samples.
+func lastOggGranule(r io.ReadSeeker, size int64, serial uint32) (int64, error) {
+	tail := min(size, 64<<10)
+	if _, err := r.Seek(size-tail, io.SeekStart); err != nil {
+		return 0, err
+	}
+	buf := make([]byte, tail)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return 0, err
+	}
+	for i := bytes.LastIndex(buf, []byte("OggS")); i >= 0; i = bytes.LastIndex(buf[:i], []byte("OggS")) {
+		if i+27 > len(buf) {
+			continue
+		}
+		if binary.LittleEndian.Uint32(buf[i+14:i+18]) != serial {
+			continue
+		}
+		granule := int64(binary.LittleEndian.Uint64(buf[i+6 : i+14]))
+		if granule >= 0 {
+			return granule, nil
+		}
+	}
+	return 0, nil
+}
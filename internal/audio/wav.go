@@ -0,0 +1,181 @@
+package audio
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+)
+
+const (
+	wavFormatPCM        = 1
+	wavFormatFloat      = 3
+	wavFormatExtensible = 0xFFFE
+)
+
+type wavFormat struct {
+	formatTag     uint16
+	channels      int
+	sampleRate    int
+	bitsPerSample int
+}
+
+// readWAVHeader walks the RIFF chunks up to the data chunk, reading the fmt
+// chunk and any LIST/INFO tags on the way, and returns the data size.
+func readWAVHeader(r io.Reader, m *Metadata) (wavFormat, int64, error) {
+	var f wavFormat
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return f, 0, err
+	}
+	if string(header[:4]) != "RIFF" || string(header[8:12]) != "WAVE" {
+		return f, 0, ErrUnsupportedFormat
+	}
+	chunk := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, chunk); err != nil {
+			return f, 0, err
+		}
+		id := string(chunk[:4])
+		size := int64(binary.LittleEndian.Uint32(chunk[4:]))
+		if id == "data" {
+			if f.channels == 0 {
+				return f, 0, errors.New("WAV data chunk before fmt chunk")
+			}
+			return f, size, nil
+		}
+		data, err := readSized(r, size+size%2)
+		if err != nil {
+			return f, 0, err
+		}
+		switch id {
+		case "fmt ":
+			if len(data) < 16 {
+				return f, 0, errors.New("short WAV fmt chunk")
+			}
+			f.formatTag = binary.LittleEndian.Uint16(data[0:2])
+			f.channels = int(binary.LittleEndian.Uint16(data[2:4]))
+			f.sampleRate = int(binary.LittleEndian.Uint32(data[4:8]))
+			f.bitsPerSample = int(binary.LittleEndian.Uint16(data[14:16]))
+			if f.formatTag == wavFormatExtensible && len(data) >= 26 {
+				f.formatTag = binary.LittleEndian.Uint16(data[24:26])
+			}
+			if f.channels == 0 || f.sampleRate == 0 {
+				return f, 0, errors.New("invalid WAV fmt chunk")
+			}
+		case "LIST":
+			if m != nil && len(data) >= 4 && string(data[:4]) == "INFO" {
+				parseWAVInfo(data[4:], m)
+			}
+		}
+	}
+}
+
+func parseWAVInfo(b []byte, m *Metadata) {
+	for len(b) >= 8 {
+		id := string(b[:4])
+		size := int(binary.LittleEndian.Uint32(b[4:8]))
+		if 8+size > len(b) {
+			return
+		}
+		value := decodeLatin1(b[8 : 8+size])
+		switch id {
+		case "INAM":
+			m.Title = value
+		case "IART":
+			m.Artist = value
+		case "IPRD":
+			m.Album = value
+		case "IGNR":
+			m.Genre = value
+		case "ICRD":
+			m.Date = value
+		case "ITRK", "IPRT":
+			m.TrackNumber = parseTrackNumber(value)
+		}
+		b = b[8+size+size%2:]
+	}
+}
+
+func decodeLatin1(b []byte) string {
+	runes := make([]rune, 0, len(b))
+	for _, c := range b {
+		if c == 0 {
+			break
+		}
+		runes = append(runes, rune(c))
+	}
+	return string(runes)
+}
+
+func readWAV(r io.Reader, m *Metadata) error {
+	f, dataSize, err := readWAVHeader(r, m)
+	if err != nil {
+		return err
+	}
+	m.SampleRate = f.sampleRate
+	m.Channels = f.channels
+	if frameSize := int64(f.channels * f.bitsPerSample / 8); frameSize > 0 {
+		m.DurationMs = int(dataSize / frameSize * 1000 / int64(f.sampleRate))
+	}
+	return nil
+}
+
+type wavDecoder struct {
+	r      io.Reader
+	format wavFormat
+	raw    []byte
+}
+
+func newWAVDecoder(r io.Reader) (*wavDecoder, error) {
+	f, dataSize, err := readWAVHeader(r, nil)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case f.formatTag == wavFormatPCM && (f.bitsPerSample == 8 || f.bitsPerSample == 16 || f.bitsPerSample == 24 || f.bitsPerSample == 32):
+	case f.formatTag == wavFormatFloat && (f.bitsPerSample == 32 || f.bitsPerSample == 64):
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+	return &wavDecoder{r: io.LimitReader(r, dataSize), format: f}, nil
+}
+
+func (w *wavDecoder) SampleRate() int { return w.format.sampleRate }
+func (w *wavDecoder) Channels() int   { return w.format.channels }
+
+func (w *wavDecoder) ReadSamples(buf []float64) (int, error) {
+	width := w.format.bitsPerSample / 8
+	n := len(buf) - len(buf)%w.format.channels
+	if cap(w.raw) < n*width {
+		w.raw = make([]byte, n*width)
+	}
+	raw := w.raw[:n*width]
+	read, err := io.ReadFull(w.r, raw)
+	samples := read / width
+	samples -= samples % w.format.channels
+	for i := 0; i < samples; i++ {
+		b := raw[i*width:]
+		switch {
+		case w.format.formatTag == wavFormatFloat && width == 4:
+			buf[i] = float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))
+		case w.format.formatTag == wavFormatFloat:
+			buf[i] = math.Float64frombits(binary.LittleEndian.Uint64(b))
+		case width == 1:
+			buf[i] = (float64(b[0]) - 128) / 128
+		case width == 2:
+			buf[i] = float64(int16(binary.LittleEndian.Uint16(b))) / (1 << 15)
+		case width == 3:
+			buf[i] = float64(int32(uint32(b[0])<<8|uint32(b[1])<<16|uint32(b[2])<<24)>>8) / (1 << 23)
+		default:
+			buf[i] = float64(int32(binary.LittleEndian.Uint32(b))) / (1 << 31)
+		}
+	}
+	if samples > 0 {
+		return samples, nil
+	}
+	if err == nil || err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return 0, err
+}
@@ -0,0 +1,224 @@
+package catalogimport
+
+import (
+	"el-music-be/internal/database"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const DefaultBatchSize = 100
+
+const (
+	StatusCreated    = "created"
+	StatusUpdated    = "updated"
+	StatusInvalid    = "invalid"
+	StatusFailed     = "failed"
+	StatusRolledBack = "rolled_back"
+)
+
+type Options struct {
+	AdminID   string
+	DryRun    bool
+	BatchSize int
+}
+
+type RowResult struct {
+	Line   int      `json:"line"`
+	ISRC   string   `json:"isrc"`
+	Title  string   `json:"title"`
+	Status string   `json:"status"`
+	Errors []string `json:"errors,omitempty"`
+}
+
+type Report struct {
+	ID      string      `json:"id,omitempty"`
+	DryRun  bool        `json:"dry_run"`
+	Total   int         `json:"total"`
+	Created int         `json:"created"`
+	Updated int         `json:"updated"`
+	Invalid int         `json:"invalid"`
+	Failed  int         `json:"failed"`
+	Rows    []RowResult `json:"rows"`
+}
+
+// Parse picks the manifest parser from the file extension, or from the
+// content type when the extension is not conclusive.
+func Parse(filename, contentType string, r io.Reader) ([]Row, error) {
+	switch {
+	case strings.EqualFold(filepath.Ext(filename), ".csv"), strings.Contains(contentType, "csv"):
+		return ParseCSV(r)
+	case strings.EqualFold(filepath.Ext(filename), ".json"), strings.Contains(contentType, "json"):
+		return ParseJSON(r)
+	}
+	return nil, errors.New("manifest must be a .csv or .json file")
+}
+
+type Importer struct {
+	Store *database.PostgresStore
+}
+
+func NewImporter(store *database.PostgresStore) *Importer {
+	return &Importer{Store: store}
+}
+
+// Import validates every row, then writes the valid ones in transactional
+// batches. A row that fails in the database rolls back its whole batch.
+func (im *Importer) Import(rows []Row, opts Options) (*Report, error) {
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	report := &Report{DryRun: opts.DryRun, Total: len(rows), Rows: make([]RowResult, len(rows))}
+	var items []database.ImportItem
+	var itemRows []int
+	seenISRC := make(map[string]int)
+	for i, row := range rows {
+		report.Rows[i] = RowResult{Line: row.Line, ISRC: row.ISRC, Title: row.Title}
+		item, errs := toImportItem(row)
+		if item != nil && item.Song.ISRC != nil {
+			if line, ok := seenISRC[*item.Song.ISRC]; ok {
+				errs = append(errs, fmt.Sprintf("isrc is already used on line %d", line))
+			} else {
+				seenISRC[*item.Song.ISRC] = row.Line
+			}
+		}
+		if len(errs) > 0 {
+			report.Rows[i].Status = StatusInvalid
+			report.Rows[i].Errors = errs
+			continue
+		}
+		items = append(items, *item)
+		itemRows = append(itemRows, i)
+	}
+
+	for start := 0; start < len(items); start += batchSize {
+		end := min(start+batchSize, len(items))
+		created, err := im.Store.ImportCatalogBatch(opts.AdminID, items[start:end], opts.DryRun)
+		if err != nil {
+			var rowErr *database.ImportRowError
+			if !errors.As(err, &rowErr) {
+				return nil, err
+			}
+			failedLine := report.Rows[itemRows[start+rowErr.Index]].Line
+			for j := start; j < end; j++ {
+				result := &report.Rows[itemRows[j]]
+				if j == start+rowErr.Index {
+					result.Status = StatusFailed
+					result.Errors = []string{rowErr.Error()}
+				} else {
+					result.Status = StatusRolledBack
+					result.Errors = []string{fmt.Sprintf("batch rolled back because line %d failed", failedLine)}
+				}
+			}
+			continue
+		}
+		for j, isNew := range created {
+			if isNew {
+				report.Rows[itemRows[start+j]].Status = StatusCreated
+			} else {
+				report.Rows[itemRows[start+j]].Status = StatusUpdated
+			}
+		}
+	}
+
+	for _, result := range report.Rows {
+		switch result.Status {
+		case StatusCreated:
+			report.Created++
+		case StatusUpdated:
+			report.Updated++
+		case StatusInvalid:
+			report.Invalid++
+		default:
+			report.Failed++
+		}
+	}
+	return report, nil
+}
+
+func toImportItem(row Row) (*database.ImportItem, []string) {
+	errs := append([]string(nil), row.parseErrors...)
+	var credits []database.CreditInput
+	for _, name := range row.Artists {
+		credits = append(credits, database.CreditInput{Name: name, Role: "primary"})
+	}
+	for _, name := range row.FeaturedArtists {
+		credits = append(credits, database.CreditInput{Name: name, Role: "featured"})
+	}
+	for _, name := range row.Producers {
+		credits = append(credits, database.CreditInput{Name: name, Role: "producer"})
+	}
+	isrc := row.ISRC
+	releaseDate := row.ReleaseDate
+	item := &database.ImportItem{
+		Song: database.SongInput{
+			Title:       row.Title,
+			Artists:     credits,
+			DurationMs:  row.DurationMs,
+			ISRC:        &isrc,
+			Genre:       row.Genre,
+			Explicit:    row.Explicit,
+			PremiumOnly: row.PremiumOnly,
+			ImageURL:    row.ImageURL,
+			SongURL:     row.SongURL,
+			ReleaseDate: &releaseDate,
+			Available:   row.Available,
+		},
+		Categories: row.Categories,
+		Lyrics:     row.Lyrics,
+	}
+	if row.TrackNumber != 0 {
+		trackNumber := row.TrackNumber
+		item.Song.TrackNumber = &trackNumber
+	}
+	item.Song.Normalize()
+	if item.Song.ISRC == nil {
+		errs = append(errs, "isrc is required")
+	}
+	if err := item.Song.Validate(); err != nil {
+		var validationErrs database.ValidationErrors
+		if errors.As(err, &validationErrs) {
+			errs = append(errs, validationErrs...)
+		}
+	}
+	if album := strings.TrimSpace(row.Album); album != "" {
+		albumArtist := strings.TrimSpace(row.AlbumArtist)
+		if albumArtist == "" && len(row.Artists) > 0 {
+			albumArtist = row.Artists[0]
+		}
+		switch row.AlbumType {
+		case "", "album", "single", "ep", "compilation":
+		default:
+			errs = append(errs, "album_type must be album, single, ep or compilation")
+		}
+		item.Album = &database.ImportAlbum{
+			Title:       album,
+			ArtistName:  albumArtist,
+			AlbumType:   row.AlbumType,
+			ReleaseDate: item.Song.ReleaseDate,
+			ImageURL:    item.Song.ImageURL,
+		}
+	}
+	return item, errs
+}
+
+// WriteCSV writes the per-row results of a report as CSV.
+func (r *Report) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"line", "isrc", "title", "status", "errors"}); err != nil {
+		return err
+	}
+	for _, row := range r.Rows {
+		record := []string{strconv.Itoa(row.Line), row.ISRC, row.Title, row.Status, strings.Join(row.Errors, "; ")}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
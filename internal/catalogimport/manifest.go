@@ -0,0 +1,217 @@
+package catalogimport
+
+import (
+	"el-music-be/internal/database"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Row is one song of a delivery manifest, as read from CSV or JSON.
+type Row struct {
+	Line            int                  `json:"-"`
+	ISRC            string               `json:"isrc"`
+	Title           string               `json:"title"`
+	Artists         []string             `json:"artists"`
+	FeaturedArtists []string             `json:"featured_artists"`
+	Producers       []string             `json:"producers"`
+	Album           string               `json:"album"`
+	AlbumArtist     string               `json:"album_artist"`
+	AlbumType       string               `json:"album_type"`
+	TrackNumber     int                  `json:"track_number"`
+	DurationMs      int                  `json:"duration_ms"`
+	Genre           string               `json:"genre"`
+	Explicit        bool                 `json:"explicit"`
+	PremiumOnly     bool                 `json:"premium_only"`
+	ImageURL        string               `json:"image_url"`
+	SongURL         string               `json:"song_url"`
+	ReleaseDate     string               `json:"release_date"`
+	Available       *bool                `json:"available"`
+	Categories      []string             `json:"categories"`
+	Lyrics          []database.LyricLine `json:"lyrics"`
+
+	parseErrors []string
+}
+
+var lrcLine = regexp.MustCompile(`^\[(\d{1,2}:\d{2}(?:\.\d{1,3})?)\]\s*(.*)$`)
+
+// ParseJSON reads a manifest that is either an array of rows or an object
+// with the rows under "songs".
+func ParseJSON(r io.Reader) ([]Row, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var rows []Row
+	if err := json.Unmarshal(data, &rows); err != nil {
+		var manifest struct {
+			Songs []Row `json:"songs"`
+		}
+		if err := json.Unmarshal(data, &manifest); err != nil {
+			return nil, fmt.Errorf("invalid JSON manifest: %w", err)
+		}
+		rows = manifest.Songs
+	}
+	for i := range rows {
+		rows[i].Line = i + 1
+	}
+	return rows, nil
+}
+
+// ParseCSV reads a manifest with a header row. Multi-valued columns
+// (artists, featured_artists, producers, categories) are separated by ";",
+// and the lyrics column holds LRC text.
+func ParseCSV(r io.Reader) ([]Row, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("could not read CSV header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	var rows []Row
+	line := 1
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		line++
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		get := func(name string) string {
+			i, ok := columns[name]
+			if !ok || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+		row := Row{
+			Line:            line,
+			ISRC:            get("isrc"),
+			Title:           get("title"),
+			Artists:         splitList(get("artists")),
+			FeaturedArtists: splitList(get("featured_artists")),
+			Producers:       splitList(get("producers")),
+			Album:           get("album"),
+			AlbumArtist:     get("album_artist"),
+			AlbumType:       strings.ToLower(get("album_type")),
+			Genre:           get("genre"),
+			ImageURL:        get("image_url"),
+			SongURL:         get("song_url"),
+			ReleaseDate:     get("release_date"),
+			Categories:      splitList(get("categories")),
+		}
+		if v := get("track_number"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				row.parseErrors = append(row.parseErrors, "track_number must be a number")
+			}
+			row.TrackNumber = n
+		}
+		if v := get("duration_ms"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				row.parseErrors = append(row.parseErrors, "duration_ms must be a number")
+			}
+			row.DurationMs = n
+		} else if v := get("duration"); v != "" {
+			ms, err := parseDuration(v)
+			if err != nil {
+				row.parseErrors = append(row.parseErrors, "duration must be formatted as m:ss")
+			}
+			row.DurationMs = ms
+		}
+		if v := get("explicit"); v != "" {
+			b, err := parseBool(v)
+			if err != nil {
+				row.parseErrors = append(row.parseErrors, "explicit must be true or false")
+			}
+			row.Explicit = b
+		}
+		if v := get("premium_only"); v != "" {
+			b, err := parseBool(v)
+			if err != nil {
+				row.parseErrors = append(row.parseErrors, "premium_only must be true or false")
+			}
+			row.PremiumOnly = b
+		}
+		if v := get("available"); v != "" {
+			b, err := parseBool(v)
+			if err != nil {
+				row.parseErrors = append(row.parseErrors, "available must be true or false")
+			}
+			row.Available = &b
+		}
+		if v := get("lyrics"); v != "" {
+			lyrics, err := ParseLRC(v)
+			if err != nil {
+				row.parseErrors = append(row.parseErrors, err.Error())
+			}
+			row.Lyrics = lyrics
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// ParseLRC reads "[mm:ss.xx] text" lines into lyric lines.
+func ParseLRC(text string) ([]database.LyricLine, error) {
+	var lines []database.LyricLine
+	for i, raw := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		m := lrcLine.FindStringSubmatch(raw)
+		if m == nil {
+			return nil, fmt.Errorf("lyrics line %d is not in LRC format", i+1)
+		}
+		lines = append(lines, database.LyricLine{Timestamp: m[1], Text: m[2]})
+	}
+	return lines, nil
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ";") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func parseDuration(value string) (int, error) {
+	minutes, seconds, found := strings.Cut(value, ":")
+	if !found {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	m, err := strconv.Atoi(minutes)
+	if err != nil {
+		return 0, err
+	}
+	s, err := strconv.ParseFloat(seconds, 64)
+	if err != nil || s >= 60 {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	return m*60000 + int(s*1000), nil
+}
+
+func parseBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "1", "true", "yes", "y":
+		return true, nil
+	case "0", "false", "no", "n":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid boolean %q", value)
+}
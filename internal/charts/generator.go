@@ -0,0 +1,99 @@
+// Package charts materializes the daily, weekly and trending charts from play
+// events, so serving a chart is a lookup of its latest snapshot.
+package charts
+
+import (
+	"el-music-be/internal/database"
+	"log"
+	"time"
+)
+
+const (
+	// Size is how many songs a chart holds.
+	Size = 50
+	// minMsPlayed is how long a song must play before the play counts.
+	minMsPlayed = 30000
+
+	trendingWindow   = 24 * time.Hour
+	trendingBaseline = 7 * 24 * time.Hour
+	// minTrendingPlays keeps songs with a handful of plays off the trending
+	// chart.
+	minTrendingPlays = 10
+	// trendingSmoothing is added to a song's daily baseline, so going from
+	// zero to a few plays does not count as infinite growth.
+	trendingSmoothing = 5
+	// trendingRetention is how long hourly trending snapshots are kept.
+	trendingRetention = 7 * 24 * time.Hour
+)
+
+type Generator struct {
+	Store *database.PostgresStore
+}
+
+func NewGenerator(store *database.PostgresStore) *Generator {
+	return &Generator{Store: store}
+}
+
+// Run generates the charts that are due, then again every interval, forever.
+func (g *Generator) Run(interval time.Duration) {
+	for {
+		if err := g.GenerateDue(time.Now()); err != nil {
+			log.Printf("Chart job failed: %v", err)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// GenerateDue generates the charts of the last complete day and week and
+// the trending chart of the current hour, unless they already exist.
+func (g *Generator) GenerateDue(now time.Time) error {
+	dayEnd := dayStart(now)
+	if err := g.generate(database.ChartDaily, dayEnd.AddDate(0, 0, -1), dayEnd); err != nil {
+		return err
+	}
+	weekEnd := weekStart(now)
+	if err := g.generate(database.ChartWeekly, weekEnd.AddDate(0, 0, -7), weekEnd); err != nil {
+		return err
+	}
+
+	hour := now.UTC().Truncate(time.Hour)
+	recentStart := hour.Add(-trendingWindow)
+	done, err := g.Store.HasChartSnapshot(database.ChartTrending, recentStart)
+	if err != nil || done {
+		return err
+	}
+	rankings, err := g.Store.GetTrendingRankings(recentStart.Add(-trendingBaseline), recentStart, hour,
+		minMsPlayed, minTrendingPlays, trendingSmoothing, Size)
+	if err != nil {
+		return err
+	}
+	if err := g.Store.SaveChartSnapshots(database.ChartTrending, recentStart, hour, rankings); err != nil {
+		return err
+	}
+	return g.Store.DeleteChartSnapshotsBefore(database.ChartTrending, hour.Add(-trendingRetention))
+}
+
+func (g *Generator) generate(chartType string, start, end time.Time) error {
+	done, err := g.Store.HasChartSnapshot(chartType, start)
+	if err != nil || done {
+		return err
+	}
+	rankings, err := g.Store.GetChartRankings(start, end, minMsPlayed, Size)
+	if err != nil {
+		return err
+	}
+	return g.Store.SaveChartSnapshots(chartType, start, end, rankings)
+}
+
+func dayStart(now time.Time) time.Time {
+	now = now.UTC()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// weekStart returns the most recent Friday at midnight UTC. Chart weeks run
+// Friday to Thursday, in step with new releases.
+func weekStart(now time.Time) time.Time {
+	day := dayStart(now)
+	daysSinceFriday := (int(day.Weekday()) - int(time.Friday) + 7) % 7
+	return day.AddDate(0, 0, -daysSinceFriday)
+}
@@ -0,0 +1,147 @@
+package database
+
+import "time"
+
+type Artist struct {
+	ID            string `json:"id"`
+	Name          string `json:"name"`
+	ImageURL      string `json:"imageUrl"`
+	Bio           string `json:"bio"`
+	FollowerCount int    `json:"follower_count"`
+	Following     bool   `json:"following"`
+}
+
+type Album struct {
+	ID          string     `json:"id"`
+	Title       string     `json:"title"`
+	ArtistID    string     `json:"artist_id"`
+	ArtistName  string     `json:"artist_name"`
+	AlbumType   string     `json:"album_type"`
+	ReleaseDate *time.Time `json:"release_date"`
+	ImageURL    string     `json:"imageUrl"`
+}
+
+type AlbumTrack struct {
+	Song
+	DiscNumber  int  `json:"disc_number"`
+	TrackNumber *int `json:"track_number"`
+}
+
+type AlbumDetail struct {
+	Album
+	Tracks []AlbumTrack `json:"tracks"`
+}
+
+func (s *PostgresStore) GetArtistByID(id, userID string) (*Artist, error) {
+	var artist Artist
+	err := s.Db.QueryRow(`
+		SELECT a.id, a.name, a.image_url, a.bio,
+			(SELECT COUNT(*) FROM artist_follows f WHERE f.artist_id = a.id),
+			EXISTS (SELECT 1 FROM artist_follows f WHERE f.artist_id = a.id AND f.user_id = $2)
+		FROM artists a
+		WHERE a.id = $1`, id, userID,
+	).Scan(&artist.ID, &artist.Name, &artist.ImageURL, &artist.Bio, &artist.FollowerCount, &artist.Following)
+	if err != nil {
+		return nil, err
+	}
+	return &artist, nil
+}
+
+// GetArtistTopSongs returns the songs an artist is credited on as primary or
+// featured artist, most played in the last 30 days first.
+func (s *PostgresStore) GetArtistTopSongs(artistID, userID string, limit int) ([]Song, error) {
+	rows, err := s.Db.Query(`
+		SELECT s.id, s.title, s.artist, s.image_url, s.loudness_lufs, s.track_peak, s.replay_gain_db,
+			EXISTS (SELECT 1 FROM liked_songs l WHERE l.user_id = $2 AND l.song_id = s.id)
+		FROM songs s
+		LEFT JOIN play_events pe ON pe.song_id = s.id AND pe.started_at >= NOW() - INTERVAL '30 days'
+		WHERE s.deleted_at IS NULL AND s.available AND EXISTS (
+			SELECT 1 FROM song_artists sa
+			WHERE sa.song_id = s.id AND sa.artist_id = $1 AND sa.role IN ('primary', 'featured')
+		)
+		GROUP BY s.id
+		ORDER BY COUNT(pe.id) DESC, s.title
+		LIMIT $3`,
+		artistID, userID, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	songs := make([]Song, 0)
+	for rows.Next() {
+		var song Song
+		if err := rows.Scan(&song.ID, &song.Title, &song.Artist, &song.ImageURL, &song.LoudnessLUFS, &song.TrackPeak, &song.ReplayGainDB, &song.Liked); err != nil {
+			return nil, err
+		}
+		songs = append(songs, song)
+	}
+	return songs, rows.Err()
+}
+
+func (s *PostgresStore) GetArtistAlbums(artistID string) ([]Album, error) {
+	rows, err := s.Db.Query(`
+		SELECT al.id, al.title, al.artist_id, ar.name, al.album_type, al.release_date, al.image_url
+		FROM albums al
+		INNER JOIN artists ar ON ar.id = al.artist_id
+		WHERE al.artist_id = $1
+		ORDER BY al.release_date DESC NULLS LAST, al.title`, artistID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	albums := make([]Album, 0)
+	for rows.Next() {
+		album, err := scanAlbum(rows)
+		if err != nil {
+			return nil, err
+		}
+		albums = append(albums, *album)
+	}
+	return albums, rows.Err()
+}
+
+func (s *PostgresStore) GetAlbumByID(albumID, userID string) (*AlbumDetail, error) {
+	album, err := scanAlbum(s.Db.QueryRow(`
+		SELECT al.id, al.title, al.artist_id, ar.name, al.album_type, al.release_date, al.image_url
+		FROM albums al
+		INNER JOIN artists ar ON ar.id = al.artist_id
+		WHERE al.id = $1`, albumID))
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.Db.Query(`
+		SELECT s.id, s.title, s.artist, s.image_url, s.loudness_lufs, s.track_peak, s.replay_gain_db,
+			EXISTS (SELECT 1 FROM liked_songs l WHERE l.user_id = $2 AND l.song_id = s.id),
+			s.disc_number, s.track_number
+		FROM songs s
+		WHERE s.album_id = $1 AND s.deleted_at IS NULL AND s.available
+		ORDER BY s.disc_number, s.track_number NULLS LAST, s.title`, albumID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	detail := &AlbumDetail{Album: *album, Tracks: make([]AlbumTrack, 0)}
+	for rows.Next() {
+		var track AlbumTrack
+		if err := rows.Scan(&track.ID, &track.Title, &track.Artist, &track.ImageURL, &track.LoudnessLUFS, &track.TrackPeak, &track.ReplayGainDB, &track.Liked,
+			&track.DiscNumber, &track.TrackNumber); err != nil {
+			return nil, err
+		}
+		detail.Tracks = append(detail.Tracks, track)
+	}
+	return detail, rows.Err()
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAlbum(row rowScanner) (*Album, error) {
+	var album Album
+	if err := row.Scan(&album.ID, &album.Title, &album.ArtistID, &album.ArtistName, &album.AlbumType,
+		&album.ReleaseDate, &album.ImageURL); err != nil {
+		return nil, err
+	}
+	return &album, nil
+}
@@ -0,0 +1,566 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var isrcPattern = regexp.MustCompile(`^[A-Z]{2}[A-Z0-9]{3}[0-9]{7}$`)
+
+var creditRoles = map[string]bool{"primary": true, "featured": true, "producer": true}
+
+type ValidationErrors []string
+
+func (v ValidationErrors) Error() string {
+	return strings.Join(v, "; ")
+}
+
+type CreditInput struct {
+	ArtistID string `json:"artist_id"`
+	Name     string `json:"name"`
+	Role     string `json:"role"`
+}
+
+// SongInput is everything an admin can set on a catalog song. Artists are
+// referenced by ID, or by name to find or create them.
+type SongInput struct {
+	Title       string        `json:"title"`
+	Artists     []CreditInput `json:"artists"`
+	AlbumID     *string       `json:"album_id"`
+	TrackNumber *int          `json:"track_number"`
+	DurationMs  int           `json:"duration_ms"`
+	ISRC        *string       `json:"isrc"`
+	Genre       string        `json:"genre"`
+	Explicit    bool          `json:"explicit"`
+	PremiumOnly bool          `json:"premium_only"`
+	ImageURL    string        `json:"imageUrl"`
+	SongURL     string        `json:"songUrl"`
+	ReleaseDate *string       `json:"release_date"`
+	Available   *bool         `json:"available"`
+}
+
+type ArtistCredit struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Role string `json:"role"`
+}
+
+// CatalogSong is the full admin view of a song, including soft deleted ones.
+type CatalogSong struct {
+	ID          string         `json:"id"`
+	Title       string         `json:"title"`
+	Artist      string         `json:"artist"`
+	Artists     []ArtistCredit `json:"artists"`
+	AlbumID     *string        `json:"album_id"`
+	TrackNumber *int           `json:"track_number"`
+	DurationMs  int            `json:"duration_ms"`
+	ISRC        *string        `json:"isrc"`
+	Genre       string         `json:"genre"`
+	Explicit    bool           `json:"explicit"`
+	PremiumOnly bool           `json:"premium_only"`
+	ImageURL    string         `json:"imageUrl"`
+	SongURL     string         `json:"songUrl"`
+	ReleaseDate *string        `json:"release_date"`
+	Available   bool           `json:"available"`
+	Draft       bool           `json:"draft"`
+	AudioFormat *string        `json:"audio_format"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   *time.Time     `json:"deleted_at"`
+}
+
+type AuditEntry struct {
+	ID        string          `json:"id"`
+	SongID    string          `json:"song_id"`
+	AdminID   string          `json:"admin_id"`
+	AdminName string          `json:"admin_name"`
+	Action    string          `json:"action"`
+	Changes   json.RawMessage `json:"changes"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+type querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// Normalize trims the input and brings identifiers into canonical form.
+func (in *SongInput) Normalize() {
+	in.Title = strings.TrimSpace(in.Title)
+	in.Genre = strings.TrimSpace(in.Genre)
+	in.ImageURL = strings.TrimSpace(in.ImageURL)
+	in.SongURL = strings.TrimSpace(in.SongURL)
+	for i := range in.Artists {
+		in.Artists[i].ArtistID = strings.TrimSpace(in.Artists[i].ArtistID)
+		in.Artists[i].Name = strings.TrimSpace(in.Artists[i].Name)
+		in.Artists[i].Role = strings.ToLower(strings.TrimSpace(in.Artists[i].Role))
+		if in.Artists[i].Role == "" {
+			in.Artists[i].Role = "primary"
+		}
+	}
+	if in.ISRC != nil {
+		isrc := strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(*in.ISRC), "-", ""))
+		if isrc == "" {
+			in.ISRC = nil
+		} else {
+			in.ISRC = &isrc
+		}
+	}
+	if in.AlbumID != nil && strings.TrimSpace(*in.AlbumID) == "" {
+		in.AlbumID = nil
+	}
+	if in.ReleaseDate != nil && strings.TrimSpace(*in.ReleaseDate) == "" {
+		in.ReleaseDate = nil
+	}
+}
+
+func (in *SongInput) Validate() error {
+	var errs ValidationErrors
+	if in.Title == "" {
+		errs = append(errs, "title is required")
+	}
+	if in.SongURL == "" {
+		errs = append(errs, "songUrl is required")
+	}
+	if in.DurationMs <= 0 {
+		errs = append(errs, "duration_ms must be positive")
+	}
+	hasPrimary := false
+	for i, credit := range in.Artists {
+		if credit.ArtistID == "" && credit.Name == "" {
+			errs = append(errs, fmt.Sprintf("artists[%d] needs an artist_id or a name", i))
+		}
+		if !creditRoles[credit.Role] {
+			errs = append(errs, fmt.Sprintf("artists[%d] has invalid role %q", i, credit.Role))
+		}
+		if credit.Role == "primary" {
+			hasPrimary = true
+		}
+	}
+	if !hasPrimary {
+		errs = append(errs, "at least one primary artist is required")
+	}
+	if in.ISRC != nil && !isrcPattern.MatchString(*in.ISRC) {
+		errs = append(errs, "isrc must look like CCXXXYYNNNNN")
+	}
+	if in.TrackNumber != nil && *in.TrackNumber <= 0 {
+		errs = append(errs, "track_number must be positive")
+	}
+	if in.ReleaseDate != nil {
+		if _, err := time.Parse("2006-01-02", *in.ReleaseDate); err != nil {
+			errs = append(errs, "release_date must be formatted as YYYY-MM-DD")
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (in *SongInput) available() bool {
+	return in.Available == nil || *in.Available
+}
+
+func (s *PostgresStore) CreateSong(adminID string, in *SongInput) (*CatalogSong, error) {
+	tx, err := s.Db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	song, err := createSong(tx, adminID, in)
+	if err != nil {
+		return nil, err
+	}
+	return song, tx.Commit()
+}
+
+func createSong(tx *sql.Tx, adminID string, in *SongInput) (*CatalogSong, error) {
+	var songID string
+	err := tx.QueryRow(`
+		INSERT INTO songs (title, artist, album_id, track_number, duration_ms, isrc, genre, explicit,
+			premium_only, image_url, song_url, release_date, available)
+		VALUES ($1, '', $2, $3, $4, $5, $6, $7, $8, $9, $10, $11::date, $12)
+		RETURNING id`,
+		in.Title, in.AlbumID, in.TrackNumber, in.DurationMs, in.ISRC, in.Genre, in.Explicit,
+		in.PremiumOnly, in.ImageURL, in.SongURL, in.ReleaseDate, in.available(),
+	).Scan(&songID)
+	if err != nil {
+		return nil, err
+	}
+	if err := saveCredits(tx, songID, in.Artists); err != nil {
+		return nil, err
+	}
+	song, err := getCatalogSong(tx, songID)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeAudit(tx, songID, adminID, "create", nil, song); err != nil {
+		return nil, err
+	}
+	return song, nil
+}
+
+func (s *PostgresStore) UpdateSong(adminID, songID string, in *SongInput) (*CatalogSong, error) {
+	tx, err := s.Db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	song, err := updateSong(tx, adminID, songID, in)
+	if err != nil {
+		return nil, err
+	}
+	return song, tx.Commit()
+}
+
+func updateSong(tx *sql.Tx, adminID, songID string, in *SongInput) (*CatalogSong, error) {
+	if _, err := tx.Exec("SELECT 1 FROM songs WHERE id = $1 FOR UPDATE", songID); err != nil {
+		return nil, err
+	}
+	before, err := getCatalogSong(tx, songID)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(`
+		UPDATE songs
+		SET title = $2, album_id = $3, track_number = $4, duration_ms = $5, isrc = $6, genre = $7,
+			explicit = $8, premium_only = $9, image_url = $10, song_url = $11, release_date = $12::date,
+			available = $13 AND NOT is_draft, updated_at = NOW()
+		WHERE id = $1`,
+		songID, in.Title, in.AlbumID, in.TrackNumber, in.DurationMs, in.ISRC, in.Genre,
+		in.Explicit, in.PremiumOnly, in.ImageURL, in.SongURL, in.ReleaseDate, in.available(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := saveCredits(tx, songID, in.Artists); err != nil {
+		return nil, err
+	}
+	after, err := getCatalogSong(tx, songID)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeAudit(tx, songID, adminID, "update", before, after); err != nil {
+		return nil, err
+	}
+	return after, nil
+}
+
+// DeleteSong soft deletes a song: it disappears from listings, while play
+// history, likes and playlist entries that reference it are kept.
+func (s *PostgresStore) DeleteSong(adminID, songID string) error {
+	return s.setSongDeleted(adminID, songID, true)
+}
+
+func (s *PostgresStore) RestoreSong(adminID, songID string) error {
+	return s.setSongDeleted(adminID, songID, false)
+}
+
+func (s *PostgresStore) setSongDeleted(adminID, songID string, deleted bool) error {
+	tx, err := s.Db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	before, err := getCatalogSong(tx, songID)
+	if err != nil {
+		return err
+	}
+	query := "UPDATE songs SET deleted_at = NOW(), updated_at = NOW() WHERE id = $1 AND deleted_at IS NULL"
+	action := "delete"
+	if !deleted {
+		query = "UPDATE songs SET deleted_at = NULL, updated_at = NOW() WHERE id = $1 AND deleted_at IS NOT NULL"
+		action = "restore"
+	}
+	res, err := tx.Exec(query, songID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	after, err := getCatalogSong(tx, songID)
+	if err != nil {
+		return err
+	}
+	if err := writeAudit(tx, songID, adminID, action, before, after); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *PostgresStore) GetCatalogSong(songID string) (*CatalogSong, error) {
+	return getCatalogSong(s.Db, songID)
+}
+
+const catalogSongColumns = `s.id, s.title, s.artist, s.album_id, s.track_number, s.duration_ms, s.isrc, s.genre,
+	s.explicit, s.premium_only, s.image_url, s.song_url, to_char(s.release_date, 'YYYY-MM-DD'), s.available,
+	s.is_draft, s.audio_format, s.created_at, s.updated_at, s.deleted_at`
+
+func scanCatalogSong(row rowScanner) (*CatalogSong, error) {
+	var song CatalogSong
+	err := row.Scan(&song.ID, &song.Title, &song.Artist, &song.AlbumID, &song.TrackNumber, &song.DurationMs,
+		&song.ISRC, &song.Genre, &song.Explicit, &song.PremiumOnly, &song.ImageURL, &song.SongURL, &song.ReleaseDate,
+		&song.Available, &song.Draft, &song.AudioFormat, &song.CreatedAt, &song.UpdatedAt, &song.DeletedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &song, nil
+}
+
+// input converts the song back into the fields an admin can edit.
+func (song *CatalogSong) input() SongInput {
+	in := SongInput{
+		Title:       song.Title,
+		AlbumID:     song.AlbumID,
+		TrackNumber: song.TrackNumber,
+		DurationMs:  song.DurationMs,
+		ISRC:        song.ISRC,
+		Genre:       song.Genre,
+		Explicit:    song.Explicit,
+		PremiumOnly: song.PremiumOnly,
+		ImageURL:    song.ImageURL,
+		SongURL:     song.SongURL,
+		ReleaseDate: song.ReleaseDate,
+	}
+	for _, credit := range song.Artists {
+		in.Artists = append(in.Artists, CreditInput{ArtistID: credit.ID, Role: credit.Role})
+	}
+	return in
+}
+
+func getCatalogSong(q querier, songID string) (*CatalogSong, error) {
+	song, err := scanCatalogSong(q.QueryRow("SELECT "+catalogSongColumns+" FROM songs s WHERE s.id = $1", songID))
+	if err != nil {
+		return nil, err
+	}
+	credits, err := loadCredits(q, []string{song.ID})
+	if err != nil {
+		return nil, err
+	}
+	song.Artists = credits[song.ID]
+	return song, nil
+}
+
+// ListCatalogSongs lists songs newest first for the admin catalog, matching
+// query against title, display artist and ISRC.
+func (s *PostgresStore) ListCatalogSongs(query string, includeDeleted bool, cursor string, limit int) (*Page[CatalogSong], error) {
+	var afterTime sql.NullTime
+	var afterSongID sql.NullString
+	if cursor != "" {
+		t, songID, err := decodeTimeCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		afterTime = sql.NullTime{Time: t, Valid: true}
+		afterSongID = sql.NullString{String: songID, Valid: true}
+	}
+	rows, err := s.Db.Query(`
+		SELECT `+catalogSongColumns+`
+		FROM songs s
+		WHERE ($1 = '' OR s.title ILIKE '%' || $1 || '%' OR s.artist ILIKE '%' || $1 || '%' OR s.isrc = upper($1))
+			AND ($2 OR s.deleted_at IS NULL)
+			AND ($3::timestamptz IS NULL OR (s.created_at, s.id::text) < ($3, $4))
+		ORDER BY s.created_at DESC, s.id::text DESC
+		LIMIT $5`,
+		query, includeDeleted, afterTime, afterSongID, limit+1,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	page := &Page[CatalogSong]{Items: make([]CatalogSong, 0, limit)}
+	for rows.Next() {
+		song, err := scanCatalogSong(rows)
+		if err != nil {
+			return nil, err
+		}
+		page.Items = append(page.Items, *song)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(page.Items) > limit {
+		page.Items = page.Items[:limit]
+		last := page.Items[limit-1]
+		page.NextCursor = encodeTimeCursor(last.CreatedAt, last.ID)
+	}
+	ids := make([]string, len(page.Items))
+	for i, song := range page.Items {
+		ids[i] = song.ID
+	}
+	credits, err := loadCredits(s.Db, ids)
+	if err != nil {
+		return nil, err
+	}
+	for i := range page.Items {
+		page.Items[i].Artists = credits[page.Items[i].ID]
+	}
+	return page, nil
+}
+
+func (s *PostgresStore) GetSongAuditLog(songID string) ([]AuditEntry, error) {
+	rows, err := s.Db.Query(`
+		SELECT l.id, l.song_id, l.admin_id, u.name, l.action, l.changes, l.created_at
+		FROM song_audit_log l
+		INNER JOIN users u ON u.id = l.admin_id
+		WHERE l.song_id = $1
+		ORDER BY l.created_at DESC`, songID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	entries := make([]AuditEntry, 0)
+	for rows.Next() {
+		var entry AuditEntry
+		var changes []byte
+		if err := rows.Scan(&entry.ID, &entry.SongID, &entry.AdminID, &entry.AdminName, &entry.Action,
+			&changes, &entry.CreatedAt); err != nil {
+			return nil, err
+		}
+		entry.Changes = changes
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+func loadCredits(q querier, songIDs []string) (map[string][]ArtistCredit, error) {
+	credits := make(map[string][]ArtistCredit)
+	if len(songIDs) == 0 {
+		return credits, nil
+	}
+	rows, err := q.Query(`
+		SELECT sa.song_id, a.id, a.name, sa.role
+		FROM song_artists sa
+		INNER JOIN artists a ON a.id = sa.artist_id
+		WHERE sa.song_id = ANY($1::uuid[])
+		ORDER BY sa.song_id,
+			CASE sa.role WHEN 'primary' THEN 0 WHEN 'featured' THEN 1 ELSE 2 END,
+			sa.position`, pq.Array(songIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var songID string
+		var credit ArtistCredit
+		if err := rows.Scan(&songID, &credit.ID, &credit.Name, &credit.Role); err != nil {
+			return nil, err
+		}
+		credits[songID] = append(credits[songID], credit)
+	}
+	return credits, rows.Err()
+}
+
+// saveCredits replaces the artist credits of a song, creating artists given
+// only by name, and refreshes the display credit line in songs.artist.
+func saveCredits(tx *sql.Tx, songID string, credits []CreditInput) error {
+	if _, err := tx.Exec("DELETE FROM song_artists WHERE song_id = $1", songID); err != nil {
+		return err
+	}
+	positions := make(map[string]int)
+	var primary, featured []string
+	for _, credit := range credits {
+		artistID, name, err := resolveArtist(tx, credit)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`
+			INSERT INTO song_artists (song_id, artist_id, role, position)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT DO NOTHING`,
+			songID, artistID, credit.Role, positions[credit.Role],
+		)
+		if err != nil {
+			return err
+		}
+		positions[credit.Role]++
+		switch credit.Role {
+		case "primary":
+			primary = append(primary, name)
+		case "featured":
+			featured = append(featured, name)
+		}
+	}
+	display := strings.Join(primary, ", ")
+	if len(featured) > 0 {
+		display += " feat. " + strings.Join(featured, ", ")
+	}
+	_, err := tx.Exec("UPDATE songs SET artist = $2 WHERE id = $1", songID, display)
+	return err
+}
+
+func resolveArtist(tx *sql.Tx, credit CreditInput) (string, string, error) {
+	var id, name string
+	if credit.ArtistID != "" {
+		err := tx.QueryRow("SELECT id, name FROM artists WHERE id = $1", credit.ArtistID).Scan(&id, &name)
+		if err == sql.ErrNoRows {
+			return "", "", ValidationErrors{fmt.Sprintf("artist %s does not exist", credit.ArtistID)}
+		}
+		return id, name, err
+	}
+	err := tx.QueryRow(
+		"SELECT id, name FROM artists WHERE lower(name) = lower($1) ORDER BY created_at, id LIMIT 1",
+		credit.Name,
+	).Scan(&id, &name)
+	if err == sql.ErrNoRows {
+		err = tx.QueryRow("INSERT INTO artists (name) VALUES ($1) RETURNING id, name", credit.Name).Scan(&id, &name)
+	}
+	return id, name, err
+}
+
+// writeAudit records which fields an admin changed, as {"field": {"from": .., "to": ..}}.
+func writeAudit(tx *sql.Tx, songID, adminID, action string, before, after *CatalogSong) error {
+	from, err := auditFields(before)
+	if err != nil {
+		return err
+	}
+	to, err := auditFields(after)
+	if err != nil {
+		return err
+	}
+	changes := make(map[string]map[string]interface{})
+	for field, value := range to {
+		if !reflect.DeepEqual(from[field], value) {
+			changes[field] = map[string]interface{}{"from": from[field], "to": value}
+		}
+	}
+	encoded, err := json.Marshal(changes)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(
+		"INSERT INTO song_audit_log (song_id, admin_id, action, changes) VALUES ($1, $2, $3, $4)",
+		songID, adminID, action, encoded,
+	)
+	return err
+}
+
+func auditFields(song *CatalogSong) (map[string]interface{}, error) {
+	fields := make(map[string]interface{})
+	if song == nil {
+		return fields, nil
+	}
+	encoded, err := json.Marshal(song)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(encoded, &fields); err != nil {
+		return nil, err
+	}
+	delete(fields, "created_at")
+	delete(fields, "updated_at")
+	return fields, nil
+}
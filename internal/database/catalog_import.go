@@ -0,0 +1,191 @@
+package database
+
+import (
+	"database/sql"
+	"strings"
+)
+
+type ImportAlbum struct {
+	Title       string
+	ArtistName  string
+	AlbumType   string
+	ReleaseDate *string
+	ImageURL    string
+}
+
+// ImportItem is one validated manifest row ready to be written.
+type ImportItem struct {
+	Song       SongInput
+	Album      *ImportAlbum
+	Categories []string
+	Lyrics     []LyricLine
+}
+
+// ImportRowError identifies the item of a batch that made it fail.
+type ImportRowError struct {
+	Index int
+	Err   error
+}
+
+func (e *ImportRowError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ImportRowError) Unwrap() error {
+	return e.Err
+}
+
+// ImportCatalogBatch upserts a batch of songs by ISRC in one transaction,
+// together with their albums, categories and lyrics. It reports for every
+// item whether the song was created (true) or updated (false). On a dry run
+// everything is written and then rolled back, so database level problems
+// are reported without changing the catalog.
+func (s *PostgresStore) ImportCatalogBatch(adminID string, items []ImportItem, dryRun bool) ([]bool, error) {
+	tx, err := s.Db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	created := make([]bool, len(items))
+	for i := range items {
+		isNew, err := importItem(tx, adminID, &items[i])
+		if err != nil {
+			return nil, &ImportRowError{Index: i, Err: err}
+		}
+		created[i] = isNew
+	}
+	if dryRun {
+		return created, nil
+	}
+	return created, tx.Commit()
+}
+
+func importItem(tx *sql.Tx, adminID string, item *ImportItem) (bool, error) {
+	if item.Album != nil {
+		albumID, err := findOrCreateAlbum(tx, item.Album)
+		if err != nil {
+			return false, err
+		}
+		item.Song.AlbumID = &albumID
+	}
+	var songID string
+	err := tx.QueryRow("SELECT id FROM songs WHERE isrc = $1 FOR UPDATE", item.Song.ISRC).Scan(&songID)
+	isNew := err == sql.ErrNoRows
+	if err != nil && !isNew {
+		return false, err
+	}
+	if isNew {
+		song, err := createSong(tx, adminID, &item.Song)
+		if err != nil {
+			return false, err
+		}
+		songID = song.ID
+	} else if _, err := updateSong(tx, adminID, songID, &item.Song); err != nil {
+		return false, err
+	}
+	if err := saveSongCategories(tx, songID, item.Categories); err != nil {
+		return false, err
+	}
+	if item.Lyrics != nil {
+		if err := saveLyrics(tx, songID, item.Lyrics); err != nil {
+			return false, err
+		}
+	}
+	return isNew, nil
+}
+
+func findOrCreateAlbum(tx *sql.Tx, album *ImportAlbum) (string, error) {
+	artistID, _, err := resolveArtist(tx, CreditInput{Name: album.ArtistName, Role: "primary"})
+	if err != nil {
+		return "", err
+	}
+	var albumID string
+	err = tx.QueryRow(
+		"SELECT id FROM albums WHERE artist_id = $1 AND lower(title) = lower($2) ORDER BY created_at, id LIMIT 1",
+		artistID, album.Title,
+	).Scan(&albumID)
+	if err != sql.ErrNoRows {
+		return albumID, err
+	}
+	albumType := album.AlbumType
+	if albumType == "" {
+		albumType = "album"
+	}
+	err = tx.QueryRow(`
+		INSERT INTO albums (title, artist_id, album_type, release_date, image_url)
+		VALUES ($1, $2, $3, $4::date, $5)
+		RETURNING id`,
+		album.Title, artistID, albumType, album.ReleaseDate, album.ImageURL,
+	).Scan(&albumID)
+	return albumID, err
+}
+
+func saveSongCategories(tx *sql.Tx, songID string, names []string) error {
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		var categoryID string
+		err := tx.QueryRow(
+			"SELECT id FROM categories WHERE lower(name) = lower($1) ORDER BY id LIMIT 1", name,
+		).Scan(&categoryID)
+		if err == sql.ErrNoRows {
+			err = tx.QueryRow(
+				"INSERT INTO categories (name, image_url) VALUES ($1, '') RETURNING id", name,
+			).Scan(&categoryID)
+		}
+		if err != nil {
+			return err
+		}
+		// Appending reads the last position, so it takes the same lock as
+		// every other change to the category's order.
+		if err := lockCategory(tx, categoryID); err != nil {
+			return err
+		}
+		_, err = tx.Exec(`
+			INSERT INTO song_categories (song_id, category_id, position)
+			SELECT $1, $2, COALESCE(MAX(position) + 1, 0) FROM song_categories WHERE category_id = $2
+			ON CONFLICT DO NOTHING`,
+			songID, categoryID,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func saveLyrics(tx *sql.Tx, songID string, lines []LyricLine) error {
+	if _, err := tx.Exec("DELETE FROM lyrics WHERE song_id = $1", songID); err != nil {
+		return err
+	}
+	for i, line := range lines {
+		_, err := tx.Exec(
+			"INSERT INTO lyrics (song_id, line_order, timestamp, text) VALUES ($1, $2, $3, $4)",
+			songID, i, line.Timestamp, line.Text,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *PostgresStore) SaveImportReport(adminID, filename string, dryRun bool, report []byte) (string, error) {
+	var id string
+	err := s.Db.QueryRow(
+		"INSERT INTO catalog_imports (admin_id, filename, dry_run, report) VALUES ($1, $2, $3, $4) RETURNING id",
+		adminID, filename, dryRun, report,
+	).Scan(&id)
+	return id, err
+}
+
+func (s *PostgresStore) GetImportReport(id string) ([]byte, error) {
+	var report []byte
+	err := s.Db.QueryRow("SELECT report FROM catalog_imports WHERE id = $1", id).Scan(&report)
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
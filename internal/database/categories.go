@@ -0,0 +1,285 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// CategoryPage is a category with its songs and curated playlists.
+type CategoryPage struct {
+	Category
+	Songs     *Page[Song] `json:"songs"`
+	Playlists []Playlist  `json:"playlists"`
+}
+
+// categoryMembers names the table that orders one kind of content within a
+// category.
+type categoryMembers struct {
+	table  string
+	column string
+}
+
+var (
+	categorySongs     = categoryMembers{table: "song_categories", column: "song_id"}
+	categoryPlaylists = categoryMembers{table: "category_playlists", column: "playlist_id"}
+)
+
+func (s *PostgresStore) GetCategory(categoryID string) (*Category, error) {
+	var category Category
+	err := s.Db.QueryRow("SELECT id, name, image_url FROM categories WHERE id = $1", categoryID).
+		Scan(&category.ID, &category.Name, &category.ImageURL)
+	if err != nil {
+		return nil, err
+	}
+	return &category, nil
+}
+
+// GetCategorySongs returns a page of a category's songs in curated order.
+func (s *PostgresStore) GetCategorySongs(categoryID, userID, cursor string, limit int) (*Page[Song], error) {
+	var afterPosition sql.NullInt64
+	var afterSongID sql.NullString
+	if cursor != "" {
+		position, songID, err := decodePositionCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		afterPosition = sql.NullInt64{Int64: int64(position), Valid: true}
+		afterSongID = sql.NullString{String: songID, Valid: true}
+	}
+
+	rows, err := s.Db.Query(`
+		SELECT s.id, s.title, s.artist, s.image_url, s.loudness_lufs, s.track_peak, s.replay_gain_db,
+			EXISTS (SELECT 1 FROM liked_songs l WHERE l.user_id = $2 AND l.song_id = s.id),
+			sc.position
+		FROM song_categories sc
+		INNER JOIN songs s ON s.id = sc.song_id
+		WHERE sc.category_id = $1 AND s.deleted_at IS NULL AND s.available
+			AND ($3::integer IS NULL OR (sc.position, sc.song_id::text) > ($3, $4))
+		ORDER BY sc.position, sc.song_id::text
+		LIMIT $5`,
+		categoryID, userID, afterPosition, afterSongID, limit+1,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	page := &Page[Song]{Items: make([]Song, 0, limit)}
+	var positions []int
+	for rows.Next() {
+		var song Song
+		var position int
+		if err := rows.Scan(&song.ID, &song.Title, &song.Artist, &song.ImageURL, &song.LoudnessLUFS, &song.TrackPeak, &song.ReplayGainDB, &song.Liked, &position); err != nil {
+			return nil, err
+		}
+		page.Items = append(page.Items, song)
+		positions = append(positions, position)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(page.Items) > limit {
+		page.Items = page.Items[:limit]
+		page.NextCursor = encodePositionCursor(positions[limit-1], page.Items[limit-1].ID)
+	}
+	return page, nil
+}
+
+// GetCategoryPlaylists returns the public playlists curated for a category,
+// in order.
+func (s *PostgresStore) GetCategoryPlaylists(categoryID string) ([]Playlist, error) {
+	rows, err := s.Db.Query(`
+		SELECT `+playlistColumns("NULL")+`
+		FROM category_playlists cp
+		INNER JOIN playlists p ON p.id = cp.playlist_id
+		WHERE cp.category_id = $1 AND p.visibility = 'public'
+		ORDER BY cp.position, p.id`, categoryID)
+	if err != nil {
+		return nil, err
+	}
+	return scanPlaylists(rows)
+}
+
+// AddCategorySong puts a song into a category at position, or at the end when
+// position is nil. A song already in the category is moved there.
+func (s *PostgresStore) AddCategorySong(categoryID, songID string, position *int) error {
+	return s.addCategoryMember(categorySongs, categoryID, songID, position)
+}
+
+func (s *PostgresStore) RemoveCategorySong(categoryID, songID string) error {
+	return s.removeCategoryMember(categorySongs, categoryID, songID)
+}
+
+// ReplaceCategorySongs makes songIDs, in that order, the songs of a category.
+func (s *PostgresStore) ReplaceCategorySongs(categoryID string, songIDs []string) error {
+	return s.replaceCategoryMembers(categorySongs, categoryID, songIDs)
+}
+
+// AddCategoryPlaylist puts a playlist into a category at position, or at the
+// end when position is nil. A playlist already in the category is moved there.
+// Only public playlists can be curated, and the category page stops listing
+// one that is made private later.
+func (s *PostgresStore) AddCategoryPlaylist(categoryID, playlistID string, position *int) error {
+	if err := checkCuratedPlaylists(s.Db, []string{playlistID}); err != nil {
+		return err
+	}
+	return s.addCategoryMember(categoryPlaylists, categoryID, playlistID, position)
+}
+
+func (s *PostgresStore) RemoveCategoryPlaylist(categoryID, playlistID string) error {
+	return s.removeCategoryMember(categoryPlaylists, categoryID, playlistID)
+}
+
+// ReplaceCategoryPlaylists makes playlistIDs, in that order, the curated
+// playlists of a category. They must all be public.
+func (s *PostgresStore) ReplaceCategoryPlaylists(categoryID string, playlistIDs []string) error {
+	if err := checkCuratedPlaylists(s.Db, playlistIDs); err != nil {
+		return err
+	}
+	return s.replaceCategoryMembers(categoryPlaylists, categoryID, playlistIDs)
+}
+
+// checkCuratedPlaylists returns ValidationErrors naming the playlists that do
+// not exist or are not public, since curated lists would silently skip them.
+func checkCuratedPlaylists(q querier, playlistIDs []string) error {
+	lowered := make([]string, len(playlistIDs))
+	for i, id := range playlistIDs {
+		lowered[i] = strings.ToLower(id)
+	}
+	rows, err := q.Query(
+		"SELECT id::text FROM playlists WHERE id::text = ANY($1) AND visibility = 'public'", pq.Array(lowered))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	public := make(map[string]bool)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return err
+		}
+		public[id] = true
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	var errs ValidationErrors
+	for i, id := range playlistIDs {
+		if !public[lowered[i]] {
+			errs = append(errs, fmt.Sprintf("playlist %s does not exist or is not public", id))
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// lockCategory serialises changes to the order of a category. It returns
+// sql.ErrNoRows when the category does not exist.
+func lockCategory(tx *sql.Tx, categoryID string) error {
+	var id string
+	return tx.QueryRow("SELECT id FROM categories WHERE id = $1 FOR UPDATE", categoryID).Scan(&id)
+}
+
+// detachCategoryMember removes a member and closes the gap it leaves. It
+// reports whether the member was there.
+func detachCategoryMember(tx *sql.Tx, m categoryMembers, categoryID, memberID string) (bool, error) {
+	var position int
+	err := tx.QueryRow(fmt.Sprintf(
+		"DELETE FROM %s WHERE category_id = $1 AND %s = $2 RETURNING position", m.table, m.column,
+	), categoryID, memberID).Scan(&position)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	_, err = tx.Exec(fmt.Sprintf(
+		"UPDATE %s SET position = position - 1 WHERE category_id = $1 AND position > $2", m.table,
+	), categoryID, position)
+	return true, err
+}
+
+func (s *PostgresStore) addCategoryMember(m categoryMembers, categoryID, memberID string, position *int) error {
+	tx, err := s.Db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := lockCategory(tx, categoryID); err != nil {
+		return err
+	}
+	if _, err := detachCategoryMember(tx, m, categoryID, memberID); err != nil {
+		return err
+	}
+	var count int
+	if err := tx.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE category_id = $1", m.table), categoryID).Scan(&count); err != nil {
+		return err
+	}
+	at := count
+	if position != nil {
+		at = min(max(*position, 0), count)
+	}
+	_, err = tx.Exec(fmt.Sprintf(
+		"UPDATE %s SET position = position + 1 WHERE category_id = $1 AND position >= $2", m.table,
+	), categoryID, at)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(fmt.Sprintf(
+		"INSERT INTO %s (category_id, %s, position) VALUES ($1, $2, $3)", m.table, m.column,
+	), categoryID, memberID, at)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *PostgresStore) removeCategoryMember(m categoryMembers, categoryID, memberID string) error {
+	tx, err := s.Db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := lockCategory(tx, categoryID); err != nil {
+		return err
+	}
+	found, err := detachCategoryMember(tx, m, categoryID, memberID)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return sql.ErrNoRows
+	}
+	return tx.Commit()
+}
+
+func (s *PostgresStore) replaceCategoryMembers(m categoryMembers, categoryID string, memberIDs []string) error {
+	tx, err := s.Db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := lockCategory(tx, categoryID); err != nil {
+		return err
+	}
+	_, err = tx.Exec(fmt.Sprintf(
+		"DELETE FROM %s WHERE category_id = $1 AND NOT (%s::text = ANY($2))", m.table, m.column,
+	), categoryID, pq.Array(memberIDs))
+	if err != nil {
+		return err
+	}
+	// Members that stay keep when they were added; only their position changes.
+	_, err = tx.Exec(fmt.Sprintf(`
+		INSERT INTO %[1]s (category_id, %[2]s, position)
+		SELECT $1, u.id::uuid, u.ord - 1 FROM unnest($2::text[]) WITH ORDINALITY AS u(id, ord)
+		ON CONFLICT (category_id, %[2]s) DO UPDATE SET position = EXCLUDED.position`, m.table, m.column,
+	), categoryID, pq.Array(memberIDs))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
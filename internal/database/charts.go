@@ -0,0 +1,285 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	ChartDaily    = "daily"
+	ChartWeekly   = "weekly"
+	ChartTrending = "trending"
+
+	ChartScopeGlobal = "global"
+)
+
+// ChartRanking is one song's place in a chart scope before it is saved.
+type ChartRanking struct {
+	Scope    string
+	SongID   string
+	Plays    int64
+	Position int
+}
+
+type ChartEntry struct {
+	Position         int   `json:"position"`
+	PreviousPosition *int  `json:"previous_position"`
+	Plays            int64 `json:"plays"`
+	Song             Song  `json:"song"`
+}
+
+type Chart struct {
+	ID          string       `json:"id"`
+	Type        string       `json:"type"`
+	Scope       string       `json:"scope"`
+	PeriodStart time.Time    `json:"period_start"`
+	PeriodEnd   time.Time    `json:"period_end"`
+	GeneratedAt time.Time    `json:"generated_at"`
+	Entries     []ChartEntry `json:"entries"`
+}
+
+// ChartSummary describes the latest snapshot of a chart without its entries.
+type ChartSummary struct {
+	ID          string    `json:"id"`
+	Type        string    `json:"type"`
+	Scope       string    `json:"scope"`
+	PeriodStart time.Time `json:"period_start"`
+	PeriodEnd   time.Time `json:"period_end"`
+}
+
+// previousPeriodStart returns where the period before the one starting at
+// periodStart began. Trending charts cover a sliding day and move every hour.
+func previousPeriodStart(chartType string, periodStart time.Time) time.Time {
+	switch chartType {
+	case ChartDaily:
+		return periodStart.AddDate(0, 0, -1)
+	case ChartWeekly:
+		return periodStart.AddDate(0, 0, -7)
+	}
+	return periodStart.Add(-time.Hour)
+}
+
+// ChartID names the chart of a type in a scope.
+func ChartID(chartType, scope string) string {
+	return chartType + "-" + scope
+}
+
+// chartPlaysCTE counts qualifying plays per song and listener country. Plays
+// are attributed to the country on the listener's account.
+const chartPlaysCTE = `
+	SELECT pe.song_id, u.country,
+		COUNT(*) FILTER (WHERE pe.started_at >= $2) AS recent,
+		COUNT(*) FILTER (WHERE pe.started_at < $2) AS earlier
+	FROM play_events pe
+	INNER JOIN users u ON u.id = pe.user_id
+	INNER JOIN songs s ON s.id = pe.song_id
+	WHERE pe.started_at >= $1 AND pe.started_at < $3 AND pe.ms_played >= $4
+		AND s.deleted_at IS NULL AND s.available
+	GROUP BY pe.song_id, u.country`
+
+// GetChartRankings ranks songs by plays in [start, end), globally and per
+// country, keeping the top size of each scope.
+func (s *PostgresStore) GetChartRankings(start, end time.Time, minMsPlayed, size int) ([]ChartRanking, error) {
+	return s.queryChartRankings(`
+		WITH plays AS (`+chartPlaysCTE+`),
+		scoped AS (
+			SELECT 'global' AS scope, song_id, SUM(recent) AS plays FROM plays GROUP BY song_id
+			UNION ALL
+			SELECT lower(country), song_id, recent FROM plays WHERE country <> ''
+		),
+		ranked AS (
+			SELECT scope, song_id, plays, ROW_NUMBER() OVER (PARTITION BY scope ORDER BY plays DESC, song_id) AS position
+			FROM scoped
+		)
+		SELECT scope, song_id, plays, position FROM ranked WHERE position <= $5 ORDER BY scope, position`,
+		start, start, end, minMsPlayed, size,
+	)
+}
+
+// GetTrendingRankings ranks songs by play velocity: plays in [recentStart,
+// end) against their daily average over [baselineStart, recentStart). The
+// smoothing term keeps songs with almost no history from dominating, and
+// songs need minRecent plays to qualify at all.
+func (s *PostgresStore) GetTrendingRankings(baselineStart, recentStart, end time.Time, minMsPlayed, minRecent int, smoothing float64, size int) ([]ChartRanking, error) {
+	baselineDays := recentStart.Sub(baselineStart).Hours() / 24
+	return s.queryChartRankings(`
+		WITH plays AS (`+chartPlaysCTE+`),
+		scoped AS (
+			SELECT 'global' AS scope, song_id, SUM(recent) AS recent, SUM(earlier) AS earlier FROM plays GROUP BY song_id
+			UNION ALL
+			SELECT lower(country), song_id, recent, earlier FROM plays WHERE country <> ''
+		),
+		ranked AS (
+			SELECT scope, song_id, recent, ROW_NUMBER() OVER (
+				PARTITION BY scope
+				ORDER BY recent / (earlier / $7::float8 + $8::float8) DESC, recent DESC, song_id
+			) AS position
+			FROM scoped
+			WHERE recent >= $6
+		)
+		SELECT scope, song_id, recent, position FROM ranked WHERE position <= $5 ORDER BY scope, position`,
+		baselineStart, recentStart, end, minMsPlayed, size, minRecent, baselineDays, smoothing,
+	)
+}
+
+func (s *PostgresStore) queryChartRankings(query string, args ...interface{}) ([]ChartRanking, error) {
+	rows, err := s.Db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var rankings []ChartRanking
+	for rows.Next() {
+		var r ChartRanking
+		if err := rows.Scan(&r.Scope, &r.SongID, &r.Plays, &r.Position); err != nil {
+			return nil, err
+		}
+		rankings = append(rankings, r)
+	}
+	return rankings, rows.Err()
+}
+
+// HasChartSnapshot reports whether charts of a type were already generated
+// for the period starting at periodStart.
+func (s *PostgresStore) HasChartSnapshot(chartType string, periodStart time.Time) (bool, error) {
+	var exists bool
+	err := s.Db.QueryRow(
+		"SELECT EXISTS (SELECT 1 FROM chart_snapshots WHERE chart_type = $1 AND period_start = $2)",
+		chartType, periodStart,
+	).Scan(&exists)
+	return exists, err
+}
+
+// SaveChartSnapshots stores the charts of every scope for one period in one
+// transaction. A global chart is always stored, even when empty, so the period
+// counts as generated. Previous positions come from each chart's snapshot of
+// the period right before; when that one was never generated they are left
+// empty rather than compared with an older chart.
+func (s *PostgresStore) SaveChartSnapshots(chartType string, periodStart, periodEnd time.Time, rankings []ChartRanking) error {
+	byScope := map[string][]ChartRanking{ChartScopeGlobal: nil}
+	for _, r := range rankings {
+		byScope[r.Scope] = append(byScope[r.Scope], r)
+	}
+
+	tx, err := s.Db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for scope, entries := range byScope {
+		chartID := ChartID(chartType, scope)
+		var snapshotID string
+		err := tx.QueryRow(`
+			INSERT INTO chart_snapshots (chart_id, chart_type, scope, period_start, period_end)
+			VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (chart_id, period_start) DO NOTHING
+			RETURNING id`,
+			chartID, chartType, scope, periodStart, periodEnd,
+		).Scan(&snapshotID)
+		if err == sql.ErrNoRows {
+			// Another run already stored this chart.
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			continue
+		}
+		songIDs := make([]string, len(entries))
+		plays := make([]int64, len(entries))
+		positions := make([]int64, len(entries))
+		for i, e := range entries {
+			songIDs[i], plays[i], positions[i] = e.SongID, e.Plays, int64(e.Position)
+		}
+		_, err = tx.Exec(`
+			INSERT INTO chart_entries (snapshot_id, position, song_id, plays, previous_position)
+			SELECT $1, u.position, u.song_id::uuid, u.plays, (
+				SELECT pe.position
+				FROM chart_entries pe
+				INNER JOIN chart_snapshots p ON p.id = pe.snapshot_id
+				WHERE pe.song_id = u.song_id::uuid AND p.chart_id = $2 AND p.period_start = $3
+			)
+			FROM unnest($4::text[], $5::bigint[], $6::integer[]) AS u(song_id, plays, position)`,
+			snapshotID, chartID, previousPeriodStart(chartType, periodStart), pq.Array(songIDs), pq.Array(plays), pq.Array(positions),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// DeleteChartSnapshotsBefore removes snapshots of a type older than before.
+func (s *PostgresStore) DeleteChartSnapshotsBefore(chartType string, before time.Time) error {
+	_, err := s.Db.Exec("DELETE FROM chart_snapshots WHERE chart_type = $1 AND period_start < $2", chartType, before)
+	return err
+}
+
+// GetChart returns the snapshot of a chart for the latest period generated
+// for its type, or sql.ErrNoRows when the chart has none, e.g. a country
+// without plays in that period, instead of an older one. Songs removed from
+// the catalog since are left out; the remaining entries keep their positions.
+func (s *PostgresStore) GetChart(chartID, userID string) (*Chart, error) {
+	var chart Chart
+	var snapshotID string
+	err := s.Db.QueryRow(`
+		SELECT c.id, c.chart_id, c.chart_type, c.scope, c.period_start, c.period_end, c.generated_at
+		FROM chart_snapshots c
+		WHERE c.chart_id = $1 AND c.period_start = (
+			SELECT MAX(p.period_start) FROM chart_snapshots p WHERE p.chart_type = c.chart_type
+		)`, chartID,
+	).Scan(&snapshotID, &chart.ID, &chart.Type, &chart.Scope, &chart.PeriodStart, &chart.PeriodEnd, &chart.GeneratedAt)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.Db.Query(`
+		SELECT e.position, e.previous_position, e.plays,
+			s.id, s.title, s.artist, s.image_url, s.loudness_lufs, s.track_peak, s.replay_gain_db,
+			EXISTS (SELECT 1 FROM liked_songs l WHERE l.user_id = $2 AND l.song_id = s.id)
+		FROM chart_entries e
+		INNER JOIN songs s ON s.id = e.song_id
+		WHERE e.snapshot_id = $1 AND s.deleted_at IS NULL AND s.available
+		ORDER BY e.position`, snapshotID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	chart.Entries = make([]ChartEntry, 0)
+	for rows.Next() {
+		var e ChartEntry
+		if err := rows.Scan(&e.Position, &e.PreviousPosition, &e.Plays,
+			&e.Song.ID, &e.Song.Title, &e.Song.Artist, &e.Song.ImageURL, &e.Song.LoudnessLUFS, &e.Song.TrackPeak, &e.Song.ReplayGainDB, &e.Song.Liked); err != nil {
+			return nil, err
+		}
+		chart.Entries = append(chart.Entries, e)
+	}
+	return &chart, rows.Err()
+}
+
+// ListCharts returns the charts that have a snapshot for the latest period
+// generated for their type, global charts first.
+func (s *PostgresStore) ListCharts() ([]ChartSummary, error) {
+	rows, err := s.Db.Query(`
+		SELECT c.chart_id, c.chart_type, c.scope, c.period_start, c.period_end
+		FROM chart_snapshots c
+		WHERE c.period_start = (
+			SELECT MAX(p.period_start) FROM chart_snapshots p WHERE p.chart_type = c.chart_type
+		)
+		ORDER BY c.scope <> 'global', c.scope, c.chart_type`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	charts := make([]ChartSummary, 0)
+	for rows.Next() {
+		var c ChartSummary
+		if err := rows.Scan(&c.ID, &c.Type, &c.Scope, &c.PeriodStart, &c.PeriodEnd); err != nil {
+			return nil, err
+		}
+		charts = append(charts, c)
+	}
+	return charts, rows.Err()
+}
@@ -0,0 +1,62 @@
+package database
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+type Page[T any] struct {
+	Items      []T    `json:"items"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// Time cursors point just past the last item of a page ordered by a
+// timestamp descending, with the item ID breaking ties.
+func encodeTimeCursor(t time.Time, id string) string {
+	raw := t.UTC().Format(time.RFC3339Nano) + "|" + id
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeTimeCursor(cursor string) (time.Time, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+	ts, id, found := strings.Cut(string(raw), "|")
+	if !found || id == "" {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+	t, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+	return t, id, nil
+}
+
+// Position cursors point just past the last item of a page ordered by a
+// position ascending, with the item ID breaking ties.
+func encodePositionCursor(position int, id string) string {
+	raw := strconv.Itoa(position) + "|" + id
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodePositionCursor(cursor string) (int, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, "", ErrInvalidCursor
+	}
+	pos, id, found := strings.Cut(string(raw), "|")
+	if !found || id == "" {
+		return 0, "", ErrInvalidCursor
+	}
+	position, err := strconv.Atoi(pos)
+	if err != nil {
+		return 0, "", ErrInvalidCursor
+	}
+	return position, id, nil
+}
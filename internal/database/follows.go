@@ -0,0 +1,169 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+)
+
+// SystemUserID owns generated playlists such as the weekly release radar.
+const SystemUserID = "00000000-0000-0000-0000-000000000001"
+
+const ReleaseRadarKind = "release_radar"
+
+type FollowedArtist struct {
+	Artist
+	FollowedAt time.Time `json:"followed_at"`
+}
+
+func (s *PostgresStore) FollowArtist(userID, artistID string) error {
+	_, err := s.Db.Exec(
+		"INSERT INTO artist_follows (user_id, artist_id) VALUES ($1, $2) ON CONFLICT DO NOTHING",
+		userID, artistID,
+	)
+	return err
+}
+
+func (s *PostgresStore) UnfollowArtist(userID, artistID string) error {
+	_, err := s.Db.Exec("DELETE FROM artist_follows WHERE user_id = $1 AND artist_id::text = $2", userID, artistID)
+	return err
+}
+
+func (s *PostgresStore) GetFollowedArtists(userID, cursor string, limit int) (*Page[FollowedArtist], error) {
+	var afterTime sql.NullTime
+	var afterArtistID sql.NullString
+	if cursor != "" {
+		t, artistID, err := decodeTimeCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		afterTime = sql.NullTime{Time: t, Valid: true}
+		afterArtistID = sql.NullString{String: artistID, Valid: true}
+	}
+
+	rows, err := s.Db.Query(`
+		SELECT a.id, a.name, a.image_url, a.bio,
+			(SELECT COUNT(*) FROM artist_follows c WHERE c.artist_id = a.id),
+			f.followed_at
+		FROM artist_follows f
+		INNER JOIN artists a ON a.id = f.artist_id
+		WHERE f.user_id = $1
+			AND ($2::timestamptz IS NULL OR (f.followed_at, f.artist_id::text) < ($2, $3))
+		ORDER BY f.followed_at DESC, f.artist_id::text DESC
+		LIMIT $4`,
+		userID, afterTime, afterArtistID, limit+1,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	page := &Page[FollowedArtist]{Items: make([]FollowedArtist, 0, limit)}
+	for rows.Next() {
+		artist := FollowedArtist{Artist: Artist{Following: true}}
+		if err := rows.Scan(&artist.ID, &artist.Name, &artist.ImageURL, &artist.Bio, &artist.FollowerCount, &artist.FollowedAt); err != nil {
+			return nil, err
+		}
+		page.Items = append(page.Items, artist)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(page.Items) > limit {
+		page.Items = page.Items[:limit]
+		last := page.Items[limit-1]
+		page.NextCursor = encodeTimeCursor(last.FollowedAt, last.ID)
+	}
+	return page, nil
+}
+
+// GetUserIDsWithStaleReleaseRadar returns the users who follow at least one
+// artist and whose release radar was not generated since the given time.
+func (s *PostgresStore) GetUserIDsWithStaleReleaseRadar(since time.Time) ([]string, error) {
+	rows, err := s.Db.Query(`
+		SELECT DISTINCT f.user_id
+		FROM artist_follows f
+		WHERE NOT EXISTS (
+			SELECT 1 FROM playlists p
+			WHERE p.kind = $1 AND p.generated_for = f.user_id AND p.generated_at >= $2
+		)`, ReleaseRadarKind, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// GetNewReleaseSongIDs returns songs from albums released since the given
+// time on which an artist the user follows is credited, newest first.
+func (s *PostgresStore) GetNewReleaseSongIDs(userID string, since time.Time, limit int) ([]string, error) {
+	rows, err := s.Db.Query(`
+		SELECT s.id
+		FROM songs s
+		INNER JOIN albums al ON al.id = s.album_id
+		WHERE al.release_date >= $2::date AND s.deleted_at IS NULL AND s.available
+			AND EXISTS (
+				SELECT 1
+				FROM song_artists sa
+				INNER JOIN artist_follows f ON f.artist_id = sa.artist_id
+				WHERE sa.song_id = s.id AND f.user_id = $1 AND sa.role IN ('primary', 'featured')
+			)
+		ORDER BY al.release_date DESC, al.id, s.disc_number, s.track_number NULLS LAST
+		LIMIT $3`,
+		userID, since, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// ReplaceReleaseRadar creates or refreshes the system-owned release radar
+// playlist of a user with the given songs, in order.
+func (s *PostgresStore) ReplaceReleaseRadar(userID string, songIDs []string, generatedAt time.Time) error {
+	tx, err := s.Db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var playlistID string
+	err = tx.QueryRow(`
+		INSERT INTO playlists (name, owner_id, kind, generated_for, generated_at)
+		VALUES ('Release Radar', $1, $2, $3, $4)
+		ON CONFLICT (kind, generated_for) WHERE kind <> 'user'
+		DO UPDATE SET generated_at = EXCLUDED.generated_at, updated_at = NOW(), version = playlists.version + 1
+		RETURNING id`,
+		SystemUserID, ReleaseRadarKind, userID, generatedAt,
+	).Scan(&playlistID)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM playlist_songs WHERE playlist_id = $1", playlistID); err != nil {
+		return err
+	}
+	for i, songID := range songIDs {
+		_, err := tx.Exec(
+			"INSERT INTO playlist_songs (playlist_id, song_id, position, added_at) VALUES ($1, $2, $3, $4)",
+			playlistID, songID, i, generatedAt,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
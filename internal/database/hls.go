@@ -0,0 +1,149 @@
+package database
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// HLSPackage is the segmented form of one rendition. Packages whose Error is
+// set failed and are not retried until the rendition's file changes, unless
+// RetryLater marks the failure as a storage error worth retrying.
+type HLSPackage struct {
+	SongID           string
+	Quality          string
+	SourceKey        string
+	KeyPrefix        string
+	BitrateKbps      int
+	SampleRate       int
+	Channels         int
+	SegmentDurations []float64
+	Error            string
+	RetryLater       bool
+	PackagedAt       time.Time
+}
+
+type PendingRendition struct {
+	SongID string
+	Rendition
+}
+
+// GetUnpackagedRenditions returns MP3 renditions that have no package for
+// their current file, or whose last attempt failed on storage and is due for
+// a retry. Other formats cannot be segmented without transcoding and are never
+// packaged.
+func (s *PostgresStore) GetUnpackagedRenditions(limit int) ([]PendingRendition, error) {
+	rows, err := s.Db.Query(`
+		SELECT r.song_id, r.quality, r.audio_key, r.audio_format, r.bitrate_kbps
+		FROM song_renditions r
+		LEFT JOIN hls_packages p ON p.song_id = r.song_id AND p.quality = r.quality
+		WHERE r.audio_format = 'mp3'
+			AND (p.song_id IS NULL OR p.source_key <> r.audio_key OR p.retry_at <= NOW())
+		ORDER BY p.retry_at NULLS FIRST, r.created_at
+		LIMIT $1`,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pending []PendingRendition
+	for rows.Next() {
+		var p PendingRendition
+		if err := rows.Scan(&p.SongID, &p.Quality, &p.AudioKey, &p.AudioFormat, &p.BitrateKbps); err != nil {
+			return nil, err
+		}
+		pending = append(pending, p)
+	}
+	return pending, rows.Err()
+}
+
+// SaveHLSPackage stores a package and returns the one it replaced, if any, so
+// its segments can be deleted. A package that is to be retried later waits an
+// hour after its first failed attempt, twice as long after every further one,
+// up to a day.
+func (s *PostgresStore) SaveHLSPackage(p *HLSPackage) (*HLSPackage, error) {
+	tx, err := s.Db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	previous := &HLSPackage{}
+	var durations pq.Float64Array
+	err = tx.QueryRow(`
+		SELECT song_id, quality, source_key, key_prefix, segment_durations
+		FROM hls_packages
+		WHERE song_id = $1 AND quality = $2
+		FOR UPDATE`,
+		p.SongID, p.Quality,
+	).Scan(&previous.SongID, &previous.Quality, &previous.SourceKey, &previous.KeyPrefix, &durations)
+	if err != nil {
+		previous = nil
+	} else {
+		previous.SegmentDurations = durations
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO hls_packages (song_id, quality, source_key, key_prefix, bitrate_kbps, sample_rate,
+			channels, segment_durations, error, packaged_at, attempts, retry_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NOW(),
+			CASE WHEN $10 THEN 1 ELSE 0 END,
+			CASE WHEN $10 THEN NOW() + INTERVAL '1 hour' END)
+		ON CONFLICT (song_id, quality) DO UPDATE
+		SET source_key = EXCLUDED.source_key, key_prefix = EXCLUDED.key_prefix,
+			bitrate_kbps = EXCLUDED.bitrate_kbps, sample_rate = EXCLUDED.sample_rate,
+			channels = EXCLUDED.channels, segment_durations = EXCLUDED.segment_durations,
+			error = EXCLUDED.error, packaged_at = NOW(),
+			attempts = CASE
+				WHEN NOT $10 THEN 0
+				WHEN hls_packages.source_key = EXCLUDED.source_key THEN hls_packages.attempts + 1
+				ELSE 1
+			END,
+			retry_at = CASE WHEN $10 THEN NOW() + LEAST(
+				INTERVAL '1 hour' * power(2, CASE
+					WHEN hls_packages.source_key = EXCLUDED.source_key THEN LEAST(hls_packages.attempts, 5)
+					ELSE 0
+				END),
+				INTERVAL '1 day'
+			) END`,
+		p.SongID, p.Quality, p.SourceKey, p.KeyPrefix, p.BitrateKbps, p.SampleRate,
+		p.Channels, pq.Float64Array(p.SegmentDurations), p.Error, p.RetryLater,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return previous, tx.Commit()
+}
+
+// GetHLSPackages returns the successfully packaged renditions of a song that
+// are still up to date with their source file.
+func (s *PostgresStore) GetHLSPackages(songID string) ([]HLSPackage, error) {
+	rows, err := s.Db.Query(`
+		SELECT p.song_id, p.quality, p.source_key, p.key_prefix, p.bitrate_kbps, p.sample_rate,
+			p.channels, p.segment_durations, p.packaged_at
+		FROM hls_packages p
+		INNER JOIN song_renditions r ON r.song_id = p.song_id AND r.quality = p.quality AND r.audio_key = p.source_key
+		WHERE p.song_id = $1 AND p.error = ''
+		ORDER BY p.bitrate_kbps`,
+		songID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var packages []HLSPackage
+	for rows.Next() {
+		var p HLSPackage
+		var durations pq.Float64Array
+		if err := rows.Scan(&p.SongID, &p.Quality, &p.SourceKey, &p.KeyPrefix, &p.BitrateKbps, &p.SampleRate,
+			&p.Channels, &durations, &p.PackagedAt); err != nil {
+			return nil, err
+		}
+		p.SegmentDurations = durations
+		packages = append(packages, p)
+	}
+	return packages, rows.Err()
+}
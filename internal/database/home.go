@@ -0,0 +1,351 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	ShelfRecentlyPlayed = "recently_played"
+	ShelfMadeForYou     = "made_for_you"
+	ShelfNewReleases    = "new_releases"
+	ShelfPlaylists      = "playlists"
+	ShelfChart          = "chart"
+	ShelfCategories     = "categories"
+)
+
+const (
+	TierAll     = "all"
+	TierFree    = "free"
+	TierPremium = "premium"
+)
+
+const maxShelfLimit = 50
+
+var ErrShelfOrderMismatch = errors.New("shelf_ids must list every shelf exactly once")
+
+var (
+	shelfKinds = map[string]bool{
+		ShelfRecentlyPlayed: true, ShelfMadeForYou: true, ShelfNewReleases: true,
+		ShelfPlaylists: true, ShelfChart: true, ShelfCategories: true,
+	}
+	shelfTiers     = map[string]bool{TierAll: true, TierFree: true, TierPremium: true}
+	countryPattern = regexp.MustCompile(`^[A-Z]{2}$`)
+)
+
+// HomeShelfInput is everything an editor can set on a home shelf.
+type HomeShelfInput struct {
+	Kind      string   `json:"kind"`
+	Title     string   `json:"title"`
+	Countries []string `json:"countries"`
+	Tier      string   `json:"tier"`
+	ItemIDs   []string `json:"item_ids"`
+	Limit     int      `json:"limit"`
+	Enabled   *bool    `json:"enabled"`
+}
+
+type HomeShelfConfig struct {
+	ID        string    `json:"id"`
+	Position  int       `json:"position"`
+	Kind      string    `json:"kind"`
+	Title     string    `json:"title"`
+	Countries []string  `json:"countries"`
+	Tier      string    `json:"tier"`
+	ItemIDs   []string  `json:"item_ids"`
+	Limit     int       `json:"limit"`
+	Enabled   bool      `json:"enabled"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// NormalizeCountry returns the canonical form of a country code.
+func NormalizeCountry(country string) string {
+	return strings.ToUpper(strings.TrimSpace(country))
+}
+
+// ValidCountry reports whether country is an ISO 3166-1 alpha-2 code.
+func ValidCountry(country string) bool {
+	return countryPattern.MatchString(country)
+}
+
+// Normalize trims the input and fills in defaults.
+func (in *HomeShelfInput) Normalize() {
+	in.Kind = strings.ToLower(strings.TrimSpace(in.Kind))
+	in.Title = strings.TrimSpace(in.Title)
+	in.Tier = strings.ToLower(strings.TrimSpace(in.Tier))
+	if in.Tier == "" {
+		in.Tier = TierAll
+	}
+	if in.Limit == 0 {
+		in.Limit = 10
+	}
+	countries := make([]string, 0, len(in.Countries))
+	for _, country := range in.Countries {
+		countries = append(countries, NormalizeCountry(country))
+	}
+	in.Countries = countries
+	itemIDs := make([]string, 0, len(in.ItemIDs))
+	for _, id := range in.ItemIDs {
+		if id = strings.TrimSpace(id); id != "" {
+			itemIDs = append(itemIDs, id)
+		}
+	}
+	in.ItemIDs = itemIDs
+}
+
+func (in *HomeShelfInput) Validate() error {
+	var errs ValidationErrors
+	if !shelfKinds[in.Kind] {
+		errs = append(errs, "kind must be recently_played, made_for_you, new_releases, playlists, chart or categories")
+	}
+	if in.Title == "" {
+		errs = append(errs, "title is required")
+	}
+	if !shelfTiers[in.Tier] {
+		errs = append(errs, "tier must be all, free or premium")
+	}
+	for _, country := range in.Countries {
+		if !ValidCountry(country) {
+			errs = append(errs, fmt.Sprintf("country %q is not an ISO 3166-1 alpha-2 code", country))
+		}
+	}
+	if in.Limit < 1 || in.Limit > maxShelfLimit {
+		errs = append(errs, fmt.Sprintf("limit must be between 1 and %d", maxShelfLimit))
+	}
+	switch in.Kind {
+	case ShelfPlaylists:
+		if len(in.ItemIDs) == 0 {
+			errs = append(errs, "item_ids must list the playlists of a playlists shelf")
+		}
+	case ShelfChart:
+		if len(in.ItemIDs) > 1 {
+			errs = append(errs, "item_ids of a chart shelf holds at most one chart ID")
+		}
+	case ShelfCategories:
+	default:
+		if len(in.ItemIDs) > 0 {
+			errs = append(errs, "item_ids is only used by playlists, chart and categories shelves")
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+const homeShelfColumns = `id, position, kind, title, countries, tier, item_ids, item_limit, enabled, created_at, updated_at`
+
+func scanHomeShelf(row rowScanner) (*HomeShelfConfig, error) {
+	var shelf HomeShelfConfig
+	if err := row.Scan(&shelf.ID, &shelf.Position, &shelf.Kind, &shelf.Title, pq.Array(&shelf.Countries), &shelf.Tier,
+		pq.Array(&shelf.ItemIDs), &shelf.Limit, &shelf.Enabled, &shelf.CreatedAt, &shelf.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if shelf.Countries == nil {
+		shelf.Countries = []string{}
+	}
+	if shelf.ItemIDs == nil {
+		shelf.ItemIDs = []string{}
+	}
+	return &shelf, nil
+}
+
+func (s *PostgresStore) queryHomeShelves(query string, args ...interface{}) ([]HomeShelfConfig, error) {
+	rows, err := s.Db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	shelves := make([]HomeShelfConfig, 0)
+	for rows.Next() {
+		shelf, err := scanHomeShelf(rows)
+		if err != nil {
+			return nil, err
+		}
+		shelves = append(shelves, *shelf)
+	}
+	return shelves, rows.Err()
+}
+
+// ListHomeShelves returns every shelf, including disabled ones, in order.
+func (s *PostgresStore) ListHomeShelves() ([]HomeShelfConfig, error) {
+	return s.queryHomeShelves("SELECT " + homeShelfColumns + " FROM home_shelves ORDER BY position, id")
+}
+
+// GetHomeShelvesFor returns the enabled shelves that target a listener in
+// country with the given subscription, in order.
+func (s *PostgresStore) GetHomeShelvesFor(country string, subscribed bool) ([]HomeShelfConfig, error) {
+	tier := TierFree
+	if subscribed {
+		tier = TierPremium
+	}
+	return s.queryHomeShelves(`
+		SELECT `+homeShelfColumns+`
+		FROM home_shelves
+		WHERE enabled AND (cardinality(countries) = 0 OR $1 = ANY(countries)) AND tier IN ('all', $2)
+		ORDER BY position, id`,
+		country, tier,
+	)
+}
+
+func (s *PostgresStore) GetHomeShelf(id string) (*HomeShelfConfig, error) {
+	return scanHomeShelf(s.Db.QueryRow("SELECT "+homeShelfColumns+" FROM home_shelves WHERE id = $1", id))
+}
+
+// CreateHomeShelf adds a shelf at the bottom of the home screen.
+// Playlists shelves may only list public playlists.
+func (s *PostgresStore) CreateHomeShelf(in *HomeShelfInput) (*HomeShelfConfig, error) {
+	if in.Kind == ShelfPlaylists {
+		if err := checkCuratedPlaylists(s.Db, in.ItemIDs); err != nil {
+			return nil, err
+		}
+	}
+	enabled := in.Enabled == nil || *in.Enabled
+	return scanHomeShelf(s.Db.QueryRow(`
+		INSERT INTO home_shelves (position, kind, title, countries, tier, item_ids, item_limit, enabled)
+		SELECT COALESCE(MAX(position) + 1, 0), $1, $2, $3, $4, $5, $6, $7 FROM home_shelves
+		RETURNING `+homeShelfColumns,
+		in.Kind, in.Title, pq.Array(in.Countries), in.Tier, pq.Array(in.ItemIDs), in.Limit, enabled,
+	))
+}
+
+func (s *PostgresStore) UpdateHomeShelf(id string, in *HomeShelfInput) (*HomeShelfConfig, error) {
+	if in.Kind == ShelfPlaylists {
+		if err := checkCuratedPlaylists(s.Db, in.ItemIDs); err != nil {
+			return nil, err
+		}
+	}
+	return scanHomeShelf(s.Db.QueryRow(`
+		UPDATE home_shelves
+		SET kind = $2, title = $3, countries = $4, tier = $5, item_ids = $6, item_limit = $7,
+			enabled = COALESCE($8, enabled), updated_at = NOW()
+		WHERE id = $1
+		RETURNING `+homeShelfColumns,
+		id, in.Kind, in.Title, pq.Array(in.Countries), in.Tier, pq.Array(in.ItemIDs), in.Limit, in.Enabled,
+	))
+}
+
+// DeleteHomeShelf removes a shelf and closes the gap it leaves.
+func (s *PostgresStore) DeleteHomeShelf(id string) error {
+	tx, err := s.Db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var position int
+	if err := tx.QueryRow("DELETE FROM home_shelves WHERE id = $1 RETURNING position", id).Scan(&position); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE home_shelves SET position = position - 1 WHERE position > $1", position); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ReorderHomeShelves puts the shelves in the order of ids, which must list
+// every shelf exactly once.
+func (s *PostgresStore) ReorderHomeShelves(ids []string) ([]HomeShelfConfig, error) {
+	tx, err := s.Db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("LOCK TABLE home_shelves IN SHARE ROW EXCLUSIVE MODE"); err != nil {
+		return nil, err
+	}
+	var matching, total int
+	err = tx.QueryRow(`
+		SELECT COUNT(*) FILTER (WHERE id::text = ANY($1)), COUNT(*) FROM home_shelves`,
+		pq.Array(ids),
+	).Scan(&matching, &total)
+	if err != nil {
+		return nil, err
+	}
+	if matching != total || len(ids) != total {
+		return nil, ErrShelfOrderMismatch
+	}
+	_, err = tx.Exec(`
+		UPDATE home_shelves h SET position = u.ord - 1, updated_at = NOW()
+		FROM unnest($1::text[]) WITH ORDINALITY AS u(id, ord)
+		WHERE h.id::text = u.id`,
+		pq.Array(ids),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.ListHomeShelves()
+}
+
+// GetNewReleases returns songs released since the given date, newest first.
+// Songs without their own release date use their album's.
+func (s *PostgresStore) GetNewReleases(userID string, since time.Time, limit int) ([]Song, error) {
+	return s.querySongs(`
+		SELECT s.id, s.title, s.artist, s.image_url, s.loudness_lufs, s.track_peak, s.replay_gain_db,
+			EXISTS (SELECT 1 FROM liked_songs l WHERE l.user_id = $1 AND l.song_id = s.id)
+		FROM songs s
+		LEFT JOIN albums al ON al.id = s.album_id
+		WHERE COALESCE(s.release_date, al.release_date) >= $2::date AND s.deleted_at IS NULL AND s.available
+		ORDER BY COALESCE(s.release_date, al.release_date) DESC, s.created_at DESC, s.id
+		LIMIT $3`,
+		userID, since, limit,
+	)
+}
+
+// GetPlaylistsByIDs returns the public playlists with the given IDs in that
+// order, skipping ones that do not exist or are not public.
+func (s *PostgresStore) GetPlaylistsByIDs(ids []string) ([]Playlist, error) {
+	rows, err := s.Db.Query(`
+		SELECT `+playlistColumns("NULL")+`
+		FROM unnest($1::text[]) WITH ORDINALITY AS u(id, ord)
+		INNER JOIN playlists p ON p.id::text = u.id AND p.visibility = 'public'
+		ORDER BY u.ord`, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	return scanPlaylists(rows)
+}
+
+// GetCategoriesByIDs returns the categories with the given IDs in that order,
+// skipping ones that do not exist.
+func (s *PostgresStore) GetCategoriesByIDs(ids []string) ([]Category, error) {
+	rows, err := s.Db.Query(`
+		SELECT c.id, c.name, c.image_url
+		FROM unnest($1::text[]) WITH ORDINALITY AS u(id, ord)
+		INNER JOIN categories c ON c.id::text = u.id
+		ORDER BY u.ord`, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	categories := make([]Category, 0)
+	for rows.Next() {
+		var c Category
+		if err := rows.Scan(&c.ID, &c.Name, &c.ImageURL); err != nil {
+			return nil, err
+		}
+		categories = append(categories, c)
+	}
+	return categories, rows.Err()
+}
+
+func (s *PostgresStore) SetUserCountry(userID, country string) error {
+	res, err := s.Db.Exec("UPDATE users SET country = $2 WHERE id = $1", userID, country)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
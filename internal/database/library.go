@@ -0,0 +1,100 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type LikedSong struct {
+	Song
+	LikedAt time.Time `json:"liked_at"`
+}
+
+func (s *PostgresStore) LikeSong(userID, songID string) error {
+	_, err := s.Db.Exec(
+		"INSERT INTO liked_songs (user_id, song_id) VALUES ($1, $2) ON CONFLICT DO NOTHING",
+		userID, songID,
+	)
+	return err
+}
+
+func (s *PostgresStore) UnlikeSong(userID, songID string) error {
+	_, err := s.Db.Exec("DELETE FROM liked_songs WHERE user_id = $1 AND song_id::text = $2", userID, songID)
+	return err
+}
+
+func (s *PostgresStore) GetLikedSongs(userID, cursor string, limit int) (*Page[LikedSong], error) {
+	var afterTime sql.NullTime
+	var afterSongID sql.NullString
+	if cursor != "" {
+		t, songID, err := decodeTimeCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		afterTime = sql.NullTime{Time: t, Valid: true}
+		afterSongID = sql.NullString{String: songID, Valid: true}
+	}
+
+	rows, err := s.Db.Query(`
+		SELECT s.id, s.title, s.artist, s.image_url, s.loudness_lufs, s.track_peak, s.replay_gain_db, l.liked_at
+		FROM liked_songs l
+		INNER JOIN songs s ON s.id = l.song_id
+		WHERE l.user_id = $1 AND s.deleted_at IS NULL
+			AND ($2::timestamptz IS NULL OR (l.liked_at, l.song_id::text) < ($2, $3))
+		ORDER BY l.liked_at DESC, l.song_id::text DESC
+		LIMIT $4`,
+		userID, afterTime, afterSongID, limit+1,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	page := &Page[LikedSong]{Items: make([]LikedSong, 0, limit)}
+	for rows.Next() {
+		song := LikedSong{Song: Song{Liked: true}}
+		if err := rows.Scan(&song.ID, &song.Title, &song.Artist, &song.ImageURL, &song.LoudnessLUFS, &song.TrackPeak, &song.ReplayGainDB, &song.LikedAt); err != nil {
+			return nil, err
+		}
+		page.Items = append(page.Items, song)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(page.Items) > limit {
+		page.Items = page.Items[:limit]
+		last := page.Items[limit-1]
+		page.NextCursor = encodeTimeCursor(last.LikedAt, last.ID)
+	}
+	return page, nil
+}
+
+// LibraryContains reports, in order, whether each of the given songs is in
+// the user's liked songs.
+func (s *PostgresStore) LibraryContains(userID string, songIDs []string) ([]bool, error) {
+	rows, err := s.Db.Query(
+		"SELECT song_id::text FROM liked_songs WHERE user_id = $1 AND song_id::text = ANY($2)",
+		userID, pq.Array(songIDs),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	liked := make(map[string]bool)
+	for rows.Next() {
+		var songID string
+		if err := rows.Scan(&songID); err != nil {
+			return nil, err
+		}
+		liked[songID] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	contains := make([]bool, len(songIDs))
+	for i, id := range songIDs {
+		contains[i] = liked[id]
+	}
+	return contains, nil
+}
@@ -0,0 +1,160 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var ErrOfflineLimitReached = errors.New("offline download limit reached")
+
+// OfflineLicense allows one device to keep one song for offline playback
+// until ExpiresAt. Status is "active", "expired", or "revoked" when the song
+// was taken out of the catalog.
+type OfflineLicense struct {
+	ID          string     `json:"id"`
+	DeviceID    string     `json:"device_id"`
+	Song        Song       `json:"song"`
+	IssuedAt    time.Time  `json:"issued_at"`
+	RenewedAt   *time.Time `json:"renewed_at"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	Status      string     `json:"status"`
+	DownloadURL string     `json:"download_url,omitempty"`
+}
+
+// offlineLicenseRetention is how long expired licenses are still listed, so
+// devices that were offline for a while learn to delete their downloads.
+const offlineLicenseRetention = "90 days"
+
+const offlineLicenseColumns = `o.id, o.device_id, s.id, s.title, s.artist, s.image_url, s.loudness_lufs, s.track_peak, s.replay_gain_db,
+	EXISTS (SELECT 1 FROM liked_songs l WHERE l.user_id = o.user_id AND l.song_id = s.id),
+	o.issued_at, o.renewed_at, o.expires_at,
+	CASE
+		WHEN s.deleted_at IS NOT NULL OR NOT s.available THEN 'revoked'
+		WHEN o.expires_at <= NOW() THEN 'expired'
+		ELSE 'active'
+	END`
+
+func scanOfflineLicense(row rowScanner) (*OfflineLicense, error) {
+	var l OfflineLicense
+	err := row.Scan(&l.ID, &l.DeviceID, &l.Song.ID, &l.Song.Title, &l.Song.Artist, &l.Song.ImageURL,
+		&l.Song.LoudnessLUFS, &l.Song.TrackPeak, &l.Song.ReplayGainDB, &l.Song.Liked, &l.IssuedAt, &l.RenewedAt, &l.ExpiresAt, &l.Status)
+	if err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// GrantOfflineLicense licenses a song on a device until expiresAt. Granting a
+// song the device already holds extends its license. The account may hold at
+// most maxActive active licenses across all its devices.
+func (s *PostgresStore) GrantOfflineLicense(userID, songID, deviceID string, expiresAt time.Time, maxActive int) (*OfflineLicense, error) {
+	tx, err := s.Db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Locking the user serialises grants, so concurrent requests from
+	// several devices cannot overshoot the cap.
+	if _, err := tx.Exec("SELECT 1 FROM users WHERE id = $1 FOR UPDATE", userID); err != nil {
+		return nil, err
+	}
+	var active int
+	err = tx.QueryRow(`
+		SELECT COUNT(*)
+		FROM offline_licenses o
+		INNER JOIN songs s ON s.id = o.song_id
+		WHERE o.user_id = $1 AND o.expires_at > NOW() AND s.deleted_at IS NULL AND s.available
+			AND NOT (o.device_id = $2 AND o.song_id = $3)`,
+		userID, deviceID, songID,
+	).Scan(&active)
+	if err != nil {
+		return nil, err
+	}
+	if active >= maxActive {
+		return nil, ErrOfflineLimitReached
+	}
+
+	var licenseID string
+	err = tx.QueryRow(`
+		INSERT INTO offline_licenses (user_id, song_id, device_id, expires_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, device_id, song_id) DO UPDATE
+		SET expires_at = EXCLUDED.expires_at, renewed_at = NOW()
+		RETURNING id`,
+		userID, songID, deviceID, expiresAt,
+	).Scan(&licenseID)
+	if err != nil {
+		return nil, err
+	}
+	license, err := scanOfflineLicense(tx.QueryRow(`
+		SELECT `+offlineLicenseColumns+`
+		FROM offline_licenses o
+		INNER JOIN songs s ON s.id = o.song_id
+		WHERE o.id = $1`,
+		licenseID,
+	))
+	if err != nil {
+		return nil, err
+	}
+	return license, tx.Commit()
+}
+
+// RenewOfflineLicenses extends every active license of a device until
+// expiresAt. Expired licenses stay expired; their songs have to be granted
+// again, which counts against the cap.
+func (s *PostgresStore) RenewOfflineLicenses(userID, deviceID string, expiresAt time.Time) error {
+	_, err := s.Db.Exec(`
+		UPDATE offline_licenses o
+		SET expires_at = $3, renewed_at = NOW()
+		FROM songs s
+		WHERE s.id = o.song_id AND o.user_id = $1 AND o.device_id = $2 AND o.expires_at > NOW()
+			AND s.deleted_at IS NULL AND s.available`,
+		userID, deviceID, expiresAt,
+	)
+	return err
+}
+
+// GetOfflineLicenses lists the licenses of a user, of one device when
+// deviceID is set, including recently expired and revoked ones.
+func (s *PostgresStore) GetOfflineLicenses(userID, deviceID string) ([]OfflineLicense, error) {
+	rows, err := s.Db.Query(`
+		SELECT `+offlineLicenseColumns+`
+		FROM offline_licenses o
+		INNER JOIN songs s ON s.id = o.song_id
+		WHERE o.user_id = $1 AND ($2 = '' OR o.device_id = $2)
+			AND o.expires_at > NOW() - INTERVAL '`+offlineLicenseRetention+`'
+		ORDER BY o.issued_at DESC, o.id`,
+		userID, deviceID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	licenses := []OfflineLicense{}
+	for rows.Next() {
+		license, err := scanOfflineLicense(rows)
+		if err != nil {
+			return nil, err
+		}
+		licenses = append(licenses, *license)
+	}
+	return licenses, rows.Err()
+}
+
+func (s *PostgresStore) RevokeOfflineLicense(userID, licenseID string) error {
+	res, err := s.Db.Exec("DELETE FROM offline_licenses WHERE id = $1 AND user_id = $2", licenseID, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
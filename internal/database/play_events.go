@@ -0,0 +1,185 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type PlayEvent struct {
+	ID          string    `json:"id"`
+	UserID      string    `json:"user_id"`
+	SongID      string    `json:"song_id"`
+	StartedAt   time.Time `json:"started_at"`
+	MsPlayed    int       `json:"ms_played"`
+	ContextType string    `json:"context_type"`
+	ContextID   string    `json:"context_id"`
+	Device      string    `json:"device"`
+}
+
+type PlayedSong struct {
+	Song
+	PlayedAt time.Time `json:"played_at"`
+}
+
+func (s *PostgresStore) CreatePlayEvent(e *PlayEvent) error {
+	return s.Db.QueryRow(`
+		INSERT INTO play_events (user_id, song_id, started_at, ms_played, context_type, context_id, device)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id`,
+		e.UserID, e.SongID, e.StartedAt, e.MsPlayed, e.ContextType, e.ContextID, e.Device,
+	).Scan(&e.ID)
+}
+
+// RollUpPlayCounts adds the plays that started before until and have not been
+// counted yet to songs.play_count. Runs from several servers take turns on
+// the rollup row, so no play is counted twice.
+func (s *PostgresStore) RollUpPlayCounts(until time.Time) error {
+	tx, err := s.Db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var from time.Time
+	if err := tx.QueryRow("SELECT rolled_up_to FROM play_count_rollup FOR UPDATE").Scan(&from); err != nil {
+		return err
+	}
+	if !until.After(from) {
+		return nil
+	}
+	_, err = tx.Exec(`
+		UPDATE songs s
+		SET play_count = s.play_count + c.plays
+		FROM (
+			SELECT song_id, COUNT(*) AS plays
+			FROM play_events
+			WHERE started_at >= $1 AND started_at < $2
+			GROUP BY song_id
+		) c
+		WHERE s.id = c.song_id`,
+		from, until,
+	)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE play_count_rollup SET rolled_up_to = $1", until); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// EnsurePlayEventPartition creates the monthly partition of play_events that
+// covers month, if it does not exist yet. Plays of that month that already
+// landed in the default partition are moved into the new partition, since
+// Postgres refuses to add a partition whose rows sit in the default one.
+func (s *PostgresStore) EnsurePlayEventPartition(month time.Time) error {
+	start := time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 1, 0)
+	name := fmt.Sprintf("play_events_%04d_%02d", start.Year(), start.Month())
+
+	// Partitions usually exist already; only take the lock below when one
+	// has to be created.
+	var exists bool
+	if err := s.Db.QueryRow("SELECT to_regclass($1) IS NOT NULL", name).Scan(&exists); err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+
+	tx, err := s.Db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	// Keep new plays out of the default partition until the month has its
+	// own, and let concurrent servers wait for each other. The check is
+	// repeated in case another server created the partition meanwhile.
+	if _, err := tx.Exec("LOCK TABLE play_events_default IN ACCESS EXCLUSIVE MODE"); err != nil {
+		return err
+	}
+	if err := tx.QueryRow("SELECT to_regclass($1) IS NOT NULL", name).Scan(&exists); err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+	table := pq.QuoteIdentifier(name)
+	if _, err := tx.Exec(fmt.Sprintf(
+		"CREATE TABLE %s (LIKE play_events INCLUDING DEFAULTS INCLUDING CONSTRAINTS)", table,
+	)); err != nil {
+		return err
+	}
+	_, err = tx.Exec(fmt.Sprintf(`
+		WITH moved AS (
+			DELETE FROM play_events_default WHERE started_at >= $1 AND started_at < $2 RETURNING *
+		)
+		INSERT INTO %s SELECT * FROM moved`, table,
+	), start, end)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(fmt.Sprintf(
+		"ALTER TABLE play_events ATTACH PARTITION %s FOR VALUES FROM (%s) TO (%s)",
+		table,
+		pq.QuoteLiteral(start.Format(time.RFC3339)),
+		pq.QuoteLiteral(end.Format(time.RFC3339)),
+	))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *PostgresStore) GetRecentlyPlayed(userID, cursor string, limit int) (*Page[PlayedSong], error) {
+	var afterTime sql.NullTime
+	var afterSongID sql.NullString
+	if cursor != "" {
+		t, songID, err := decodeTimeCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		afterTime = sql.NullTime{Time: t, Valid: true}
+		afterSongID = sql.NullString{String: songID, Valid: true}
+	}
+
+	rows, err := s.Db.Query(`
+		SELECT s.id, s.title, s.artist, s.image_url, s.loudness_lufs, s.track_peak, s.replay_gain_db,
+			EXISTS (SELECT 1 FROM liked_songs l WHERE l.user_id = $1 AND l.song_id = s.id),
+			r.played_at
+		FROM (
+			SELECT song_id, MAX(started_at) AS played_at
+			FROM play_events
+			WHERE user_id = $1
+			GROUP BY song_id
+		) r
+		INNER JOIN songs s ON s.id = r.song_id
+		WHERE $2::timestamptz IS NULL OR (r.played_at, r.song_id::text) < ($2, $3)
+		ORDER BY r.played_at DESC, r.song_id::text DESC
+		LIMIT $4`,
+		userID, afterTime, afterSongID, limit+1,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	page := &Page[PlayedSong]{Items: make([]PlayedSong, 0, limit)}
+	for rows.Next() {
+		var song PlayedSong
+		if err := rows.Scan(&song.ID, &song.Title, &song.Artist, &song.ImageURL, &song.LoudnessLUFS, &song.TrackPeak, &song.ReplayGainDB, &song.Liked, &song.PlayedAt); err != nil {
+			return nil, err
+		}
+		page.Items = append(page.Items, song)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(page.Items) > limit {
+		page.Items = page.Items[:limit]
+		last := page.Items[limit-1]
+		page.NextCursor = encodeTimeCursor(last.PlayedAt, last.ID)
+	}
+	return page, nil
+}
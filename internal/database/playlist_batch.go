@@ -0,0 +1,247 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// MaxPlaylistBatch bounds how many songs or entries one batch edit takes.
+const MaxPlaylistBatch = 100
+
+const (
+	BatchAdded       = "added"
+	BatchDuplicate   = "duplicate"
+	BatchUnknownSong = "unknown_song"
+	BatchRemoved     = "removed"
+	BatchNotFound    = "not_found"
+)
+
+// PlaylistBatchAdd adds songs, in order, at Position or at the end when it
+// is nil. With SkipDuplicates, songs already in the playlist or earlier in
+// the batch are skipped.
+type PlaylistBatchAdd struct {
+	SongIDs        []string `json:"song_ids"`
+	Position       *int     `json:"position"`
+	SnapshotID     string   `json:"snapshot_id"`
+	SkipDuplicates bool     `json:"skip_duplicates"`
+}
+
+type PlaylistBatchRemove struct {
+	EntryIDs   []string `json:"entry_ids"`
+	SnapshotID string   `json:"snapshot_id"`
+}
+
+// PlaylistBatchItem reports what happened to one song or entry of a batch.
+// EntryID is the new entry of an added song.
+type PlaylistBatchItem struct {
+	SongID  string `json:"song_id,omitempty"`
+	EntryID string `json:"entry_id,omitempty"`
+	Status  string `json:"status"`
+}
+
+type PlaylistBatchResult struct {
+	SnapshotID string              `json:"snapshot_id"`
+	Results    []PlaylistBatchItem `json:"results"`
+}
+
+// Normalize lowercases IDs the way Postgres prints UUIDs, since batches
+// compare them as text.
+func (in *PlaylistBatchAdd) Normalize() {
+	for i := range in.SongIDs {
+		in.SongIDs[i] = strings.ToLower(strings.TrimSpace(in.SongIDs[i]))
+	}
+	in.SnapshotID = strings.TrimSpace(in.SnapshotID)
+}
+
+func (in *PlaylistBatchAdd) Validate() error {
+	return validateBatchIDs("song_ids", in.SongIDs)
+}
+
+func (in *PlaylistBatchRemove) Normalize() {
+	for i := range in.EntryIDs {
+		in.EntryIDs[i] = strings.ToLower(strings.TrimSpace(in.EntryIDs[i]))
+	}
+	in.SnapshotID = strings.TrimSpace(in.SnapshotID)
+}
+
+func (in *PlaylistBatchRemove) Validate() error {
+	return validateBatchIDs("entry_ids", in.EntryIDs)
+}
+
+func validateBatchIDs(field string, ids []string) error {
+	var errs ValidationErrors
+	if len(ids) == 0 || len(ids) > MaxPlaylistBatch {
+		errs = append(errs, fmt.Sprintf("%s must list between 1 and %d IDs", field, MaxPlaylistBatch))
+	}
+	for i, id := range ids {
+		if id == "" {
+			errs = append(errs, fmt.Sprintf("%s[%d] is empty", field, i))
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// AddSongsToPlaylist adds a batch of songs in one transaction. Songs that do
+// not exist or are unavailable are reported as unknown instead of failing the
+// batch.
+func (s *PostgresStore) AddSongsToPlaylist(playlistID, userID string, in *PlaylistBatchAdd) (*PlaylistBatchResult, error) {
+	tx, err := s.Db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	if err := lockPlaylist(tx, playlistID, userID, in.SnapshotID); err != nil {
+		return nil, err
+	}
+	known, err := queryIDSet(tx,
+		"SELECT id::text FROM songs WHERE id::text = ANY($1) AND deleted_at IS NULL AND available", pq.Array(in.SongIDs))
+	if err != nil {
+		return nil, err
+	}
+	present := map[string]bool{}
+	if in.SkipDuplicates {
+		present, err = queryIDSet(tx, "SELECT song_id::text FROM playlist_songs WHERE playlist_id = $1", playlistID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	result := &PlaylistBatchResult{Results: make([]PlaylistBatchItem, len(in.SongIDs))}
+	var added []string
+	var addedAt []int
+	for i, songID := range in.SongIDs {
+		result.Results[i] = PlaylistBatchItem{SongID: songID}
+		switch {
+		case !known[songID]:
+			result.Results[i].Status = BatchUnknownSong
+		case present[songID]:
+			result.Results[i].Status = BatchDuplicate
+		default:
+			result.Results[i].Status = BatchAdded
+			if in.SkipDuplicates {
+				present[songID] = true
+			}
+			added = append(added, songID)
+			addedAt = append(addedAt, i)
+		}
+	}
+	if len(added) == 0 {
+		if result.SnapshotID, err = currentSnapshot(tx, playlistID); err != nil {
+			return nil, err
+		}
+		return result, tx.Commit()
+	}
+
+	var count int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM playlist_songs WHERE playlist_id = $1", playlistID).Scan(&count); err != nil {
+		return nil, err
+	}
+	at := count
+	if in.Position != nil {
+		at = min(max(*in.Position, 0), count)
+	}
+	_, err = tx.Exec(
+		"UPDATE playlist_songs SET position = position + $3 WHERE playlist_id = $1 AND position >= $2",
+		playlistID, at, len(added),
+	)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := tx.Query(`
+		INSERT INTO playlist_songs (playlist_id, song_id, position)
+		SELECT $1, u.id::uuid, $3 + u.ord - 1
+		FROM unnest($2::text[]) WITH ORDINALITY AS u(id, ord)
+		RETURNING id, position`,
+		playlistID, pq.Array(added), at,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var entryID string
+		var position int
+		if err := rows.Scan(&entryID, &position); err != nil {
+			return nil, err
+		}
+		result.Results[addedAt[position-at]].EntryID = entryID
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if result.SnapshotID, err = touchPlaylist(tx, playlistID); err != nil {
+		return nil, err
+	}
+	return result, tx.Commit()
+}
+
+// RemovePlaylistEntries removes a batch of entries in one transaction.
+// Entries that are not in the playlist are reported as not found.
+func (s *PostgresStore) RemovePlaylistEntries(playlistID, userID string, in *PlaylistBatchRemove) (*PlaylistBatchResult, error) {
+	tx, err := s.Db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	if err := lockPlaylist(tx, playlistID, userID, in.SnapshotID); err != nil {
+		return nil, err
+	}
+	removed, err := queryIDSet(tx,
+		"DELETE FROM playlist_songs WHERE playlist_id = $1 AND id::text = ANY($2) RETURNING id::text",
+		playlistID, pq.Array(in.EntryIDs))
+	if err != nil {
+		return nil, err
+	}
+	result := &PlaylistBatchResult{Results: make([]PlaylistBatchItem, len(in.EntryIDs))}
+	for i, entryID := range in.EntryIDs {
+		result.Results[i] = PlaylistBatchItem{EntryID: entryID, Status: BatchNotFound}
+		if removed[entryID] {
+			result.Results[i].Status = BatchRemoved
+		}
+	}
+	if len(removed) == 0 {
+		if result.SnapshotID, err = currentSnapshot(tx, playlistID); err != nil {
+			return nil, err
+		}
+		return result, tx.Commit()
+	}
+	if err := compactPlaylist(tx, playlistID); err != nil {
+		return nil, err
+	}
+	if result.SnapshotID, err = touchPlaylist(tx, playlistID); err != nil {
+		return nil, err
+	}
+	return result, tx.Commit()
+}
+
+func currentSnapshot(tx *sql.Tx, playlistID string) (string, error) {
+	var version int64
+	if err := tx.QueryRow("SELECT version FROM playlists WHERE id = $1", playlistID).Scan(&version); err != nil {
+		return "", err
+	}
+	return snapshotID(version), nil
+}
+
+// queryIDSet runs a query that returns one ID per row.
+func queryIDSet(tx *sql.Tx, query string, args ...interface{}) (map[string]bool, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := make(map[string]bool)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids[id] = true
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,472 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	maxPlaylistNameLength        = 100
+	maxPlaylistDescriptionLength = 300
+	maxPlaylistImageURLLength    = 2048
+)
+
+var (
+	ErrNotPlaylistOwner = errors.New("user does not own this playlist")
+	// ErrSnapshotMismatch means the playlist changed after the snapshot the
+	// client edited.
+	ErrSnapshotMismatch = errors.New("playlist has changed since the snapshot")
+	ErrPlaylistRange    = errors.New("range is outside the playlist")
+	ErrSongInPlaylist   = errors.New("song already in playlist")
+	// ErrSongNotFound means the song to add is deleted, unavailable or was
+	// never in the catalog.
+	ErrSongNotFound = errors.New("song not found")
+	// ErrPlaylistEntryNotFound keeps the message removals always failed with.
+	ErrPlaylistEntryNotFound = errors.New("song not found in playlist")
+)
+
+// PlaylistTrack is an entry of a playlist: a song at a position. A song can
+// have several entries. Positions count songs that were removed from the
+// catalog too, so they can skip numbers.
+type PlaylistTrack struct {
+	Song
+	EntryID  string    `json:"entry_id"`
+	Position int       `json:"position"`
+	AddedAt  time.Time `json:"added_at"`
+}
+
+const (
+	PlaylistPrivate  = "private"
+	PlaylistUnlisted = "unlisted"
+	PlaylistPublic   = "public"
+)
+
+var playlistVisibilities = map[string]bool{PlaylistPrivate: true, PlaylistUnlisted: true, PlaylistPublic: true}
+
+// playlistColumns selects a playlist aliased as p for scanPlaylist. The share
+// token is only selected when viewer, a query parameter or NULL, is the
+// owner. Song count and duration only include songs that are still in the
+// catalog.
+func playlistColumns(viewer string) string {
+	return `p.id, p.name, p.owner_id, p.description, p.image_url, p.updated_at, p.version, p.visibility,
+	CASE WHEN p.owner_id = ` + viewer + `::uuid THEN p.share_token ELSE '' END,` + playlistCounts
+}
+
+const playlistCounts = `
+	(SELECT COUNT(*) FROM playlist_songs ps INNER JOIN songs s ON s.id = ps.song_id
+		WHERE ps.playlist_id = p.id AND s.deleted_at IS NULL),
+	(SELECT COALESCE(SUM(s.duration_ms), 0) FROM playlist_songs ps INNER JOIN songs s ON s.id = ps.song_id
+		WHERE ps.playlist_id = p.id AND s.deleted_at IS NULL)`
+
+func scanPlaylist(row rowScanner) (*Playlist, error) {
+	var p Playlist
+	var version int64
+	if err := row.Scan(&p.ID, &p.Name, &p.OwnerID, &p.Description, &p.ImageURL, &p.UpdatedAt, &version,
+		&p.Visibility, &p.ShareToken, &p.SongCount, &p.DurationMs); err != nil {
+		return nil, err
+	}
+	p.SnapshotID = snapshotID(version)
+	return &p, nil
+}
+
+func scanPlaylists(rows *sql.Rows) ([]Playlist, error) {
+	defer rows.Close()
+	playlists := make([]Playlist, 0)
+	for rows.Next() {
+		p, err := scanPlaylist(rows)
+		if err != nil {
+			return nil, err
+		}
+		playlists = append(playlists, *p)
+	}
+	return playlists, rows.Err()
+}
+
+// PlaylistInput holds the details of a new playlist.
+type PlaylistInput struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	ImageURL    string `json:"imageUrl"`
+	Visibility  string `json:"visibility"`
+}
+
+// Normalize makes new playlists private unless asked otherwise.
+func (in *PlaylistInput) Normalize() {
+	in.Name = strings.TrimSpace(in.Name)
+	in.Description = strings.TrimSpace(in.Description)
+	in.ImageURL = strings.TrimSpace(in.ImageURL)
+	in.Visibility = strings.ToLower(strings.TrimSpace(in.Visibility))
+	if in.Visibility == "" {
+		in.Visibility = PlaylistPrivate
+	}
+}
+
+func (in *PlaylistInput) Validate() error {
+	errs := validatePlaylistName(nil, in.Name)
+	errs = validatePlaylistDescription(errs, in.Description)
+	errs = validatePlaylistImageURL(errs, in.ImageURL)
+	errs = validatePlaylistVisibility(errs, in.Visibility)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// PlaylistUpdate changes the details of a playlist. Nil fields are left as
+// they are.
+type PlaylistUpdate struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+	ImageURL    *string `json:"imageUrl"`
+	Visibility  *string `json:"visibility"`
+}
+
+func (in *PlaylistUpdate) Normalize() {
+	for _, field := range []*string{in.Name, in.Description, in.ImageURL, in.Visibility} {
+		if field != nil {
+			*field = strings.TrimSpace(*field)
+		}
+	}
+	if in.Visibility != nil {
+		*in.Visibility = strings.ToLower(*in.Visibility)
+	}
+}
+
+func (in *PlaylistUpdate) Validate() error {
+	var errs ValidationErrors
+	if in.Name == nil && in.Description == nil && in.ImageURL == nil && in.Visibility == nil {
+		errs = append(errs, "at least one of name, description, imageUrl and visibility is required")
+	}
+	if in.Name != nil {
+		errs = validatePlaylistName(errs, *in.Name)
+	}
+	if in.Description != nil {
+		errs = validatePlaylistDescription(errs, *in.Description)
+	}
+	if in.ImageURL != nil {
+		errs = validatePlaylistImageURL(errs, *in.ImageURL)
+	}
+	if in.Visibility != nil {
+		errs = validatePlaylistVisibility(errs, *in.Visibility)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func validatePlaylistName(errs ValidationErrors, name string) ValidationErrors {
+	switch {
+	case name == "":
+		errs = append(errs, "name is required")
+	case utf8.RuneCountInString(name) > maxPlaylistNameLength:
+		errs = append(errs, fmt.Sprintf("name must be at most %d characters", maxPlaylistNameLength))
+	case strings.ContainsFunc(name, func(r rune) bool { return r < ' ' || r == 0x7f }):
+		errs = append(errs, "name must not contain control characters")
+	}
+	return errs
+}
+
+func validatePlaylistDescription(errs ValidationErrors, description string) ValidationErrors {
+	if utf8.RuneCountInString(description) > maxPlaylistDescriptionLength {
+		errs = append(errs, fmt.Sprintf("description must be at most %d characters", maxPlaylistDescriptionLength))
+	}
+	return errs
+}
+
+// validatePlaylistImageURL accepts an empty cover or an absolute http(s) URL.
+func validatePlaylistImageURL(errs ValidationErrors, imageURL string) ValidationErrors {
+	if len(imageURL) > maxPlaylistImageURLLength {
+		return append(errs, fmt.Sprintf("imageUrl must be at most %d characters", maxPlaylistImageURLLength))
+	}
+	if imageURL == "" {
+		return errs
+	}
+	u, err := url.Parse(imageURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs = append(errs, "imageUrl must be an absolute http or https URL")
+	}
+	return errs
+}
+
+func validatePlaylistVisibility(errs ValidationErrors, visibility string) ValidationErrors {
+	if !playlistVisibilities[visibility] {
+		errs = append(errs, "visibility must be private, unlisted or public")
+	}
+	return errs
+}
+
+func snapshotID(version int64) string {
+	return strconv.FormatInt(version, 10)
+}
+
+// PlaylistMove moves RangeLength songs starting at RangeStart to before the
+// song at InsertBefore, counted in the playlist as it was before the move.
+// InsertBefore may be the length of the playlist to move songs to the end.
+type PlaylistMove struct {
+	RangeStart   int    `json:"range_start"`
+	RangeLength  int    `json:"range_length"`
+	InsertBefore int    `json:"insert_before"`
+	SnapshotID   string `json:"snapshot_id"`
+}
+
+// Normalize moves a single song when no range length is given.
+func (in *PlaylistMove) Normalize() {
+	if in.RangeLength == 0 {
+		in.RangeLength = 1
+	}
+	in.SnapshotID = strings.TrimSpace(in.SnapshotID)
+}
+
+func (in *PlaylistMove) Validate() error {
+	var errs ValidationErrors
+	if in.RangeStart < 0 {
+		errs = append(errs, "range_start must not be negative")
+	}
+	if in.RangeLength < 1 {
+		errs = append(errs, "range_length must be positive")
+	}
+	if in.InsertBefore < 0 {
+		errs = append(errs, "insert_before must not be negative")
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// lockPlaylist locks a playlist for an edit by its owner until the
+// transaction ends. It returns sql.ErrNoRows when the playlist does not
+// exist, ErrNotPlaylistOwner when userID does not own it, and
+// ErrSnapshotMismatch when snapshot is set and the playlist changed since.
+func lockPlaylist(tx *sql.Tx, playlistID, userID, snapshot string) error {
+	var ownerID string
+	var version int64
+	err := tx.QueryRow("SELECT owner_id, version FROM playlists WHERE id = $1 FOR UPDATE", playlistID).Scan(&ownerID, &version)
+	if err != nil {
+		return err
+	}
+	if ownerID != userID {
+		return ErrNotPlaylistOwner
+	}
+	if snapshot != "" && snapshot != snapshotID(version) {
+		return ErrSnapshotMismatch
+	}
+	return nil
+}
+
+// UpdatePlaylist changes the details of a playlist its owner edits.
+func (s *PostgresStore) UpdatePlaylist(playlistID, userID string, in *PlaylistUpdate) (*Playlist, error) {
+	tx, err := s.Db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	if err := lockPlaylist(tx, playlistID, userID, ""); err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(`
+		UPDATE playlists SET
+			name = COALESCE($2, name),
+			description = COALESCE($3, description),
+			image_url = COALESCE($4, image_url),
+			visibility = COALESCE($5, visibility),
+			updated_at = NOW(),
+			version = version + 1
+		WHERE id = $1`,
+		playlistID, in.Name, in.Description, in.ImageURL, in.Visibility,
+	)
+	if err != nil {
+		return nil, err
+	}
+	playlist, err := scanPlaylist(tx.QueryRow(
+		"SELECT "+playlistColumns("$2")+" FROM playlists p WHERE p.id = $1", playlistID, userID,
+	))
+	if err != nil {
+		return nil, err
+	}
+	return playlist, tx.Commit()
+}
+
+// RegenerateShareToken replaces the share token of a playlist, so links
+// with the old token stop working, and returns the new one.
+func (s *PostgresStore) RegenerateShareToken(playlistID, userID string) (string, error) {
+	tx, err := s.Db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+	if err := lockPlaylist(tx, playlistID, userID, ""); err != nil {
+		return "", err
+	}
+	var token string
+	err = tx.QueryRow(
+		"UPDATE playlists SET share_token = gen_random_uuid()::text WHERE id = $1 RETURNING share_token", playlistID,
+	).Scan(&token)
+	if err != nil {
+		return "", err
+	}
+	return token, tx.Commit()
+}
+
+// SearchPublicPlaylists finds public playlists by name or description.
+func (s *PostgresStore) SearchPublicPlaylists(query string, limit int) ([]Playlist, error) {
+	rows, err := s.Db.Query(`
+		SELECT `+playlistColumns("NULL")+` FROM playlists p
+		WHERE p.visibility = 'public' AND (p.name ILIKE $1 OR p.description ILIKE $1)
+		ORDER BY p.name ILIKE $1 DESC, p.updated_at DESC, p.id
+		LIMIT $2`,
+		"%"+query+"%", limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return scanPlaylists(rows)
+}
+
+// DeletePlaylist deletes a playlist its owner no longer wants, with its
+// songs and its place in categories.
+func (s *PostgresStore) DeletePlaylist(playlistID, userID string) error {
+	tx, err := s.Db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := lockPlaylist(tx, playlistID, userID, ""); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM playlist_songs WHERE playlist_id = $1", playlistID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM playlists WHERE id = $1", playlistID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ReorderPlaylist applies a move to a playlist and returns its new snapshot
+// ID. A move that leaves the order as it was still counts as a change.
+func (s *PostgresStore) ReorderPlaylist(playlistID, userID string, move *PlaylistMove) (string, error) {
+	tx, err := s.Db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+	if err := lockPlaylist(tx, playlistID, userID, move.SnapshotID); err != nil {
+		return "", err
+	}
+	var count int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM playlist_songs WHERE playlist_id = $1", playlistID).Scan(&count); err != nil {
+		return "", err
+	}
+	rangeEnd := move.RangeStart + move.RangeLength
+	if rangeEnd > count || move.InsertBefore > count {
+		return "", ErrPlaylistRange
+	}
+	// Songs between the range and its destination shift by the range length
+	// to make room, in the opposite direction of the move.
+	var shift int
+	var moveTo int
+	switch {
+	case move.InsertBefore < move.RangeStart:
+		moveTo, shift = move.InsertBefore, move.RangeLength
+	case move.InsertBefore > rangeEnd:
+		moveTo, shift = move.InsertBefore-move.RangeLength, -move.RangeLength
+	default:
+		moveTo = move.RangeStart
+	}
+	if moveTo != move.RangeStart {
+		_, err = tx.Exec(`
+			UPDATE playlist_songs SET position = CASE
+				WHEN position >= $2::int AND position < $3::int THEN position - $2::int + $4::int
+				ELSE position + $5::int
+			END
+			WHERE playlist_id = $1 AND position >= LEAST($2::int, $6::int) AND position < GREATEST($3::int, $6::int)`,
+			playlistID, move.RangeStart, rangeEnd, moveTo, shift, move.InsertBefore,
+		)
+		if err != nil {
+			return "", err
+		}
+	}
+	snapshot, err := touchPlaylist(tx, playlistID)
+	if err != nil {
+		return "", err
+	}
+	return snapshot, tx.Commit()
+}
+
+// RemovePlaylistEntry removes one entry of a playlist and returns the new
+// snapshot ID.
+func (s *PostgresStore) RemovePlaylistEntry(playlistID, entryID, userID, snapshot string) (string, error) {
+	return s.removePlaylistEntries(playlistID, userID, snapshot, "id = $2", entryID)
+}
+
+// RemovePlaylistPosition removes the entry at a position and returns the new
+// snapshot ID. Clients should send the snapshot the position was read from.
+func (s *PostgresStore) RemovePlaylistPosition(playlistID string, position int, userID, snapshot string) (string, error) {
+	return s.removePlaylistEntries(playlistID, userID, snapshot, "position = $2", position)
+}
+
+// removePlaylistEntries removes the entries matching condition, in which $1
+// is the playlist and $2 is arg, and closes the gaps they leave.
+func (s *PostgresStore) removePlaylistEntries(playlistID, userID, snapshot, condition string, arg interface{}) (string, error) {
+	tx, err := s.Db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+	if err := lockPlaylist(tx, playlistID, userID, snapshot); err != nil {
+		return "", err
+	}
+	res, err := tx.Exec("DELETE FROM playlist_songs WHERE playlist_id = $1 AND "+condition, playlistID, arg)
+	if err != nil {
+		return "", err
+	}
+	removed, err := res.RowsAffected()
+	if err != nil {
+		return "", err
+	}
+	if removed == 0 {
+		return "", ErrPlaylistEntryNotFound
+	}
+	if err := compactPlaylist(tx, playlistID); err != nil {
+		return "", err
+	}
+	snapshot, err = touchPlaylist(tx, playlistID)
+	if err != nil {
+		return "", err
+	}
+	return snapshot, tx.Commit()
+}
+
+// compactPlaylist renumbers the entries of a playlist from 0 after some were
+// removed, keeping their order.
+func compactPlaylist(tx *sql.Tx, playlistID string) error {
+	_, err := tx.Exec(`
+		UPDATE playlist_songs ps SET position = ranked.position
+		FROM (
+			SELECT id, ROW_NUMBER() OVER (ORDER BY position) - 1 AS position
+			FROM playlist_songs
+			WHERE playlist_id = $1
+		) ranked
+		WHERE ps.id = ranked.id AND ps.position <> ranked.position`, playlistID)
+	return err
+}
+
+// touchPlaylist marks a playlist as changed and returns its new snapshot ID.
+func touchPlaylist(tx *sql.Tx, playlistID string) (string, error) {
+	var version int64
+	err := tx.QueryRow(
+		"UPDATE playlists SET updated_at = NOW(), version = version + 1 WHERE id = $1 RETURNING version", playlistID,
+	).Scan(&version)
+	if err != nil {
+		return "", err
+	}
+	return snapshotID(version), nil
+}
@@ -2,7 +2,6 @@ package database
 
 import (
 	"database/sql"
-	"errors"
 	"log"
 	"time"
 
@@ -17,16 +16,25 @@ type LyricLine struct {
 }
 
 type Playlist struct {
-	ID      string `json:"id"`
-	Name    string `json:"name"`
-	OwnerID string `json:"owner_id"`
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	OwnerID     string    `json:"owner_id"`
+	Description string    `json:"description"`
+	ImageURL    string    `json:"imageUrl"`
+	SongCount   int       `json:"song_count"`
+	DurationMs  int64     `json:"duration_ms"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	// SnapshotID identifies this version of the playlist. Edits that send it
+	// fail if the playlist changed in the meantime.
+	SnapshotID string `json:"snapshot_id"`
+	Visibility string `json:"visibility"`
+	// ShareToken is only set for the owner.
+	ShareToken string `json:"share_token,omitempty"`
 }
 
 type PlaylistDetail struct {
-	ID      string `json:"id"`
-	Name    string `json:"name"`
-	OwnerID string `json:"owner_id"`
-	Songs   []Song `json:"songs"`
+	Playlist
+	Songs []PlaylistTrack `json:"songs"`
 }
 
 type Song struct {
@@ -34,7 +42,12 @@ type Song struct {
 	Title    string `json:"title"`
 	Artist   string `json:"artist"`
 	ImageURL string `json:"imageUrl"`
-	SongURL  string `json:"songUrl"`
+	Liked    bool   `json:"liked"`
+	// Loudness fields are nil until the song has been analysed; clients
+	// apply ReplayGainDB to normalise playback volume.
+	LoudnessLUFS *float64 `json:"loudness_lufs"`
+	TrackPeak    *float64 `json:"track_peak"`
+	ReplayGainDB *float64 `json:"replay_gain_db"`
 }
 
 type Category struct {
@@ -51,6 +64,8 @@ type User struct {
 	IsVerified            bool
 	SubscriptionStatus    string
 	SubscriptionExpiresAt sql.NullTime
+	IsAdmin               bool
+	Country               string
 }
 
 type PostgresStore struct {
@@ -73,9 +88,9 @@ func NewPostgresStore() (*PostgresStore, error) {
 func (s *PostgresStore) GetUserByID(id string) (*User, error) {
 	var user User
 	err := s.Db.QueryRow(
-		"SELECT id, name, email, password_hash, is_verified, subscription_status, subscription_expires_at FROM users WHERE id = $1",
+		"SELECT id, name, email, password_hash, is_verified, subscription_status, subscription_expires_at, is_admin, country FROM users WHERE id = $1",
 		id,
-	).Scan(&user.ID, &user.Name, &user.Email, &user.PasswordHash, &user.IsVerified, &user.SubscriptionStatus, &user.SubscriptionExpiresAt)
+	).Scan(&user.ID, &user.Name, &user.Email, &user.PasswordHash, &user.IsVerified, &user.SubscriptionStatus, &user.SubscriptionExpiresAt, &user.IsAdmin, &user.Country)
 	if err != nil {
 		return nil, err
 	}
@@ -85,9 +100,9 @@ func (s *PostgresStore) GetUserByID(id string) (*User, error) {
 func (s *PostgresStore) GetUserByEmail(email string) (*User, error) {
 	var user User
 	err := s.Db.QueryRow(
-		"SELECT id, name, email, password_hash, is_verified, subscription_status, subscription_expires_at FROM users WHERE email = $1",
+		"SELECT id, name, email, password_hash, is_verified, subscription_status, subscription_expires_at, is_admin, country FROM users WHERE email = $1",
 		email,
-	).Scan(&user.ID, &user.Name, &user.Email, &user.PasswordHash, &user.IsVerified, &user.SubscriptionStatus, &user.SubscriptionExpiresAt)
+	).Scan(&user.ID, &user.Name, &user.Email, &user.PasswordHash, &user.IsVerified, &user.SubscriptionStatus, &user.SubscriptionExpiresAt, &user.IsAdmin, &user.Country)
 	if err != nil {
 		return nil, err
 	}
@@ -112,13 +127,14 @@ func (s *PostgresStore) GetLyricsForSong(songID string) ([]LyricLine, error) {
 	return lyrics, nil
 }
 
-func (s *PostgresStore) SearchSongs(query string) ([]Song, error) {
+func (s *PostgresStore) SearchSongs(query, userID string) ([]Song, error) {
 	searchQuery := "%" + query + "%"
 	rows, err := s.Db.Query(`
-		SELECT id, title, artist, image_url, song_url
-		FROM songs
-		WHERE title ILIKE $1 OR artist ILIKE $1`,
-		searchQuery,
+		SELECT s.id, s.title, s.artist, s.image_url, s.loudness_lufs, s.track_peak, s.replay_gain_db,
+			EXISTS (SELECT 1 FROM liked_songs l WHERE l.user_id = $2 AND l.song_id = s.id)
+		FROM songs s
+		WHERE (s.title ILIKE $1 OR s.artist ILIKE $1) AND s.deleted_at IS NULL AND s.available`,
+		searchQuery, userID,
 	)
 	if err != nil {
 		return nil, err
@@ -127,7 +143,7 @@ func (s *PostgresStore) SearchSongs(query string) ([]Song, error) {
 	songs := make([]Song, 0)
 	for rows.Next() {
 		var song Song
-		if err := rows.Scan(&song.ID, &song.Title, &song.Artist, &song.ImageURL, &song.SongURL); err != nil {
+		if err := rows.Scan(&song.ID, &song.Title, &song.Artist, &song.ImageURL, &song.LoudnessLUFS, &song.TrackPeak, &song.ReplayGainDB, &song.Liked); err != nil {
 			return nil, err
 		}
 		songs = append(songs, song)
@@ -135,97 +151,147 @@ func (s *PostgresStore) SearchSongs(query string) ([]Song, error) {
 	return songs, nil
 }
 
-func (s *PostgresStore) RemoveSongFromPlaylist(playlistID, songID, userID string) error {
-	var ownerID string
-	err := s.Db.QueryRow("SELECT owner_id FROM playlists WHERE id = $1", playlistID).Scan(&ownerID)
+// RemoveSongFromPlaylist removes every entry of a song and closes the gaps
+// they leave. It returns the new snapshot ID of the playlist.
+func (s *PostgresStore) RemoveSongFromPlaylist(playlistID, songID, userID, snapshot string) (string, error) {
+	return s.removePlaylistEntries(playlistID, userID, snapshot, "song_id = $2", songID)
+}
+
+// AddSongToPlaylist inserts a song at position, or at the end when position
+// is nil or past the end, and returns the new entry's ID and the new snapshot
+// ID of the playlist. A song may be added more than once unless
+// skipDuplicates is set, in which case ErrSongInPlaylist is returned.
+func (s *PostgresStore) AddSongToPlaylist(playlistID, songID, userID string, position *int, snapshot string, skipDuplicates bool) (string, string, error) {
+	tx, err := s.Db.Begin()
 	if err != nil {
-		return err
+		return "", "", err
 	}
-	if ownerID != userID {
-		return errors.New("user does not own this playlist")
+	defer tx.Rollback()
+	if err := lockPlaylist(tx, playlistID, userID, snapshot); err != nil {
+		return "", "", err
 	}
-	res, err := s.Db.Exec("DELETE FROM playlist_songs WHERE playlist_id = $1 AND song_id = $2", playlistID, songID)
+	if _, err := uuid.Parse(songID); err != nil {
+		return "", "", ErrSongNotFound
+	}
+	var playable bool
+	err = tx.QueryRow(
+		"SELECT EXISTS (SELECT 1 FROM songs WHERE id = $1 AND deleted_at IS NULL AND available)", songID,
+	).Scan(&playable)
 	if err != nil {
-		return err
+		return "", "", err
+	}
+	if !playable {
+		return "", "", ErrSongNotFound
+	}
+	if skipDuplicates {
+		var exists bool
+		err := tx.QueryRow(
+			"SELECT EXISTS (SELECT 1 FROM playlist_songs WHERE playlist_id = $1 AND song_id = $2)", playlistID, songID,
+		).Scan(&exists)
+		if err != nil {
+			return "", "", err
+		}
+		if exists {
+			return "", "", ErrSongInPlaylist
+		}
 	}
-	rowsAffected, err := res.RowsAffected()
+	var count int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM playlist_songs WHERE playlist_id = $1", playlistID).Scan(&count); err != nil {
+		return "", "", err
+	}
+	at := count
+	if position != nil {
+		at = min(max(*position, 0), count)
+	}
+	if _, err := tx.Exec("UPDATE playlist_songs SET position = position + 1 WHERE playlist_id = $1 AND position >= $2", playlistID, at); err != nil {
+		return "", "", err
+	}
+	var entryID string
+	err = tx.QueryRow(
+		"INSERT INTO playlist_songs (playlist_id, song_id, position) VALUES ($1, $2, $3) RETURNING id", playlistID, songID, at,
+	).Scan(&entryID)
 	if err != nil {
-		return err
+		return "", "", err
 	}
-	if rowsAffected == 0 {
-		return errors.New("song not found in playlist")
+	snapshot, err = touchPlaylist(tx, playlistID)
+	if err != nil {
+		return "", "", err
 	}
-	return nil
+	return entryID, snapshot, tx.Commit()
 }
 
-func (s *PostgresStore) AddSongToPlaylist(playlistID, songID, userID string) error {
-	var ownerID string
-	err := s.Db.QueryRow("SELECT owner_id FROM playlists WHERE id = $1", playlistID).Scan(&ownerID)
+// GetPlaylistByID returns a playlist the user owns, was generated for, or
+// that is public.
+func (s *PostgresStore) GetPlaylistByID(playlistID, userID string) (*PlaylistDetail, error) {
+	playlist, err := scanPlaylist(s.Db.QueryRow(`
+		SELECT `+playlistColumns("$2")+` FROM playlists p
+		WHERE p.id = $1 AND (p.owner_id = $2 OR p.generated_for = $2 OR p.visibility = 'public')`,
+		playlistID, userID,
+	))
 	if err != nil {
-		return err
-	}
-	if ownerID != userID {
-		return errors.New("user does not own this playlist")
+		return nil, err
 	}
-	_, err = s.Db.Exec("INSERT INTO playlist_songs (playlist_id, song_id) VALUES ($1, $2)", playlistID, songID)
-	return err
+	return s.playlistDetail(playlist, userID)
 }
 
-func (s *PostgresStore) GetPlaylistByID(playlistID, userID string) (*PlaylistDetail, error) {
-	var p PlaylistDetail
-	err := s.Db.QueryRow("SELECT id, name, owner_id FROM playlists WHERE id = $1 AND owner_id = $2", playlistID, userID).Scan(&p.ID, &p.Name, &p.OwnerID)
+// GetSharedPlaylist returns the unlisted or public playlist a share token
+// belongs to.
+func (s *PostgresStore) GetSharedPlaylist(shareToken, userID string) (*PlaylistDetail, error) {
+	playlist, err := scanPlaylist(s.Db.QueryRow(`
+		SELECT `+playlistColumns("$2")+` FROM playlists p
+		WHERE p.share_token = $1 AND p.visibility IN ('unlisted', 'public')`,
+		shareToken, userID,
+	))
 	if err != nil {
 		return nil, err
 	}
+	return s.playlistDetail(playlist, userID)
+}
+
+func (s *PostgresStore) playlistDetail(playlist *Playlist, userID string) (*PlaylistDetail, error) {
+	p := PlaylistDetail{Playlist: *playlist}
 	rows, err := s.Db.Query(`
-		SELECT s.id, s.title, s.artist, s.image_url, s.song_url
+		SELECT s.id, s.title, s.artist, s.image_url, s.loudness_lufs, s.track_peak, s.replay_gain_db,
+			EXISTS (SELECT 1 FROM liked_songs l WHERE l.user_id = $2 AND l.song_id = s.id),
+			ps.id, ps.position, ps.added_at
 		FROM songs s
 		INNER JOIN playlist_songs ps ON s.id = ps.song_id
-		WHERE ps.playlist_id = $1
-		ORDER BY ps.added_at`, playlistID)
+		WHERE ps.playlist_id = $1 AND s.deleted_at IS NULL
+		ORDER BY ps.position`, playlist.ID, userID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	songs := make([]Song, 0)
+	tracks := make([]PlaylistTrack, 0)
 	for rows.Next() {
-		var song Song
-		if err := rows.Scan(&song.ID, &song.Title, &song.Artist, &song.ImageURL, &song.SongURL); err != nil {
+		var t PlaylistTrack
+		if err := rows.Scan(&t.ID, &t.Title, &t.Artist, &t.ImageURL, &t.LoudnessLUFS, &t.TrackPeak, &t.ReplayGainDB, &t.Liked,
+			&t.EntryID, &t.Position, &t.AddedAt); err != nil {
 			return nil, err
 		}
-		songs = append(songs, song)
+		tracks = append(tracks, t)
 	}
-	p.Songs = songs
-	return &p, nil
+	p.Songs = tracks
+	return &p, rows.Err()
 }
 
 func (s *PostgresStore) GetUserPlaylists(userID string) ([]Playlist, error) {
-	rows, err := s.Db.Query("SELECT id, name, owner_id FROM playlists WHERE owner_id = $1", userID)
+	rows, err := s.Db.Query(`
+		SELECT `+playlistColumns("$1")+` FROM playlists p
+		WHERE p.owner_id = $1 OR p.generated_for = $1
+		ORDER BY p.updated_at DESC, p.id`, userID)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-	var playlists []Playlist
-	for rows.Next() {
-		var p Playlist
-		if err := rows.Scan(&p.ID, &p.Name, &p.OwnerID); err != nil {
-			return nil, err
-		}
-		playlists = append(playlists, p)
-	}
-	return playlists, nil
+	return scanPlaylists(rows)
 }
 
-func (s *PostgresStore) CreatePlaylist(name, ownerID string) (*Playlist, error) {
-	var newPlaylist Playlist
-	err := s.Db.QueryRow(
-		"INSERT INTO playlists (name, owner_id) VALUES ($1, $2) RETURNING id, name, owner_id",
-		name, ownerID,
-	).Scan(&newPlaylist.ID, &newPlaylist.Name, &newPlaylist.OwnerID)
-	if err != nil {
-		return nil, err
-	}
-	return &newPlaylist, nil
+func (s *PostgresStore) CreatePlaylist(in *PlaylistInput, ownerID string) (*Playlist, error) {
+	return scanPlaylist(s.Db.QueryRow(`
+		INSERT INTO playlists (name, description, image_url, visibility, owner_id) VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, name, owner_id, description, image_url, updated_at, version, visibility, share_token, 0, 0`,
+		in.Name, in.Description, in.ImageURL, in.Visibility, ownerID,
+	))
 }
 
 func (s *PostgresStore) CreateUser(name, email, password string) (string, error) {
@@ -298,40 +364,6 @@ func (s *PostgresStore) ResetPassword(token, newPassword string) error {
 	return nil
 }
 
-func (s *PostgresStore) GetRecentlyPlayed() ([]Song, error) {
-	rows, err := s.Db.Query("SELECT id, title, artist, image_url, song_url FROM songs WHERE section = 'recently_played'")
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	var songs []Song
-	for rows.Next() {
-		var song Song
-		if err := rows.Scan(&song.ID, &song.Title, &song.Artist, &song.ImageURL, &song.SongURL); err != nil {
-			return nil, err
-		}
-		songs = append(songs, song)
-	}
-	return songs, nil
-}
-
-func (s *PostgresStore) GetMadeForYou() ([]Song, error) {
-	rows, err := s.Db.Query("SELECT id, title, artist, image_url, song_url FROM songs WHERE section = 'made_for_you'")
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	var songs []Song
-	for rows.Next() {
-		var song Song
-		if err := rows.Scan(&song.ID, &song.Title, &song.Artist, &song.ImageURL, &song.SongURL); err != nil {
-			return nil, err
-		}
-		songs = append(songs, song)
-	}
-	return songs, nil
-}
-
 func (s *PostgresStore) GetSearchCategories() ([]Category, error) {
 	rows, err := s.Db.Query("SELECT id, name, image_url FROM categories")
 	if err != nil {
@@ -0,0 +1,126 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// StationSeed is what a radio station is built around. Songs in Exclude are
+// never played, e.g. the playlist an autoplay station continues from.
+type StationSeed struct {
+	SongIDs   []string
+	ArtistIDs []string
+	Exclude   []string
+}
+
+// StationTrack is a song of a station with the sort key it was ranked by,
+// which pages of the station continue from.
+type StationTrack struct {
+	Song
+	Score    string
+	Tiebreak string
+}
+
+// GetStationTracks ranks songs for a station, most related to the seed first.
+// Relatedness adds up playlist co-occurrence with the seed songs, listening
+// similarity, shared artists and shared categories; the most played songs,
+// by the daily play count rollup, follow with a score of 0 so a station never
+// runs dry early. stationKey shuffles
+// equally ranked songs differently per station. Songs the user played since
+// excludeSince are skipped unless it is nil. Results start after the given
+// score and tiebreak when afterScore is not empty.
+func (s *PostgresStore) GetStationTracks(userID string, seed StationSeed, stationKey string, excludeSince *time.Time, afterScore, afterTiebreak string, limit int) ([]StationTrack, error) {
+	var since sql.NullTime
+	if excludeSince != nil {
+		since = sql.NullTime{Time: *excludeSince, Valid: true}
+	}
+	var score, tiebreak sql.NullString
+	if afterScore != "" {
+		score = sql.NullString{String: afterScore, Valid: true}
+		tiebreak = sql.NullString{String: afterTiebreak, Valid: true}
+	}
+	rows, err := s.Db.Query(`
+		WITH seed_songs AS (
+			SELECT unnest($1::text[])::uuid AS id
+		),
+		seed_artists AS (
+			SELECT unnest($2::text[])::uuid AS id
+			UNION
+			SELECT sa.artist_id FROM song_artists sa
+			WHERE sa.song_id IN (SELECT id FROM seed_songs) AND sa.role IN ('primary', 'featured')
+		),
+		seed_categories AS (
+			SELECT DISTINCT sc.category_id FROM song_categories sc
+			WHERE sc.song_id IN (SELECT id FROM seed_songs)
+				OR sc.song_id IN (
+					SELECT sa.song_id FROM song_artists sa
+					WHERE sa.artist_id IN (SELECT unnest($2::text[])::uuid) AND sa.role = 'primary'
+				)
+		),
+		scores AS (
+			SELECT other.song_id, 1.5 * LN(1 + COUNT(DISTINCT other.playlist_id)) AS score
+			FROM playlist_songs seed
+			INNER JOIN playlist_songs other ON other.playlist_id = seed.playlist_id AND other.song_id <> seed.song_id
+			WHERE seed.song_id IN (SELECT id FROM seed_songs)
+			GROUP BY other.song_id
+			UNION ALL
+			SELECT ss.similar_song_id, 3 * ss.score
+			FROM song_similarities ss
+			WHERE ss.song_id IN (SELECT id FROM seed_songs)
+			UNION ALL
+			SELECT DISTINCT sa.song_id, 2.0
+			FROM song_artists sa
+			WHERE sa.artist_id IN (SELECT id FROM seed_artists) AND sa.role IN ('primary', 'featured')
+			UNION ALL
+			SELECT sc.song_id, 0.5 * COUNT(*)
+			FROM song_categories sc
+			WHERE sc.category_id IN (SELECT category_id FROM seed_categories)
+			GROUP BY sc.song_id
+			UNION ALL
+			SELECT popular.id, 0
+			FROM (
+				SELECT ps.id FROM songs ps
+				WHERE ps.deleted_at IS NULL AND ps.available AND ps.play_count > 0
+				ORDER BY ps.play_count DESC
+				LIMIT 500
+			) popular
+		),
+		ranked AS (
+			SELECT song_id, ROUND(SUM(score)::numeric, 6) AS score, md5($3 || song_id::text) AS tiebreak
+			FROM scores
+			GROUP BY song_id
+		)
+		SELECT s.id, s.title, s.artist, s.image_url, s.loudness_lufs, s.track_peak, s.replay_gain_db,
+			EXISTS (SELECT 1 FROM liked_songs l WHERE l.user_id = $4 AND l.song_id = s.id),
+			r.score::text, r.tiebreak
+		FROM ranked r
+		INNER JOIN songs s ON s.id = r.song_id
+		WHERE s.deleted_at IS NULL AND s.available
+			AND s.id NOT IN (SELECT id FROM seed_songs)
+			AND NOT (s.id::text = ANY(COALESCE($5::text[], '{}')))
+			AND ($6::timestamptz IS NULL OR NOT EXISTS (
+				SELECT 1 FROM play_events pe WHERE pe.user_id = $4 AND pe.song_id = s.id AND pe.started_at >= $6
+			))
+			AND ($7::numeric IS NULL OR (r.score, r.tiebreak) < ($7::numeric, $8::text))
+		ORDER BY r.score DESC, r.tiebreak DESC
+		LIMIT $9`,
+		pq.Array(seed.SongIDs), pq.Array(seed.ArtistIDs), stationKey, userID, pq.Array(seed.Exclude),
+		since, score, tiebreak, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tracks := make([]StationTrack, 0, limit)
+	for rows.Next() {
+		var t StationTrack
+		if err := rows.Scan(&t.ID, &t.Title, &t.Artist, &t.ImageURL, &t.LoudnessLUFS, &t.TrackPeak, &t.ReplayGainDB, &t.Liked,
+			&t.Score, &t.Tiebreak); err != nil {
+			return nil, err
+		}
+		tracks = append(tracks, t)
+	}
+	return tracks, rows.Err()
+}
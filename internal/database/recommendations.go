@@ -0,0 +1,353 @@
+package database
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type Mix struct {
+	ID          string    `json:"id"`
+	Title       string    `json:"title"`
+	Explanation string    `json:"explanation"`
+	GeneratedAt time.Time `json:"generated_at"`
+	Songs       []MixSong `json:"songs"`
+}
+
+type MixSong struct {
+	Song
+	Reason string `json:"reason,omitempty"`
+}
+
+// SeedSong is a song the user has shown interest in, weighted by how strongly.
+type SeedSong struct {
+	SongID string
+	Title  string
+	Artist string
+	Weight float64
+}
+
+type SongNeighbor struct {
+	SongID string
+	Score  float64
+}
+
+// GetCooccurrenceBaskets returns groups of songs that belong together: every
+// playlist, every user's listening history since the given time, and every
+// user's liked songs.
+func (s *PostgresStore) GetCooccurrenceBaskets(since time.Time, minMsPlayed int) ([][]string, error) {
+	baskets, err := s.queryBaskets("SELECT DISTINCT playlist_id::text, song_id::text FROM playlist_songs ORDER BY 1")
+	if err != nil {
+		return nil, err
+	}
+	listening, err := s.queryBaskets(`
+		SELECT user_id::text, song_id::text
+		FROM play_events
+		WHERE started_at >= $1 AND ms_played >= $2
+		GROUP BY user_id, song_id
+		ORDER BY user_id`, since, minMsPlayed)
+	if err != nil {
+		return nil, err
+	}
+	likes, err := s.queryBaskets("SELECT user_id::text, song_id::text FROM liked_songs ORDER BY user_id")
+	if err != nil {
+		return nil, err
+	}
+	baskets = append(baskets, listening...)
+	return append(baskets, likes...), nil
+}
+
+func (s *PostgresStore) queryBaskets(query string, args ...interface{}) ([][]string, error) {
+	rows, err := s.Db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var baskets [][]string
+	var currentKey string
+	for rows.Next() {
+		var key, songID string
+		if err := rows.Scan(&key, &songID); err != nil {
+			return nil, err
+		}
+		if len(baskets) == 0 || key != currentKey {
+			baskets = append(baskets, nil)
+			currentKey = key
+		}
+		baskets[len(baskets)-1] = append(baskets[len(baskets)-1], songID)
+	}
+	return baskets, rows.Err()
+}
+
+func (s *PostgresStore) ReplaceSongSimilarities(neighbors map[string][]SongNeighbor) error {
+	tx, err := s.Db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("DELETE FROM song_similarities"); err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(pq.CopyIn("song_similarities", "song_id", "similar_song_id", "score"))
+	if err != nil {
+		return err
+	}
+	for songID, list := range neighbors {
+		for _, n := range list {
+			if _, err := stmt.Exec(songID, n.SongID, n.Score); err != nil {
+				stmt.Close()
+				return err
+			}
+		}
+	}
+	if _, err := stmt.Exec(); err != nil {
+		stmt.Close()
+		return err
+	}
+	if err := stmt.Close(); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *PostgresStore) GetSongNeighbors(songIDs []string) (map[string][]SongNeighbor, error) {
+	rows, err := s.Db.Query(`
+		SELECT ss.song_id::text, ss.similar_song_id::text, ss.score
+		FROM song_similarities ss
+		INNER JOIN songs s ON s.id = ss.similar_song_id
+		WHERE ss.song_id = ANY($1::uuid[]) AND s.deleted_at IS NULL AND s.available
+		ORDER BY ss.song_id, ss.score DESC`, pq.Array(songIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	neighbors := make(map[string][]SongNeighbor)
+	for rows.Next() {
+		var songID string
+		var n SongNeighbor
+		if err := rows.Scan(&songID, &n.SongID, &n.Score); err != nil {
+			return nil, err
+		}
+		neighbors[songID] = append(neighbors[songID], n)
+	}
+	return neighbors, rows.Err()
+}
+
+// GetUserSeeds returns the songs a user has listened to since the given time,
+// saved in one of their playlists or liked, strongest signal first.
+func (s *PostgresStore) GetUserSeeds(userID string, since time.Time, minMsPlayed, limit int) ([]SeedSong, error) {
+	rows, err := s.Db.Query(`
+		SELECT s.id, s.title, s.artist, SUM(w.weight) AS weight
+		FROM (
+			SELECT song_id, COUNT(*)::float8 AS weight
+			FROM play_events
+			WHERE user_id = $1 AND started_at >= $2 AND ms_played >= $3
+			GROUP BY song_id
+			UNION ALL
+			SELECT owned.song_id, 2.0
+			FROM (
+				SELECT DISTINCT ps.playlist_id, ps.song_id
+				FROM playlist_songs ps
+				INNER JOIN playlists p ON p.id = ps.playlist_id
+				WHERE p.owner_id = $1
+			) owned
+			UNION ALL
+			SELECT song_id, 3.0
+			FROM liked_songs
+			WHERE user_id = $1
+		) w
+		INNER JOIN songs s ON s.id = w.song_id
+		GROUP BY s.id, s.title, s.artist
+		ORDER BY weight DESC, s.id
+		LIMIT $4`,
+		userID, since, minMsPlayed, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var seeds []SeedSong
+	for rows.Next() {
+		var seed SeedSong
+		if err := rows.Scan(&seed.SongID, &seed.Title, &seed.Artist, &seed.Weight); err != nil {
+			return nil, err
+		}
+		seeds = append(seeds, seed)
+	}
+	return seeds, rows.Err()
+}
+
+// GetPopularSongIDs returns the most played songs since the given time,
+// optionally restricted to a category.
+func (s *PostgresStore) GetPopularSongIDs(since time.Time, categoryID string, limit int) ([]string, error) {
+	rows, err := s.Db.Query(`
+		SELECT s.id
+		FROM songs s
+		LEFT JOIN play_events pe ON pe.song_id = s.id AND pe.started_at >= $1
+		WHERE s.deleted_at IS NULL AND s.available AND ($2::text = '' OR EXISTS (
+			SELECT 1 FROM song_categories sc WHERE sc.song_id = s.id AND sc.category_id::text = $2
+		))
+		GROUP BY s.id
+		ORDER BY COUNT(pe.id) DESC, s.id
+		LIMIT $3`,
+		since, categoryID, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (s *PostgresStore) GetUserIDsForRecommendation() ([]string, error) {
+	rows, err := s.Db.Query("SELECT id FROM users WHERE is_verified = true")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (s *PostgresStore) GetUserCategories(userID string) ([]Category, error) {
+	rows, err := s.Db.Query(`
+		SELECT c.id, c.name, c.image_url
+		FROM categories c
+		INNER JOIN user_categories uc ON uc.category_id = c.id
+		WHERE uc.user_id = $1
+		ORDER BY uc.created_at`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	categories := make([]Category, 0)
+	for rows.Next() {
+		var category Category
+		if err := rows.Scan(&category.ID, &category.Name, &category.ImageURL); err != nil {
+			return nil, err
+		}
+		categories = append(categories, category)
+	}
+	return categories, rows.Err()
+}
+
+func (s *PostgresStore) SetUserCategories(userID string, categoryIDs []string) error {
+	tx, err := s.Db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("DELETE FROM user_categories WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+	for _, categoryID := range categoryIDs {
+		_, err := tx.Exec(
+			"INSERT INTO user_categories (user_id, category_id) VALUES ($1, $2) ON CONFLICT DO NOTHING",
+			userID, categoryID,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ReplaceUserMixes swaps the cached mixes of a user for a freshly computed
+// set, which may be empty. Only the song IDs and reasons of the given mixes
+// are used. Runs for
+// the same user, from a request and from the background job, take turns;
+// otherwise both could delete the old mixes and then both insert theirs.
+func (s *PostgresStore) ReplaceUserMixes(userID string, mixes []Mix) error {
+	tx, err := s.Db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext('user_mixes'), hashtext($1))", userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM user_mixes WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO user_mix_runs (user_id) VALUES ($1)
+		ON CONFLICT (user_id) DO UPDATE SET computed_at = NOW()`, userID)
+	if err != nil {
+		return err
+	}
+	for i, mix := range mixes {
+		var mixID string
+		err := tx.QueryRow(
+			"INSERT INTO user_mixes (user_id, position, title, explanation) VALUES ($1, $2, $3, $4) RETURNING id",
+			userID, i, mix.Title, mix.Explanation,
+		).Scan(&mixID)
+		if err != nil {
+			return err
+		}
+		for j, song := range mix.Songs {
+			_, err := tx.Exec(
+				"INSERT INTO user_mix_songs (mix_id, song_id, position, reason) VALUES ($1, $2, $3, $4)",
+				mixID, song.ID, j, song.Reason,
+			)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// HasComputedMixes reports whether mixes were ever computed for a user, even
+// if none came out.
+func (s *PostgresStore) HasComputedMixes(userID string) (bool, error) {
+	var computed bool
+	err := s.Db.QueryRow("SELECT EXISTS (SELECT 1 FROM user_mix_runs WHERE user_id = $1)", userID).Scan(&computed)
+	return computed, err
+}
+
+func (s *PostgresStore) GetUserMixes(userID string) ([]Mix, error) {
+	rows, err := s.Db.Query(`
+		SELECT m.id, m.title, m.explanation, m.generated_at,
+			s.id, s.title, s.artist, s.image_url, s.loudness_lufs, s.track_peak, s.replay_gain_db,
+			EXISTS (SELECT 1 FROM liked_songs l WHERE l.user_id = $1 AND l.song_id = s.id),
+			ms.reason
+		FROM user_mixes m
+		INNER JOIN user_mix_songs ms ON ms.mix_id = m.id
+		INNER JOIN songs s ON s.id = ms.song_id
+		WHERE m.user_id = $1 AND s.deleted_at IS NULL AND s.available
+		ORDER BY m.position, ms.position`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	mixes := make([]Mix, 0)
+	for rows.Next() {
+		var mix Mix
+		var song MixSong
+		if err := rows.Scan(&mix.ID, &mix.Title, &mix.Explanation, &mix.GeneratedAt,
+			&song.ID, &song.Title, &song.Artist, &song.ImageURL, &song.LoudnessLUFS, &song.TrackPeak, &song.ReplayGainDB, &song.Liked, &song.Reason); err != nil {
+			return nil, err
+		}
+		if len(mixes) == 0 || mixes[len(mixes)-1].ID != mix.ID {
+			mixes = append(mixes, mix)
+		}
+		last := &mixes[len(mixes)-1]
+		last.Songs = append(last.Songs, song)
+	}
+	return mixes, rows.Err()
+}
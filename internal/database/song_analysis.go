@@ -0,0 +1,161 @@
+package database
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// AnalysisSource is the rendition a song's audio analysis is run on.
+type AnalysisSource struct {
+	SongID      string
+	AudioKey    string
+	AudioFormat string
+}
+
+type WaveformLevel struct {
+	Points int       `json:"points"`
+	Peaks  []float64 `json:"peaks"`
+}
+
+// SongAnalysis is what the analyzer measured on a song. Loudness, gain and
+// BPM are nil when they could not be determined, e.g. for silent audio.
+type SongAnalysis struct {
+	SongID            string          `json:"song_id"`
+	DurationMs        int             `json:"duration_ms"`
+	BPM               *float64        `json:"bpm"`
+	LoudnessLUFS      *float64        `json:"loudness_lufs"`
+	TrackPeak         float64         `json:"track_peak"`
+	ReplayGainDB      *float64        `json:"replay_gain_db"`
+	LeadingSilenceMs  int             `json:"leading_silence_ms"`
+	TrailingSilenceMs int             `json:"trailing_silence_ms"`
+	Waveform          []WaveformLevel `json:"waveform"`
+	AnalyzedAt        time.Time       `json:"analyzed_at"`
+}
+
+// GetSongsPendingAnalysis returns songs whose best decodable rendition has not
+// been analysed yet, or whose last attempt failed on storage and is due for a
+// retry, in the order they were added.
+func (s *PostgresStore) GetSongsPendingAnalysis(limit int) ([]AnalysisSource, error) {
+	rows, err := s.Db.Query(`
+		SELECT r.song_id, r.audio_key, r.audio_format
+		FROM (
+			SELECT DISTINCT ON (song_id) song_id, audio_key, audio_format
+			FROM song_renditions
+			WHERE audio_format IN ('mp3', 'flac', 'wav')
+			ORDER BY song_id, (quality = 'high') DESC, bitrate_kbps DESC
+		) r
+		INNER JOIN songs s ON s.id = r.song_id
+		WHERE s.deleted_at IS NULL
+			AND (s.analysis_source_key IS DISTINCT FROM r.audio_key OR s.analysis_retry_at <= NOW())
+		ORDER BY s.analysis_retry_at NULLS FIRST, s.created_at, s.id
+		LIMIT $1`,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sources []AnalysisSource
+	for rows.Next() {
+		var src AnalysisSource
+		if err := rows.Scan(&src.SongID, &src.AudioKey, &src.AudioFormat); err != nil {
+			return nil, err
+		}
+		sources = append(sources, src)
+	}
+	return sources, rows.Err()
+}
+
+// SaveSongAnalysis stores the analysis of a rendition: loudness on the song,
+// everything else in song_analysis. A failed analysis (nil result) keeps the
+// previous values and records the error, so the same file is not retried.
+func (s *PostgresStore) SaveSongAnalysis(songID, sourceKey string, result *SongAnalysis, analysisErr string) error {
+	if result == nil {
+		_, err := s.Db.Exec(`
+			UPDATE songs
+			SET analysis_source_key = $2, analysis_error = $3, analyzed_at = NOW(),
+				analysis_attempts = 0, analysis_retry_at = NULL
+			WHERE id = $1`,
+			songID, sourceKey, analysisErr,
+		)
+		return err
+	}
+	waveform, err := json.Marshal(result.Waveform)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.Db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec(`
+		UPDATE songs
+		SET loudness_lufs = $2, track_peak = $3, replay_gain_db = $4,
+			analysis_source_key = $5, analysis_error = '', analyzed_at = NOW(),
+			analysis_attempts = 0, analysis_retry_at = NULL
+		WHERE id = $1`,
+		songID, result.LoudnessLUFS, result.TrackPeak, result.ReplayGainDB, sourceKey,
+	)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO song_analysis (song_id, duration_ms, bpm, leading_silence_ms, trailing_silence_ms, waveform, analyzed_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NOW())
+		ON CONFLICT (song_id) DO UPDATE
+		SET duration_ms = EXCLUDED.duration_ms, bpm = EXCLUDED.bpm,
+			leading_silence_ms = EXCLUDED.leading_silence_ms, trailing_silence_ms = EXCLUDED.trailing_silence_ms,
+			waveform = EXCLUDED.waveform, analyzed_at = NOW()`,
+		songID, result.DurationMs, result.BPM, result.LeadingSilenceMs, result.TrailingSilenceMs, waveform,
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SaveSongAnalysisRetry records that the audio of a song could not be read
+// from storage. The song is tried again an hour later, twice as long after
+// every further failure, up to a day.
+func (s *PostgresStore) SaveSongAnalysisRetry(songID, sourceKey, analysisErr string) error {
+	_, err := s.Db.Exec(`
+		UPDATE songs
+		SET analysis_source_key = $2, analysis_error = $3, analyzed_at = NOW(),
+			analysis_attempts = CASE WHEN analysis_source_key IS NOT DISTINCT FROM $2 THEN analysis_attempts + 1 ELSE 1 END,
+			analysis_retry_at = NOW() + LEAST(
+				INTERVAL '1 hour' * power(2, CASE
+					WHEN analysis_source_key IS NOT DISTINCT FROM $2 THEN LEAST(analysis_attempts, 5)
+					ELSE 0
+				END),
+				INTERVAL '1 day'
+			)
+		WHERE id = $1`,
+		songID, sourceKey, analysisErr,
+	)
+	return err
+}
+
+// GetSongAnalysis returns the analysis of a song that listeners can see.
+func (s *PostgresStore) GetSongAnalysis(songID string) (*SongAnalysis, error) {
+	a := &SongAnalysis{}
+	var waveform []byte
+	err := s.Db.QueryRow(`
+		SELECT a.song_id, a.duration_ms, a.bpm, s.loudness_lufs, COALESCE(s.track_peak, 0), s.replay_gain_db,
+			a.leading_silence_ms, a.trailing_silence_ms, a.waveform, a.analyzed_at
+		FROM song_analysis a
+		INNER JOIN songs s ON s.id = a.song_id
+		WHERE a.song_id = $1 AND s.deleted_at IS NULL AND s.available`,
+		songID,
+	).Scan(&a.SongID, &a.DurationMs, &a.BPM, &a.LoudnessLUFS, &a.TrackPeak, &a.ReplayGainDB,
+		&a.LeadingSilenceMs, &a.TrailingSilenceMs, &waveform, &a.AnalyzedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(waveform, &a.Waveform); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
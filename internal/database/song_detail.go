@@ -0,0 +1,165 @@
+package database
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type SongArtist struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Role string `json:"role"`
+}
+
+type SongAlbum struct {
+	ID       string `json:"id"`
+	Title    string `json:"title"`
+	ImageURL string `json:"imageUrl"`
+}
+
+// SongDetail is everything the song page shows. Genres holds the song's
+// genre followed by the names of its categories. PlayCount is rolled up once
+// a day and does not include the most recent plays.
+type SongDetail struct {
+	Song
+	Artists      []SongArtist `json:"artists"`
+	Album        *SongAlbum   `json:"album"`
+	DurationMs   int          `json:"duration_ms"`
+	ReleaseDate  *time.Time   `json:"release_date"`
+	Explicit     bool         `json:"explicit"`
+	Genres       []string     `json:"genres"`
+	PlayCount    int64        `json:"play_count"`
+	HasLyrics    bool         `json:"has_lyrics"`
+	RelatedSongs []Song       `json:"related_songs"`
+}
+
+// GetSongDetail returns a song listeners can see, with relatedLimit related
+// songs: the most similar ones first, then others by the same primary artist.
+func (s *PostgresStore) GetSongDetail(songID, userID string, relatedLimit int) (*SongDetail, error) {
+	d := &SongDetail{}
+	var genre string
+	var albumID, albumTitle, albumImage *string
+	var categories []string
+	err := s.Db.QueryRow(`
+		SELECT s.id, s.title, s.artist, s.image_url, s.loudness_lufs, s.track_peak, s.replay_gain_db,
+			EXISTS (SELECT 1 FROM liked_songs l WHERE l.user_id = $2 AND l.song_id = s.id),
+			s.duration_ms, s.release_date, s.explicit, s.genre,
+			al.id, al.title, al.image_url,
+			ARRAY(
+				SELECT c.name FROM song_categories sc
+				INNER JOIN categories c ON c.id = sc.category_id
+				WHERE sc.song_id = s.id
+				ORDER BY c.name
+			),
+			s.play_count,
+			EXISTS (SELECT 1 FROM lyrics ly WHERE ly.song_id = s.id)
+		FROM songs s
+		LEFT JOIN albums al ON al.id = s.album_id
+		WHERE s.id = $1 AND s.deleted_at IS NULL AND s.available`,
+		songID, userID,
+	).Scan(&d.ID, &d.Title, &d.Artist, &d.ImageURL, &d.LoudnessLUFS, &d.TrackPeak, &d.ReplayGainDB, &d.Liked,
+		&d.DurationMs, &d.ReleaseDate, &d.Explicit, &genre,
+		&albumID, &albumTitle, &albumImage,
+		pq.Array(&categories), &d.PlayCount, &d.HasLyrics)
+	if err != nil {
+		return nil, err
+	}
+	if albumID != nil {
+		d.Album = &SongAlbum{ID: *albumID, Title: *albumTitle, ImageURL: *albumImage}
+	}
+	d.Genres = make([]string, 0, len(categories)+1)
+	if genre != "" {
+		d.Genres = append(d.Genres, genre)
+	}
+	for _, name := range categories {
+		if name != genre {
+			d.Genres = append(d.Genres, name)
+		}
+	}
+
+	rows, err := s.Db.Query(`
+		SELECT ar.id, ar.name, sa.role
+		FROM song_artists sa
+		INNER JOIN artists ar ON ar.id = sa.artist_id
+		WHERE sa.song_id = $1
+		ORDER BY CASE sa.role WHEN 'primary' THEN 0 WHEN 'featured' THEN 1 ELSE 2 END, sa.position, ar.name`,
+		songID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	d.Artists = make([]SongArtist, 0)
+	for rows.Next() {
+		var artist SongArtist
+		if err := rows.Scan(&artist.ID, &artist.Name, &artist.Role); err != nil {
+			return nil, err
+		}
+		d.Artists = append(d.Artists, artist)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	related, err := s.Db.Query(`
+		SELECT s.id, s.title, s.artist, s.image_url, s.loudness_lufs, s.track_peak, s.replay_gain_db,
+			EXISTS (SELECT 1 FROM liked_songs l WHERE l.user_id = $2 AND l.song_id = s.id)
+		FROM songs s
+		LEFT JOIN song_similarities ss ON ss.song_id = $1 AND ss.similar_song_id = s.id
+		WHERE s.id <> $1 AND s.deleted_at IS NULL AND s.available
+			AND (ss.song_id IS NOT NULL OR EXISTS (
+				SELECT 1 FROM song_artists a
+				INNER JOIN song_artists b ON b.artist_id = a.artist_id AND b.role = 'primary'
+				WHERE a.song_id = $1 AND a.role = 'primary' AND b.song_id = s.id
+			))
+		ORDER BY ss.score DESC NULLS LAST, s.title
+		LIMIT $3`,
+		songID, userID, relatedLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer related.Close()
+	d.RelatedSongs = make([]Song, 0)
+	for related.Next() {
+		var song Song
+		if err := related.Scan(&song.ID, &song.Title, &song.Artist, &song.ImageURL, &song.LoudnessLUFS, &song.TrackPeak, &song.ReplayGainDB, &song.Liked); err != nil {
+			return nil, err
+		}
+		d.RelatedSongs = append(d.RelatedSongs, song)
+	}
+	return d, related.Err()
+}
+
+// GetSongsByIDs returns the listenable songs with the given IDs in that
+// order, skipping deleted and unavailable ones.
+func (s *PostgresStore) GetSongsByIDs(songIDs []string, userID string) ([]Song, error) {
+	return s.querySongs(`
+		SELECT s.id, s.title, s.artist, s.image_url, s.loudness_lufs, s.track_peak, s.replay_gain_db,
+			EXISTS (SELECT 1 FROM liked_songs l WHERE l.user_id = $2 AND l.song_id = s.id)
+		FROM unnest($1::text[]) WITH ORDINALITY AS u(id, ord)
+		INNER JOIN songs s ON s.id::text = u.id
+		WHERE s.deleted_at IS NULL AND s.available
+		ORDER BY u.ord`,
+		pq.Array(songIDs), userID,
+	)
+}
+
+// querySongs runs a query selecting the Song columns followed by liked.
+func (s *PostgresStore) querySongs(query string, args ...interface{}) ([]Song, error) {
+	rows, err := s.Db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	songs := make([]Song, 0)
+	for rows.Next() {
+		var song Song
+		if err := rows.Scan(&song.ID, &song.Title, &song.Artist, &song.ImageURL, &song.LoudnessLUFS, &song.TrackPeak, &song.ReplayGainDB, &song.Liked); err != nil {
+			return nil, err
+		}
+		songs = append(songs, song)
+	}
+	return songs, rows.Err()
+}
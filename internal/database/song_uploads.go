@@ -0,0 +1,191 @@
+package database
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	featuringSeparator = regexp.MustCompile(`(?i)\s+(feat\.?|ft\.?|featuring)\s+`)
+	artistSeparator    = regexp.MustCompile(`\s*,\s*`)
+)
+
+// artistNameComma stands in for the commas of artist_name_exceptions while a
+// credit line is split.
+const artistNameComma = "\x1f"
+
+// DraftSong is what an uploaded audio file tells us about a song before an
+// admin has reviewed it.
+type DraftSong struct {
+	Title       string
+	Artist      string
+	AlbumArtist string
+	Album       string
+	Genre       string
+	TrackNumber int
+	DurationMs  int
+	ReleaseDate string
+	ImageURL    string
+	SongURL     string
+	AudioKey    string
+	AudioFormat string
+	Quality     string
+	BitrateKbps int
+}
+
+// SplitArtistCredits turns a credit line such as "A, B feat. C" into primary
+// and featured credits, the same way the artist credit migration does. Names
+// are only split on commas: "&" and "and" are part of names such as
+// "Simon & Garfunkel", and names listed in exceptions, the few acts with a
+// comma in their name, are kept whole.
+func SplitArtistCredits(line string, exceptions []string) []CreditInput {
+	for _, name := range exceptions {
+		known := regexp.MustCompile(`(?i)` + regexp.QuoteMeta(name))
+		line = known.ReplaceAllStringFunc(line, func(match string) string {
+			return strings.ReplaceAll(match, ",", artistNameComma)
+		})
+	}
+	mainPart, featuredPart, _ := strings.Cut(featuringSeparator.ReplaceAllString(line, "|"), "|")
+	var credits []CreditInput
+	for _, part := range []struct{ text, role string }{{mainPart, "primary"}, {featuredPart, "featured"}} {
+		for _, name := range artistSeparator.Split(part.text, -1) {
+			name = strings.ReplaceAll(name, artistNameComma, ",")
+			if name = strings.TrimSpace(name); name != "" {
+				credits = append(credits, CreditInput{Name: name, Role: part.role})
+			}
+		}
+	}
+	return credits
+}
+
+// artistNameExceptions returns the artist names that contain a comma, longest
+// first so names that contain another one win.
+func artistNameExceptions(q querier) ([]string, error) {
+	rows, err := q.Query("SELECT name FROM artist_name_exceptions ORDER BY length(name) DESC, name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+// CreateDraftSong creates an unpublished, unavailable song from upload
+// metadata. Drafts skip validation; it happens when they are published.
+func (s *PostgresStore) CreateDraftSong(adminID string, draft *DraftSong) (*CatalogSong, error) {
+	tx, err := s.Db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	exceptions, err := artistNameExceptions(tx)
+	if err != nil {
+		return nil, err
+	}
+	credits := SplitArtistCredits(draft.Artist, exceptions)
+	// Without an album artist tag the album belongs to the first primary
+	// artist. A file with no artist at all is left without an album.
+	albumArtist := strings.TrimSpace(draft.AlbumArtist)
+	if albumArtist == "" && len(credits) > 0 && credits[0].Role == "primary" {
+		albumArtist = credits[0].Name
+	}
+	var albumID *string
+	if draft.Album != "" && albumArtist != "" {
+		var releaseDate *string
+		if draft.ReleaseDate != "" {
+			releaseDate = &draft.ReleaseDate
+		}
+		id, err := findOrCreateAlbum(tx, &ImportAlbum{
+			Title:       draft.Album,
+			ArtistName:  albumArtist,
+			ReleaseDate: releaseDate,
+			ImageURL:    draft.ImageURL,
+		})
+		if err != nil {
+			return nil, err
+		}
+		albumID = &id
+	}
+	var trackNumber *int
+	if draft.TrackNumber > 0 {
+		trackNumber = &draft.TrackNumber
+	}
+	var releaseDate *string
+	if draft.ReleaseDate != "" {
+		releaseDate = &draft.ReleaseDate
+	}
+
+	var songID string
+	err = tx.QueryRow(`
+		INSERT INTO songs (title, artist, album_id, track_number, duration_ms, genre, image_url, song_url,
+			release_date, available, is_draft, audio_key, audio_format)
+		VALUES ($1, '', $2, $3, $4, $5, $6, $7, $8::date, false, true, $9, $10)
+		RETURNING id`,
+		draft.Title, albumID, trackNumber, draft.DurationMs, draft.Genre, draft.ImageURL, draft.SongURL,
+		releaseDate, draft.AudioKey, draft.AudioFormat,
+	).Scan(&songID)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO song_renditions (song_id, quality, audio_key, audio_format, bitrate_kbps)
+		VALUES ($1, $2, $3, $4, $5)`,
+		songID, draft.Quality, draft.AudioKey, draft.AudioFormat, draft.BitrateKbps,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := saveCredits(tx, songID, credits); err != nil {
+		return nil, err
+	}
+	song, err := getCatalogSong(tx, songID)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeAudit(tx, songID, adminID, "create", nil, song); err != nil {
+		return nil, err
+	}
+	return song, tx.Commit()
+}
+
+// PublishSong validates a reviewed draft and makes it available.
+func (s *PostgresStore) PublishSong(adminID, songID string) (*CatalogSong, error) {
+	tx, err := s.Db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("SELECT 1 FROM songs WHERE id = $1 FOR UPDATE", songID); err != nil {
+		return nil, err
+	}
+	before, err := getCatalogSong(tx, songID)
+	if err != nil {
+		return nil, err
+	}
+	if !before.Draft {
+		return nil, ValidationErrors{"song is not a draft"}
+	}
+	input := before.input()
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec("UPDATE songs SET is_draft = false, available = true, updated_at = NOW() WHERE id = $1", songID); err != nil {
+		return nil, err
+	}
+	after, err := getCatalogSong(tx, songID)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeAudit(tx, songID, adminID, "publish", before, after); err != nil {
+		return nil, err
+	}
+	return after, tx.Commit()
+}
@@ -0,0 +1,233 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+)
+
+// StatsWindow limits listening statistics to plays in [Since, Until). Nil
+// bounds are open.
+type StatsWindow struct {
+	Since *time.Time
+	Until *time.Time
+}
+
+type TopSong struct {
+	Song
+	Plays    int64 `json:"plays"`
+	MsPlayed int64 `json:"ms_played"`
+}
+
+type TopArtist struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	ImageURL string `json:"imageUrl"`
+	Plays    int64  `json:"plays"`
+}
+
+type TopCategory struct {
+	Category
+	Plays int64 `json:"plays"`
+}
+
+type TopGenre struct {
+	Genre string `json:"genre"`
+	Plays int64  `json:"plays"`
+}
+
+// ListeningTotals sums everything a user played: MsPlayed includes short
+// plays, Plays only counts plays of at least the qualifying length.
+type ListeningTotals struct {
+	MsPlayed int64
+	Plays    int64
+}
+
+func (w StatsWindow) args() (sql.NullTime, sql.NullTime) {
+	var since, until sql.NullTime
+	if w.Since != nil {
+		since = sql.NullTime{Time: *w.Since, Valid: true}
+	}
+	if w.Until != nil {
+		until = sql.NullTime{Time: *w.Until, Valid: true}
+	}
+	return since, until
+}
+
+// statsPlaysCTE selects a user's qualifying plays in a window of songs that
+// are still in the catalog. $1 is the user, $2 and $3 the window and $4 the
+// minimum play length.
+const statsPlaysCTE = `
+	SELECT pe.song_id, pe.ms_played
+	FROM play_events pe
+	INNER JOIN songs s ON s.id = pe.song_id
+	WHERE pe.user_id = $1 AND s.deleted_at IS NULL
+		AND ($2::timestamptz IS NULL OR pe.started_at >= $2)
+		AND ($3::timestamptz IS NULL OR pe.started_at < $3)
+		AND pe.ms_played >= $4`
+
+// GetTopSongs returns the songs a user played most often in a window.
+func (s *PostgresStore) GetTopSongs(userID string, window StatsWindow, minMsPlayed, limit int) ([]TopSong, error) {
+	since, until := window.args()
+	rows, err := s.Db.Query(`
+		WITH plays AS (`+statsPlaysCTE+`)
+		SELECT s.id, s.title, s.artist, s.image_url, s.loudness_lufs, s.track_peak, s.replay_gain_db,
+			EXISTS (SELECT 1 FROM liked_songs l WHERE l.user_id = $1 AND l.song_id = s.id),
+			COUNT(*), SUM(p.ms_played)
+		FROM plays p
+		INNER JOIN songs s ON s.id = p.song_id
+		GROUP BY s.id
+		ORDER BY COUNT(*) DESC, SUM(p.ms_played) DESC, s.id
+		LIMIT $5`,
+		userID, since, until, minMsPlayed, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	songs := make([]TopSong, 0)
+	for rows.Next() {
+		var song TopSong
+		if err := rows.Scan(&song.ID, &song.Title, &song.Artist, &song.ImageURL, &song.LoudnessLUFS, &song.TrackPeak, &song.ReplayGainDB, &song.Liked,
+			&song.Plays, &song.MsPlayed); err != nil {
+			return nil, err
+		}
+		songs = append(songs, song)
+	}
+	return songs, rows.Err()
+}
+
+// GetTopArtists returns the primary artists a user played most often in a
+// window. A play of a song with several primary artists counts for each.
+func (s *PostgresStore) GetTopArtists(userID string, window StatsWindow, minMsPlayed, limit int) ([]TopArtist, error) {
+	since, until := window.args()
+	rows, err := s.Db.Query(`
+		WITH plays AS (`+statsPlaysCTE+`)
+		SELECT ar.id, ar.name, ar.image_url, COUNT(*)
+		FROM plays p
+		INNER JOIN song_artists sa ON sa.song_id = p.song_id AND sa.role = 'primary'
+		INNER JOIN artists ar ON ar.id = sa.artist_id
+		GROUP BY ar.id
+		ORDER BY COUNT(*) DESC, ar.name, ar.id
+		LIMIT $5`,
+		userID, since, until, minMsPlayed, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	artists := make([]TopArtist, 0)
+	for rows.Next() {
+		var artist TopArtist
+		if err := rows.Scan(&artist.ID, &artist.Name, &artist.ImageURL, &artist.Plays); err != nil {
+			return nil, err
+		}
+		artists = append(artists, artist)
+	}
+	return artists, rows.Err()
+}
+
+// GetTopCategories returns the categories of the songs a user played most
+// often in a window.
+func (s *PostgresStore) GetTopCategories(userID string, window StatsWindow, minMsPlayed, limit int) ([]TopCategory, error) {
+	since, until := window.args()
+	rows, err := s.Db.Query(`
+		WITH plays AS (`+statsPlaysCTE+`)
+		SELECT c.id, c.name, c.image_url, COUNT(*)
+		FROM plays p
+		INNER JOIN song_categories sc ON sc.song_id = p.song_id
+		INNER JOIN categories c ON c.id = sc.category_id
+		GROUP BY c.id
+		ORDER BY COUNT(*) DESC, c.name, c.id
+		LIMIT $5`,
+		userID, since, until, minMsPlayed, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	categories := make([]TopCategory, 0)
+	for rows.Next() {
+		var category TopCategory
+		if err := rows.Scan(&category.ID, &category.Name, &category.ImageURL, &category.Plays); err != nil {
+			return nil, err
+		}
+		categories = append(categories, category)
+	}
+	return categories, rows.Err()
+}
+
+// GetTopGenres returns the genres of the songs a user played most often in a
+// window, ignoring songs without a genre.
+func (s *PostgresStore) GetTopGenres(userID string, window StatsWindow, minMsPlayed, limit int) ([]TopGenre, error) {
+	since, until := window.args()
+	rows, err := s.Db.Query(`
+		WITH plays AS (`+statsPlaysCTE+`)
+		SELECT s.genre, COUNT(*)
+		FROM plays p
+		INNER JOIN songs s ON s.id = p.song_id
+		WHERE s.genre <> ''
+		GROUP BY s.genre
+		ORDER BY COUNT(*) DESC, s.genre
+		LIMIT $5`,
+		userID, since, until, minMsPlayed, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	genres := make([]TopGenre, 0)
+	for rows.Next() {
+		var genre TopGenre
+		if err := rows.Scan(&genre.Genre, &genre.Plays); err != nil {
+			return nil, err
+		}
+		genres = append(genres, genre)
+	}
+	return genres, rows.Err()
+}
+
+func (s *PostgresStore) GetListeningTotals(userID string, window StatsWindow, minMsPlayed int) (*ListeningTotals, error) {
+	since, until := window.args()
+	var totals ListeningTotals
+	err := s.Db.QueryRow(`
+		SELECT COALESCE(SUM(pe.ms_played), 0), COUNT(*) FILTER (WHERE pe.ms_played >= $4)
+		FROM play_events pe
+		WHERE pe.user_id = $1
+			AND ($2::timestamptz IS NULL OR pe.started_at >= $2)
+			AND ($3::timestamptz IS NULL OR pe.started_at < $3)`,
+		userID, since, until, minMsPlayed,
+	).Scan(&totals.MsPlayed, &totals.Plays)
+	if err != nil {
+		return nil, err
+	}
+	return &totals, nil
+}
+
+// GetListeningDays returns the UTC days on which a user had a qualifying
+// play in a window, in order.
+func (s *PostgresStore) GetListeningDays(userID string, window StatsWindow, minMsPlayed int) ([]time.Time, error) {
+	since, until := window.args()
+	rows, err := s.Db.Query(`
+		SELECT DISTINCT (pe.started_at AT TIME ZONE 'UTC')::date AS day
+		FROM play_events pe
+		WHERE pe.user_id = $1
+			AND ($2::timestamptz IS NULL OR pe.started_at >= $2)
+			AND ($3::timestamptz IS NULL OR pe.started_at < $3)
+			AND pe.ms_played >= $4
+		ORDER BY day`,
+		userID, since, until, minMsPlayed,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var days []time.Time
+	for rows.Next() {
+		var day time.Time
+		if err := rows.Scan(&day); err != nil {
+			return nil, err
+		}
+		days = append(days, day)
+	}
+	return days, rows.Err()
+}
@@ -0,0 +1,88 @@
+package database
+
+// Rendition is one stored encoding of a song. Songs added before audio was
+// stored by the service only have the ExternalURL their song_url points to.
+type Rendition struct {
+	Quality     string `json:"quality"`
+	AudioKey    string `json:"-"`
+	AudioFormat string `json:"audio_format"`
+	BitrateKbps int    `json:"bitrate_kbps"`
+	ExternalURL string `json:"-"`
+}
+
+// StreamSource is what playback needs to know about a song: the facts the
+// entitlement policy decides on and where its renditions are stored.
+type StreamSource struct {
+	SongID      string
+	DurationMs  int
+	PremiumOnly bool
+	Explicit    bool
+	Renditions  []Rendition
+}
+
+// GetStreamSource returns a published, available song with its renditions.
+// A song that only has an external song_url gets a single standard rendition
+// pointing to it.
+func (s *PostgresStore) GetStreamSource(songID string) (*StreamSource, error) {
+	src := &StreamSource{}
+	var songURL string
+	err := s.Db.QueryRow(`
+		SELECT id, duration_ms, premium_only, explicit, song_url
+		FROM songs
+		WHERE id = $1 AND deleted_at IS NULL AND available AND NOT is_draft`,
+		songID,
+	).Scan(&src.SongID, &src.DurationMs, &src.PremiumOnly, &src.Explicit, &songURL)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.Db.Query(`
+		SELECT quality, audio_key, audio_format, bitrate_kbps
+		FROM song_renditions
+		WHERE song_id = $1
+		ORDER BY bitrate_kbps`,
+		songID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var r Rendition
+		if err := rows.Scan(&r.Quality, &r.AudioKey, &r.AudioFormat, &r.BitrateKbps); err != nil {
+			return nil, err
+		}
+		src.Renditions = append(src.Renditions, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(src.Renditions) == 0 && songURL != "" {
+		src.Renditions = append(src.Renditions, Rendition{Quality: "standard", ExternalURL: songURL})
+	}
+	return src, nil
+}
+
+// SaveRendition stores or replaces the rendition of a song at one quality and
+// returns the audio key it replaced, if any, so the caller can delete it. The
+// original upload is never reported, as the song still references it.
+func (s *PostgresStore) SaveRendition(songID string, r *Rendition) (string, error) {
+	var previous string
+	err := s.Db.QueryRow(`
+		WITH old AS (
+			SELECT r.audio_key
+			FROM song_renditions r
+			INNER JOIN songs s ON s.id = r.song_id
+			WHERE r.song_id = $1 AND r.quality = $2 AND r.audio_key IS DISTINCT FROM s.audio_key
+		), upsert AS (
+			INSERT INTO song_renditions (song_id, quality, audio_key, audio_format, bitrate_kbps)
+			VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (song_id, quality) DO UPDATE
+			SET audio_key = EXCLUDED.audio_key, audio_format = EXCLUDED.audio_format,
+				bitrate_kbps = EXCLUDED.bitrate_kbps, created_at = NOW()
+		)
+		SELECT COALESCE((SELECT audio_key FROM old), '')`,
+		songID, r.Quality, r.AudioKey, r.AudioFormat, r.BitrateKbps,
+	).Scan(&previous)
+	return previous, err
+}
@@ -0,0 +1,98 @@
+package database
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// WrappedRecap is a published yearly recap. Data holds the card contents as
+// they were when the recap was generated.
+type WrappedRecap struct {
+	Year        int             `json:"year"`
+	Data        json.RawMessage `json:"data"`
+	ShareToken  string          `json:"share_token,omitempty"`
+	PublishedAt time.Time       `json:"published_at"`
+}
+
+// GetUserIDsDueForRecap returns users with qualifying plays in a window who
+// have no recap for year yet.
+func (s *PostgresStore) GetUserIDsDueForRecap(year int, window StatsWindow, minMsPlayed int) ([]string, error) {
+	since, until := window.args()
+	rows, err := s.Db.Query(`
+		SELECT DISTINCT pe.user_id
+		FROM play_events pe
+		WHERE ($2::timestamptz IS NULL OR pe.started_at >= $2)
+			AND ($3::timestamptz IS NULL OR pe.started_at < $3)
+			AND pe.ms_played >= $4
+			AND NOT EXISTS (SELECT 1 FROM wrapped_recaps w WHERE w.user_id = pe.user_id AND w.year = $1)`,
+		year, since, until, minMsPlayed,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var userIDs []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		userIDs = append(userIDs, id)
+	}
+	return userIDs, rows.Err()
+}
+
+// HasCompletedWrappedRun reports whether every recap of year has been
+// published.
+func (s *PostgresStore) HasCompletedWrappedRun(year int) (bool, error) {
+	var completed bool
+	err := s.Db.QueryRow("SELECT EXISTS (SELECT 1 FROM wrapped_runs WHERE year = $1)", year).Scan(&completed)
+	return completed, err
+}
+
+// CompleteWrappedRun marks year as done so it is not scanned for due users
+// again.
+func (s *PostgresStore) CompleteWrappedRun(year int) error {
+	_, err := s.Db.Exec("INSERT INTO wrapped_runs (year) VALUES ($1) ON CONFLICT (year) DO NOTHING", year)
+	return err
+}
+
+// SaveWrappedRecap publishes a recap. An already published recap is kept as
+// it is.
+func (s *PostgresStore) SaveWrappedRecap(userID string, year int, data []byte) error {
+	_, err := s.Db.Exec(`
+		INSERT INTO wrapped_recaps (user_id, year, data, share_token)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, year) DO NOTHING`,
+		userID, year, data, uuid.New().String(),
+	)
+	return err
+}
+
+func (s *PostgresStore) GetWrappedRecap(userID string, year int) (*WrappedRecap, error) {
+	var recap WrappedRecap
+	err := s.Db.QueryRow(
+		"SELECT year, data, share_token, published_at FROM wrapped_recaps WHERE user_id = $1 AND year = $2",
+		userID, year,
+	).Scan(&recap.Year, &recap.Data, &recap.ShareToken, &recap.PublishedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &recap, nil
+}
+
+// GetSharedWrappedRecap returns the recap behind a share token, without the
+// token itself.
+func (s *PostgresStore) GetSharedWrappedRecap(shareToken string) (*WrappedRecap, error) {
+	var recap WrappedRecap
+	err := s.Db.QueryRow(
+		"SELECT year, data, published_at FROM wrapped_recaps WHERE share_token = $1",
+		shareToken,
+	).Scan(&recap.Year, &recap.Data, &recap.PublishedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &recap, nil
+}
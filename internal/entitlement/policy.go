@@ -0,0 +1,112 @@
+// Package entitlement decides what a listener may play and at which quality.
+// Handlers ask a Policy instead of checking subscriptions themselves, so new
+// rules such as regional licensing only need to be added here.
+package entitlement
+
+const PreviewMs = 30000
+
+type Quality string
+
+const (
+	QualityStandard Quality = "standard"
+	QualityHigh     Quality = "high"
+)
+
+// Rank orders qualities from lowest to highest; unknown qualities rank 0.
+func (q Quality) Rank() int {
+	switch q {
+	case QualityStandard:
+		return 1
+	case QualityHigh:
+		return 2
+	}
+	return 0
+}
+
+// Subject is the listener a decision is made for.
+type Subject struct {
+	UserID     string
+	Subscribed bool
+}
+
+// Content is what a decision is made about.
+type Content struct {
+	SongID      string
+	DurationMs  int
+	PremiumOnly bool
+	Explicit    bool
+}
+
+// Decision is the outcome of a policy. PreviewMs is 0 when the whole song may
+// be played; Offline tells whether it may be downloaded to a device.
+type Decision struct {
+	Allowed    bool    `json:"allowed"`
+	Reason     string  `json:"reason,omitempty"`
+	MaxQuality Quality `json:"max_quality"`
+	PreviewMs  int     `json:"preview_ms,omitempty"`
+	Offline    bool    `json:"offline"`
+}
+
+// Deny refuses playback. Once denied, later rules cannot allow it again.
+func (d *Decision) Deny(reason string) {
+	d.Allowed = false
+	d.Reason = reason
+}
+
+// Rule adjusts a decision. Rules run in order and may only restrict what the
+// rules before them allowed.
+type Rule interface {
+	Apply(subject Subject, content Content, d *Decision)
+}
+
+type RuleFunc func(subject Subject, content Content, d *Decision)
+
+func (f RuleFunc) Apply(subject Subject, content Content, d *Decision) {
+	f(subject, content, d)
+}
+
+type Policy struct {
+	rules []Rule
+}
+
+func NewPolicy(rules ...Rule) *Policy {
+	return &Policy{rules: rules}
+}
+
+// DefaultPolicy is the subscription policy every deployment starts from.
+func DefaultPolicy() *Policy {
+	return NewPolicy(RuleFunc(SubscriptionRule))
+}
+
+// Decide starts from full access at high quality and lets every rule narrow
+// it down.
+func (p *Policy) Decide(subject Subject, content Content) Decision {
+	d := Decision{Allowed: true, MaxQuality: QualityHigh, Offline: true}
+	for _, rule := range p.rules {
+		if !d.Allowed {
+			break
+		}
+		rule.Apply(subject, content, &d)
+	}
+	if !d.Allowed {
+		d.MaxQuality = ""
+		d.PreviewMs = 0
+		d.Offline = false
+	}
+	return d
+}
+
+// SubscriptionRule limits free listeners to standard quality, to previews of
+// premium-only songs and to streaming only.
+func SubscriptionRule(subject Subject, content Content, d *Decision) {
+	if subject.Subscribed {
+		return
+	}
+	d.Offline = false
+	if d.MaxQuality.Rank() > QualityStandard.Rank() {
+		d.MaxQuality = QualityStandard
+	}
+	if content.PremiumOnly && content.DurationMs > PreviewMs {
+		d.PreviewMs = PreviewMs
+	}
+}
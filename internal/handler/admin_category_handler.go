@@ -0,0 +1,160 @@
+package handler
+
+import (
+	"database/sql"
+	"el-music-be/internal/database"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+type AdminCategoryHandler struct {
+	Store *database.PostgresStore
+}
+
+func NewAdminCategoryHandler(store *database.PostgresStore) *AdminCategoryHandler {
+	return &AdminCategoryHandler{Store: store}
+}
+
+// AddCategoryMemberRequest adds a song or playlist at a 0-based position, or
+// at the end when position is omitted.
+type AddCategoryMemberRequest struct {
+	SongID     string `json:"song_id"`
+	PlaylistID string `json:"playlist_id"`
+	Position   *int   `json:"position"`
+}
+
+type ReplaceCategorySongsRequest struct {
+	SongIDs []string `json:"song_ids"`
+}
+
+type ReplaceCategoryPlaylistsRequest struct {
+	PlaylistIDs []string `json:"playlist_ids"`
+}
+
+// writeCategoryMemberError maps errors of category curation to responses.
+// kind names what was being added, such as "Song".
+func writeCategoryMemberError(w http.ResponseWriter, err error, kind string) {
+	var validationErrs database.ValidationErrors
+	switch {
+	case errors.As(err, &validationErrs):
+		http.Error(w, validationErrs.Error(), http.StatusBadRequest)
+	case errors.Is(err, sql.ErrNoRows):
+		http.Error(w, "Category not found", http.StatusNotFound)
+	case strings.Contains(err.Error(), "foreign key"), strings.Contains(err.Error(), "invalid input syntax"):
+		http.Error(w, kind+" not found", http.StatusNotFound)
+	default:
+		http.Error(w, "Failed to update category", http.StatusInternalServerError)
+	}
+}
+
+// hasDuplicates reports whether any ID appears twice.
+func hasDuplicates(ids []string) bool {
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			return true
+		}
+		seen[id] = true
+	}
+	return false
+}
+
+func (h *AdminCategoryHandler) HandleAddCategorySong(w http.ResponseWriter, r *http.Request) {
+	var req AddCategoryMemberRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.SongID == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := h.Store.AddCategorySong(mux.Vars(r)["id"], req.SongID, req.Position); err != nil {
+		writeCategoryMemberError(w, err, "Song")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Song added to category"})
+}
+
+func (h *AdminCategoryHandler) HandleRemoveCategorySong(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if err := h.Store.RemoveCategorySong(vars["id"], vars["songId"]); err != nil {
+		if errors.Is(err, sql.ErrNoRows) || strings.Contains(err.Error(), "invalid input syntax") {
+			http.Error(w, "Song not found in category", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to update category", http.StatusInternalServerError)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Song removed from category"})
+}
+
+// HandleReplaceCategorySongs sets the full, ordered list of a category's
+// songs.
+func (h *AdminCategoryHandler) HandleReplaceCategorySongs(w http.ResponseWriter, r *http.Request) {
+	var req ReplaceCategorySongsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if hasDuplicates(req.SongIDs) {
+		http.Error(w, "song_ids must not contain duplicates", http.StatusBadRequest)
+		return
+	}
+	if err := h.Store.ReplaceCategorySongs(mux.Vars(r)["id"], req.SongIDs); err != nil {
+		writeCategoryMemberError(w, err, "Song")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Category songs updated"})
+}
+
+func (h *AdminCategoryHandler) HandleAddCategoryPlaylist(w http.ResponseWriter, r *http.Request) {
+	var req AddCategoryMemberRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.PlaylistID == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := h.Store.AddCategoryPlaylist(mux.Vars(r)["id"], req.PlaylistID, req.Position); err != nil {
+		writeCategoryMemberError(w, err, "Playlist")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Playlist added to category"})
+}
+
+func (h *AdminCategoryHandler) HandleRemoveCategoryPlaylist(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if err := h.Store.RemoveCategoryPlaylist(vars["id"], vars["playlistId"]); err != nil {
+		if errors.Is(err, sql.ErrNoRows) || strings.Contains(err.Error(), "invalid input syntax") {
+			http.Error(w, "Playlist not found in category", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to update category", http.StatusInternalServerError)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Playlist removed from category"})
+}
+
+// HandleReplaceCategoryPlaylists sets the full, ordered list of a category's
+// curated playlists.
+func (h *AdminCategoryHandler) HandleReplaceCategoryPlaylists(w http.ResponseWriter, r *http.Request) {
+	var req ReplaceCategoryPlaylistsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if hasDuplicates(req.PlaylistIDs) {
+		http.Error(w, "playlist_ids must not contain duplicates", http.StatusBadRequest)
+		return
+	}
+	if err := h.Store.ReplaceCategoryPlaylists(mux.Vars(r)["id"], req.PlaylistIDs); err != nil {
+		writeCategoryMemberError(w, err, "Playlist")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Category playlists updated"})
+}
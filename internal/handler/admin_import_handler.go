@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"el-music-be/internal/catalogimport"
+	"el-music-be/internal/database"
+	"el-music-be/internal/middleware"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+const maxManifestSize = 20 << 20
+
+type AdminImportHandler struct {
+	Store    *database.PostgresStore
+	Importer *catalogimport.Importer
+}
+
+func NewAdminImportHandler(store *database.PostgresStore) *AdminImportHandler {
+	return &AdminImportHandler{Store: store, Importer: catalogimport.NewImporter(store)}
+}
+
+// HandleImport accepts a manifest either as the "file" field of a multipart
+// form or as the raw request body, with ?dry_run=true to only validate.
+func (h *AdminImportHandler) HandleImport(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Could not get user ID from context", http.StatusInternalServerError)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxManifestSize)
+	dryRun := r.URL.Query().Get("dry_run") == "true"
+	batchSize, _ := strconv.Atoi(r.URL.Query().Get("batch_size"))
+
+	var body io.Reader = r.Body
+	filename := r.URL.Query().Get("filename")
+	contentType := r.Header.Get("Content-Type")
+	if file, header, err := r.FormFile("file"); err == nil {
+		defer file.Close()
+		body = file
+		filename = header.Filename
+		contentType = header.Header.Get("Content-Type")
+	}
+	rows, err := catalogimport.Parse(filename, contentType, body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	report, err := h.Importer.Import(rows, catalogimport.Options{AdminID: adminID, DryRun: dryRun, BatchSize: batchSize})
+	if err != nil {
+		http.Error(w, "Failed to import manifest", http.StatusInternalServerError)
+		return
+	}
+	encoded, err := json.Marshal(report)
+	if err != nil {
+		http.Error(w, "Failed to save import report", http.StatusInternalServerError)
+		return
+	}
+	report.ID, err = h.Store.SaveImportReport(adminID, filename, dryRun, encoded)
+	if err != nil {
+		http.Error(w, "Failed to save import report", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if !dryRun {
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(report)
+}
+
+// HandleGetImportReport downloads a stored import report as JSON, or as CSV
+// with ?format=csv.
+func (h *AdminImportHandler) HandleGetImportReport(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	encoded, err := h.Store.GetImportReport(id)
+	if err != nil {
+		http.Error(w, "Import report not found", http.StatusNotFound)
+		return
+	}
+	var report catalogimport.Report
+	if err := json.Unmarshal(encoded, &report); err != nil {
+		http.Error(w, "Failed to read import report", http.StatusInternalServerError)
+		return
+	}
+	report.ID = id
+	if r.URL.Query().Get("format") == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="import-`+id+`.csv"`)
+		report.WriteCSV(w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="import-`+id+`.json"`)
+	json.NewEncoder(w).Encode(report)
+}
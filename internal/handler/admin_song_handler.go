@@ -0,0 +1,156 @@
+package handler
+
+import (
+	"database/sql"
+	"el-music-be/internal/database"
+	"el-music-be/internal/middleware"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+type AdminSongHandler struct {
+	Store *database.PostgresStore
+}
+
+func NewAdminSongHandler(store *database.PostgresStore) *AdminSongHandler {
+	return &AdminSongHandler{Store: store}
+}
+
+func (h *AdminSongHandler) HandleCreateSong(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Could not get user ID from context", http.StatusInternalServerError)
+		return
+	}
+	var req database.SongInput
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Normalize()
+	if err := req.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	song, err := h.Store.CreateSong(adminID, &req)
+	if err != nil {
+		writeSongWriteError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(song)
+}
+
+func (h *AdminSongHandler) HandleUpdateSong(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Could not get user ID from context", http.StatusInternalServerError)
+		return
+	}
+	var req database.SongInput
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Normalize()
+	if err := req.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	song, err := h.Store.UpdateSong(adminID, mux.Vars(r)["id"], &req)
+	if err != nil {
+		writeSongWriteError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(song)
+}
+
+func (h *AdminSongHandler) HandleGetSong(w http.ResponseWriter, r *http.Request) {
+	song, err := h.Store.GetCatalogSong(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Song not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(song)
+}
+
+func (h *AdminSongHandler) HandleListSongs(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	page, err := h.Store.ListCatalogSongs(
+		strings.TrimSpace(query.Get("q")),
+		query.Get("include_deleted") == "true",
+		query.Get("cursor"),
+		parseLimit(r),
+	)
+	if err != nil {
+		if errors.Is(err, database.ErrInvalidCursor) {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+		} else {
+			http.Error(w, "Failed to fetch songs", http.StatusInternalServerError)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+func (h *AdminSongHandler) HandleDeleteSong(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Could not get user ID from context", http.StatusInternalServerError)
+		return
+	}
+	if err := h.Store.DeleteSong(adminID, mux.Vars(r)["id"]); err != nil {
+		http.Error(w, "Song not found or already deleted", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Song deleted successfully"})
+}
+
+func (h *AdminSongHandler) HandleRestoreSong(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Could not get user ID from context", http.StatusInternalServerError)
+		return
+	}
+	if err := h.Store.RestoreSong(adminID, mux.Vars(r)["id"]); err != nil {
+		http.Error(w, "Song not found or not deleted", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Song restored successfully"})
+}
+
+func (h *AdminSongHandler) HandleGetSongAuditLog(w http.ResponseWriter, r *http.Request) {
+	entries, err := h.Store.GetSongAuditLog(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Failed to fetch audit log", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+func writeSongWriteError(w http.ResponseWriter, err error) {
+	var validationErrs database.ValidationErrors
+	switch {
+	case errors.As(err, &validationErrs):
+		http.Error(w, validationErrs.Error(), http.StatusBadRequest)
+	case errors.Is(err, sql.ErrNoRows):
+		http.Error(w, "Song not found", http.StatusNotFound)
+	case strings.Contains(err.Error(), "duplicate key"):
+		http.Error(w, "A song with this ISRC already exists", http.StatusConflict)
+	case strings.Contains(err.Error(), "foreign key"):
+		http.Error(w, "Album not found", http.StatusBadRequest)
+	default:
+		http.Error(w, "Failed to save song", http.StatusInternalServerError)
+	}
+}
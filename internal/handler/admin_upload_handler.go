@@ -0,0 +1,256 @@
+package handler
+
+import (
+	"bytes"
+	"el-music-be/internal/audio"
+	"el-music-be/internal/database"
+	"el-music-be/internal/entitlement"
+	"el-music-be/internal/middleware"
+	"el-music-be/internal/storage"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+const (
+	maxUploadSize   = 300 << 20
+	highQualityKbps = 256
+)
+
+var uploadExtensions = map[string]string{
+	".mp3":  audio.FormatMP3,
+	".flac": audio.FormatFLAC,
+	".m4a":  audio.FormatM4A,
+	".ogg":  audio.FormatOgg,
+	".oga":  audio.FormatOgg,
+	".opus": audio.FormatOgg,
+	".wav":  audio.FormatWAV,
+}
+
+var coverExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/jpg":  ".jpg",
+	"image/png":  ".png",
+}
+
+type AdminUploadHandler struct {
+	Store   *database.PostgresStore
+	Storage storage.Backend
+}
+
+func NewAdminUploadHandler(store *database.PostgresStore, backend storage.Backend) *AdminUploadHandler {
+	return &AdminUploadHandler{Store: store, Storage: backend}
+}
+
+// HandleUploadSong stores an uploaded audio file, reads its tags and creates
+// a draft song from them for an admin to review and publish.
+func (h *AdminUploadHandler) HandleUploadSong(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Could not get user ID from context", http.StatusInternalServerError)
+		return
+	}
+	upload, ok := h.storeAudio(w, r)
+	if !ok {
+		return
+	}
+	defer upload.file.Close()
+	id, metadata, header, audioKey := upload.id, upload.metadata, upload.header, upload.audioKey
+	storedKeys := []string{audioKey}
+
+	imageURL := ""
+	if metadata.Picture != nil {
+		if ext, ok := coverExtensions[strings.ToLower(metadata.Picture.MIMEType)]; ok {
+			coverKey := "covers/" + id + ext
+			if _, err := h.Storage.Put(coverKey, bytes.NewReader(metadata.Picture.Data)); err != nil {
+				log.Printf("Could not store cover art of %s: %v", header.Filename, err)
+			} else {
+				storedKeys = append(storedKeys, coverKey)
+				imageURL = "/api/v1/covers/" + id + ext
+			}
+		}
+	}
+
+	title := metadata.Title
+	if title == "" {
+		title = strings.TrimSuffix(filepath.Base(header.Filename), filepath.Ext(header.Filename))
+	}
+	song, err := h.Store.CreateDraftSong(adminID, &database.DraftSong{
+		Title:       title,
+		Artist:      metadata.Artist,
+		AlbumArtist: metadata.AlbumArtist,
+		Album:       metadata.Album,
+		Genre:       metadata.Genre,
+		TrackNumber: metadata.TrackNumber,
+		DurationMs:  metadata.DurationMs,
+		ReleaseDate: metadata.ReleaseDate(),
+		ImageURL:    imageURL,
+		SongURL:     h.Storage.URL(audioKey),
+		AudioKey:    audioKey,
+		AudioFormat: metadata.Format,
+		Quality:     string(upload.quality),
+		BitrateKbps: upload.bitrateKbps,
+	})
+	if err != nil {
+		for _, key := range storedKeys {
+			h.Storage.Delete(key)
+		}
+		http.Error(w, "Failed to create draft song", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(song)
+}
+
+type storedAudio struct {
+	id          string
+	file        multipart.File
+	header      *multipart.FileHeader
+	metadata    *audio.Metadata
+	audioKey    string
+	quality     entitlement.Quality
+	bitrateKbps int
+}
+
+// storeAudio validates the audio file of a multipart upload and puts it in
+// storage. It writes the error response itself when it fails.
+func (h *AdminUploadHandler) storeAudio(w http.ResponseWriter, r *http.Request) (*storedAudio, bool) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "Missing audio file", http.StatusBadRequest)
+		return nil, false
+	}
+	expectedFormat, ok := uploadExtensions[strings.ToLower(filepath.Ext(header.Filename))]
+	if !ok {
+		file.Close()
+		http.Error(w, "Only MP3, FLAC, M4A, OGG and WAV files are supported", http.StatusUnsupportedMediaType)
+		return nil, false
+	}
+	metadata, err := audio.ReadMetadata(file, header.Size)
+	if err != nil || metadata.Format != expectedFormat {
+		file.Close()
+		http.Error(w, "File is not a valid "+strings.ToUpper(expectedFormat)+" file", http.StatusUnsupportedMediaType)
+		return nil, false
+	}
+	id := uuid.New().String()
+	audioKey := "audio/" + id + "." + metadata.Format
+	if _, err := file.Seek(0, io.SeekStart); err == nil {
+		_, err = h.Storage.Put(audioKey, file)
+	}
+	if err != nil {
+		file.Close()
+		http.Error(w, "Failed to store audio file", http.StatusInternalServerError)
+		return nil, false
+	}
+	quality, bitrateKbps := classifyRendition(metadata, header.Size)
+	return &storedAudio{
+		id:          id,
+		file:        file,
+		header:      header,
+		metadata:    metadata,
+		audioKey:    audioKey,
+		quality:     quality,
+		bitrateKbps: bitrateKbps,
+	}, true
+}
+
+// classifyRendition derives the average bitrate of a file and counts lossless
+// files and lossy ones of at least highQualityKbps as high quality.
+func classifyRendition(metadata *audio.Metadata, size int64) (entitlement.Quality, int) {
+	bitrateKbps := 0
+	if metadata.DurationMs > 0 {
+		bitrateKbps = int(size * 8 / int64(metadata.DurationMs))
+	}
+	if metadata.Format == audio.FormatFLAC || metadata.Format == audio.FormatWAV || bitrateKbps >= highQualityKbps {
+		return entitlement.QualityHigh, bitrateKbps
+	}
+	return entitlement.QualityStandard, bitrateKbps
+}
+
+// HandleUploadRendition adds another encoding of an existing song, such as a
+// standard quality version for free listeners. The quality form field
+// overrides the one derived from the file.
+func (h *AdminUploadHandler) HandleUploadRendition(w http.ResponseWriter, r *http.Request) {
+	songID := mux.Vars(r)["id"]
+	upload, ok := h.storeAudio(w, r)
+	if !ok {
+		return
+	}
+	defer upload.file.Close()
+	quality := upload.quality
+	if override := r.FormValue("quality"); override != "" {
+		quality = entitlement.Quality(override)
+		if quality.Rank() == 0 {
+			h.Storage.Delete(upload.audioKey)
+			http.Error(w, "quality must be standard or high", http.StatusBadRequest)
+			return
+		}
+	}
+	rendition := &database.Rendition{
+		Quality:     string(quality),
+		AudioKey:    upload.audioKey,
+		AudioFormat: upload.metadata.Format,
+		BitrateKbps: upload.bitrateKbps,
+	}
+	previous, err := h.Store.SaveRendition(songID, rendition)
+	if err != nil {
+		h.Storage.Delete(upload.audioKey)
+		if strings.Contains(err.Error(), "foreign key") || strings.Contains(err.Error(), "invalid input syntax") {
+			http.Error(w, "Song not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to save rendition", http.StatusInternalServerError)
+		}
+		return
+	}
+	if previous != "" && previous != upload.audioKey {
+		if err := h.Storage.Delete(previous); err != nil {
+			log.Printf("Could not delete replaced rendition %s: %v", previous, err)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(rendition)
+}
+
+func (h *AdminUploadHandler) HandlePublishSong(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Could not get user ID from context", http.StatusInternalServerError)
+		return
+	}
+	song, err := h.Store.PublishSong(adminID, mux.Vars(r)["id"])
+	if err != nil {
+		var validationErrs database.ValidationErrors
+		if errors.As(err, &validationErrs) {
+			http.Error(w, validationErrs.Error(), http.StatusBadRequest)
+		} else {
+			http.Error(w, "Song not found", http.StatusNotFound)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(song)
+}
+
+// HandleGetCover serves cover art extracted from uploads.
+func (h *AdminUploadHandler) HandleGetCover(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	object, info, err := h.Storage.Open("covers/" + filepath.Base(name))
+	if err != nil {
+		http.Error(w, "Cover not found", http.StatusNotFound)
+		return
+	}
+	defer object.Close()
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	http.ServeContent(w, r, name, info.ModTime, object)
+}
@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"el-music-be/internal/database"
+	"el-music-be/internal/middleware"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+const artistTopSongsLimit = 10
+
+type ArtistHandler struct {
+	Store *database.PostgresStore
+}
+
+func NewArtistHandler(store *database.PostgresStore) *ArtistHandler {
+	return &ArtistHandler{Store: store}
+}
+
+func (h *ArtistHandler) HandleGetArtist(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Could not get user ID from context", http.StatusInternalServerError)
+		return
+	}
+	artist, err := h.Store.GetArtistByID(mux.Vars(r)["id"], userID)
+	if err != nil {
+		http.Error(w, "Artist not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(artist)
+}
+
+func (h *ArtistHandler) HandleGetArtistTopSongs(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Could not get user ID from context", http.StatusInternalServerError)
+		return
+	}
+	artistID := mux.Vars(r)["id"]
+	if _, err := h.Store.GetArtistByID(artistID, userID); err != nil {
+		http.Error(w, "Artist not found", http.StatusNotFound)
+		return
+	}
+	songs, err := h.Store.GetArtistTopSongs(artistID, userID, artistTopSongsLimit)
+	if err != nil {
+		http.Error(w, "Failed to fetch songs", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(songs)
+}
+
+func (h *ArtistHandler) HandleGetArtistAlbums(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Could not get user ID from context", http.StatusInternalServerError)
+		return
+	}
+	artistID := mux.Vars(r)["id"]
+	if _, err := h.Store.GetArtistByID(artistID, userID); err != nil {
+		http.Error(w, "Artist not found", http.StatusNotFound)
+		return
+	}
+	albums, err := h.Store.GetArtistAlbums(artistID)
+	if err != nil {
+		http.Error(w, "Failed to fetch albums", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(albums)
+}
+
+func (h *ArtistHandler) HandleGetAlbum(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Could not get user ID from context", http.StatusInternalServerError)
+		return
+	}
+	album, err := h.Store.GetAlbumByID(mux.Vars(r)["id"], userID)
+	if err != nil {
+		http.Error(w, "Album not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(album)
+}
+
+func (h *ArtistHandler) HandleFollowArtist(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Could not get user ID from context", http.StatusInternalServerError)
+		return
+	}
+	if err := h.Store.FollowArtist(userID, mux.Vars(r)["id"]); err != nil {
+		if strings.Contains(err.Error(), "foreign key") || strings.Contains(err.Error(), "invalid input syntax") {
+			http.Error(w, "Artist not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to follow artist", http.StatusInternalServerError)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Artist followed"})
+}
+
+func (h *ArtistHandler) HandleUnfollowArtist(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Could not get user ID from context", http.StatusInternalServerError)
+		return
+	}
+	if err := h.Store.UnfollowArtist(userID, mux.Vars(r)["id"]); err != nil {
+		http.Error(w, "Failed to unfollow artist", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Artist unfollowed"})
+}
+
+func (h *ArtistHandler) HandleGetFollowedArtists(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Could not get user ID from context", http.StatusInternalServerError)
+		return
+	}
+	page, err := h.Store.GetFollowedArtists(userID, r.URL.Query().Get("cursor"), parseLimit(r))
+	if err != nil {
+		if errors.Is(err, database.ErrInvalidCursor) {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+		} else {
+			http.Error(w, "Failed to fetch followed artists", http.StatusInternalServerError)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
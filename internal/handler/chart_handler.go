@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"el-music-be/internal/database"
+	"el-music-be/internal/middleware"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+type ChartHandler struct {
+	Store *database.PostgresStore
+}
+
+func NewChartHandler(store *database.PostgresStore) *ChartHandler {
+	return &ChartHandler{Store: store}
+}
+
+func (h *ChartHandler) HandleListCharts(w http.ResponseWriter, r *http.Request) {
+	charts, err := h.Store.ListCharts()
+	if err != nil {
+		http.Error(w, "Failed to fetch charts", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(charts)
+}
+
+// HandleGetChart returns the latest snapshot of a chart such as
+// "weekly-global" or "daily-us".
+func (h *ChartHandler) HandleGetChart(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Could not get user ID from context", http.StatusInternalServerError)
+		return
+	}
+	chart, err := h.Store.GetChart(mux.Vars(r)["chartId"], userID)
+	if err != nil {
+		http.Error(w, "Chart not found", http.StatusNotFound)
+		return
+	}
+	writeJSONWithETag(w, r, chart)
+}
@@ -0,0 +1,190 @@
+package handler
+
+import (
+	"el-music-be/internal/database"
+	"el-music-be/internal/entitlement"
+	"el-music-be/internal/hls"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// hlsResource is what an HLS session grants access to: every playlist and
+// segment of one rendition, up to the preview length.
+func hlsResource(songID, quality string, previewMs int, session string) string {
+	return fmt.Sprintf("hls:%s:%s:%d:%s", songID, quality, previewMs, session)
+}
+
+// HandleGetMasterPlaylist starts an HLS session and lists the renditions the
+// listener is entitled to, each with URLs signed for this session only. Songs
+// without an MP3 rendition have no HLS stream; clients fall back to
+// HandleGetStreamURL when this returns 404.
+func (h *StreamHandler) HandleGetMasterPlaylist(w http.ResponseWriter, r *http.Request) {
+	subject := entitlementSubject(r)
+	if subject.UserID == "" {
+		http.Error(w, "Could not get user ID from context", http.StatusInternalServerError)
+		return
+	}
+	songID := mux.Vars(r)["songId"]
+	src, err := h.Store.GetStreamSource(songID)
+	if err != nil {
+		http.Error(w, "Song not found", http.StatusNotFound)
+		return
+	}
+	decision := h.Policy.Decide(subject, streamContent(src))
+	if !decision.Allowed {
+		http.Error(w, decision.Reason, http.StatusForbidden)
+		return
+	}
+	packages, err := h.Store.GetHLSPackages(songID)
+	if err != nil {
+		http.Error(w, "Failed to fetch stream", http.StatusInternalServerError)
+		return
+	}
+
+	session := uuid.New().String()
+	now := time.Now()
+	var variants []hls.Variant
+	for _, pkg := range allowedPackages(packages, decision.MaxQuality) {
+		query, _ := h.Signer.Sign(hlsResource(songID, pkg.Quality, decision.PreviewMs, session), subject.UserID, now)
+		query.Set("session", session)
+		query.Set("preview", strconv.Itoa(decision.PreviewMs))
+		variants = append(variants, hls.Variant{
+			URI:          "hls/" + url.PathEscape(pkg.Quality) + "/index.m3u8?" + query.Encode(),
+			BandwidthBps: pkg.BitrateKbps * 1000,
+		})
+	}
+	if len(variants) == 0 {
+		http.Error(w, "Stream not available", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", hls.ContentType)
+	w.Header().Set("Cache-Control", "no-store")
+	fmt.Fprint(w, hls.MasterPlaylist(variants))
+}
+
+// allowedPackages returns the packages that do not exceed maxQuality, or the
+// lowest quality ones when every package is above it, the same way
+// chooseRendition falls back for progressive streams.
+func allowedPackages(packages []database.HLSPackage, maxQuality entitlement.Quality) []database.HLSPackage {
+	var allowed []database.HLSPackage
+	lowestRank := 0
+	for _, pkg := range packages {
+		rank := entitlement.Quality(pkg.Quality).Rank()
+		if rank == 0 {
+			continue
+		}
+		if rank <= maxQuality.Rank() {
+			allowed = append(allowed, pkg)
+		}
+		if lowestRank == 0 || rank < lowestRank {
+			lowestRank = rank
+		}
+	}
+	if len(allowed) > 0 {
+		return allowed
+	}
+	for _, pkg := range packages {
+		if entitlement.Quality(pkg.Quality).Rank() == lowestRank {
+			allowed = append(allowed, pkg)
+		}
+	}
+	return allowed
+}
+
+// verifyHLSRequest checks the session signature of a media playlist or
+// segment request and returns the user, the package and how many of its
+// segments the session may fetch. It writes the error response itself.
+func (h *StreamHandler) verifyHLSRequest(w http.ResponseWriter, r *http.Request) (string, *database.StreamSource, *database.HLSPackage, int, bool) {
+	vars := mux.Vars(r)
+	songID, quality := vars["songId"], vars["quality"]
+	query := r.URL.Query()
+	previewMs, _ := strconv.Atoi(query.Get("preview"))
+	userID, err := h.Signer.Verify(hlsResource(songID, quality, previewMs, query.Get("session")), query, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return "", nil, nil, 0, false
+	}
+	src, err := h.Store.GetStreamSource(songID)
+	if err != nil {
+		http.Error(w, "Song not found", http.StatusNotFound)
+		return "", nil, nil, 0, false
+	}
+	packages, err := h.Store.GetHLSPackages(songID)
+	if err != nil {
+		http.Error(w, "Failed to fetch stream", http.StatusInternalServerError)
+		return "", nil, nil, 0, false
+	}
+	for i := range packages {
+		if packages[i].Quality == quality {
+			return userID, src, &packages[i], hls.SegmentsFor(packages[i].SegmentDurations, previewMs), true
+		}
+	}
+	http.Error(w, "Stream not available", http.StatusNotFound)
+	return "", nil, nil, 0, false
+}
+
+// HandleGetMediaPlaylist lists the segments of one rendition, signed with the
+// session of the master playlist that linked to it.
+func (h *StreamHandler) HandleGetMediaPlaylist(w http.ResponseWriter, r *http.Request) {
+	_, _, pkg, segments, ok := h.verifyHLSRequest(w, r)
+	if !ok {
+		return
+	}
+	rawQuery := r.URL.RawQuery
+	playlist := hls.MediaPlaylist(pkg.SegmentDurations[:segments], func(index int) string {
+		return strconv.Itoa(index) + ".mp3?" + rawQuery
+	})
+	w.Header().Set("Content-Type", hls.ContentType)
+	w.Header().Set("Cache-Control", "no-store")
+	fmt.Fprint(w, playlist)
+}
+
+// HandleGetSegment serves one segment and logs a play once the segments the
+// session has fetched add up to minStreamedMs of audio, so seeking straight to
+// a late segment does not count as a play.
+func (h *StreamHandler) HandleGetSegment(w http.ResponseWriter, r *http.Request) {
+	userID, src, pkg, segments, ok := h.verifyHLSRequest(w, r)
+	if !ok {
+		return
+	}
+	index, err := strconv.Atoi(mux.Vars(r)["segment"])
+	if err != nil || index < 0 || index >= segments {
+		http.Error(w, "Segment not found", http.StatusNotFound)
+		return
+	}
+	key := hls.SegmentKey(pkg.KeyPrefix, index)
+	object, info, err := h.Storage.Open(key)
+	if err != nil {
+		log.Printf("Could not open HLS segment %s: %v", key, err)
+		http.Error(w, "Segment not found", http.StatusNotFound)
+		return
+	}
+	defer object.Close()
+
+	w.Header().Set("Content-Type", "audio/mpeg")
+	w.Header().Set("ETag", fmt.Sprintf(`"%s-%d"`, pkg.KeyPrefix, index))
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	cw := &countingWriter{ResponseWriter: w}
+	http.ServeContent(cw, r, "", info.ModTime, object)
+
+	// Previews are samples, not plays.
+	if r.Method != http.MethodGet || cw.written == 0 || segments < len(pkg.SegmentDurations) {
+		return
+	}
+	session := r.URL.Query().Get("session")
+	servedMs := h.addServed(session, int64(pkg.SegmentDurations[index]*1000))
+	threshold := minStreamedMs
+	if src.DurationMs > 0 {
+		threshold = min(threshold, src.DurationMs)
+	}
+	if servedMs >= int64(threshold) {
+		h.recordPlayOnce(session, userID, src.SongID, int(servedMs))
+	}
+}
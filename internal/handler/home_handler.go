@@ -0,0 +1,185 @@
+package handler
+
+import (
+	"database/sql"
+	"el-music-be/internal/database"
+	"el-music-be/internal/home"
+	"el-music-be/internal/middleware"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+type HomeHandler struct {
+	Store *database.PostgresStore
+	Feed  *home.Feed
+}
+
+func NewHomeHandler(store *database.PostgresStore, feed *home.Feed) *HomeHandler {
+	return &HomeHandler{Store: store, Feed: feed}
+}
+
+type HomeResponse struct {
+	Shelves []home.Shelf `json:"shelves"`
+}
+
+type SetCountryRequest struct {
+	Country string `json:"country"`
+}
+
+type ReorderShelvesRequest struct {
+	ShelfIDs []string `json:"shelf_ids"`
+}
+
+// HandleGetHome returns the shelves of the caller's home screen. ?country=
+// overrides the country stored on the account, e.g. while travelling.
+func (h *HomeHandler) HandleGetHome(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Could not get user ID from context", http.StatusInternalServerError)
+		return
+	}
+	isSubscribed, _ := r.Context().Value(middleware.IsSubscribedKey).(bool)
+	country, _ := r.Context().Value(middleware.CountryKey).(string)
+	if override := r.URL.Query().Get("country"); override != "" {
+		country = database.NormalizeCountry(override)
+		if !database.ValidCountry(country) {
+			http.Error(w, "Invalid country", http.StatusBadRequest)
+			return
+		}
+	}
+	shelves, err := h.Feed.Build(home.Listener{UserID: userID, Country: country, Subscribed: isSubscribed})
+	if err != nil {
+		http.Error(w, "Failed to fetch home", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(HomeResponse{Shelves: shelves})
+}
+
+func (h *HomeHandler) HandleSetMyCountry(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Could not get user ID from context", http.StatusInternalServerError)
+		return
+	}
+	var req SetCountryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	country := database.NormalizeCountry(req.Country)
+	if !database.ValidCountry(country) {
+		http.Error(w, "country must be an ISO 3166-1 alpha-2 code", http.StatusBadRequest)
+		return
+	}
+	if err := h.Store.SetUserCountry(userID, country); err != nil {
+		http.Error(w, "Failed to update country", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Country updated successfully"})
+}
+
+func (h *HomeHandler) HandleListShelves(w http.ResponseWriter, r *http.Request) {
+	shelves, err := h.Store.ListHomeShelves()
+	if err != nil {
+		http.Error(w, "Failed to fetch shelves", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(shelves)
+}
+
+func (h *HomeHandler) HandleCreateShelf(w http.ResponseWriter, r *http.Request) {
+	var req database.HomeShelfInput
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Normalize()
+	if err := req.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	shelf, err := h.Store.CreateHomeShelf(&req)
+	if err != nil {
+		var validationErrs database.ValidationErrors
+		if errors.As(err, &validationErrs) {
+			http.Error(w, validationErrs.Error(), http.StatusBadRequest)
+		} else {
+			http.Error(w, "Failed to save shelf", http.StatusInternalServerError)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(shelf)
+}
+
+func (h *HomeHandler) HandleUpdateShelf(w http.ResponseWriter, r *http.Request) {
+	var req database.HomeShelfInput
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Normalize()
+	if err := req.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	shelf, err := h.Store.UpdateHomeShelf(mux.Vars(r)["id"], &req)
+	if err != nil {
+		var validationErrs database.ValidationErrors
+		if errors.As(err, &validationErrs) {
+			http.Error(w, validationErrs.Error(), http.StatusBadRequest)
+		} else if errors.Is(err, sql.ErrNoRows) || strings.Contains(err.Error(), "invalid input syntax") {
+			http.Error(w, "Shelf not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to save shelf", http.StatusInternalServerError)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(shelf)
+}
+
+func (h *HomeHandler) HandleDeleteShelf(w http.ResponseWriter, r *http.Request) {
+	if err := h.Store.DeleteHomeShelf(mux.Vars(r)["id"]); err != nil {
+		if errors.Is(err, sql.ErrNoRows) || strings.Contains(err.Error(), "invalid input syntax") {
+			http.Error(w, "Shelf not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to delete shelf", http.StatusInternalServerError)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Shelf deleted successfully"})
+}
+
+// HandleReorderShelves sets the order of all shelves at once.
+func (h *HomeHandler) HandleReorderShelves(w http.ResponseWriter, r *http.Request) {
+	var req ReorderShelvesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if hasDuplicates(req.ShelfIDs) {
+		http.Error(w, database.ErrShelfOrderMismatch.Error(), http.StatusBadRequest)
+		return
+	}
+	shelves, err := h.Store.ReorderHomeShelves(req.ShelfIDs)
+	if err != nil {
+		if errors.Is(err, database.ErrShelfOrderMismatch) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else {
+			http.Error(w, "Failed to reorder shelves", http.StatusInternalServerError)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(shelves)
+}
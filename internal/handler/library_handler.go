@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"el-music-be/internal/database"
+	"el-music-be/internal/middleware"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+const maxContainsIDs = 50
+
+type LibraryHandler struct {
+	Store *database.PostgresStore
+}
+
+func NewLibraryHandler(store *database.PostgresStore) *LibraryHandler {
+	return &LibraryHandler{Store: store}
+}
+
+func (h *LibraryHandler) HandleLikeSong(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Could not get user ID from context", http.StatusInternalServerError)
+		return
+	}
+	songID := mux.Vars(r)["id"]
+	if err := h.Store.LikeSong(userID, songID); err != nil {
+		if strings.Contains(err.Error(), "foreign key") || strings.Contains(err.Error(), "invalid input syntax") {
+			http.Error(w, "Song not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to like song", http.StatusInternalServerError)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Song added to library"})
+}
+
+func (h *LibraryHandler) HandleUnlikeSong(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Could not get user ID from context", http.StatusInternalServerError)
+		return
+	}
+	songID := mux.Vars(r)["id"]
+	if err := h.Store.UnlikeSong(userID, songID); err != nil {
+		http.Error(w, "Failed to remove song from library", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Song removed from library"})
+}
+
+func (h *LibraryHandler) HandleGetLikedSongs(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Could not get user ID from context", http.StatusInternalServerError)
+		return
+	}
+	page, err := h.Store.GetLikedSongs(userID, r.URL.Query().Get("cursor"), parseLimit(r))
+	if err != nil {
+		if errors.Is(err, database.ErrInvalidCursor) {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+		} else {
+			http.Error(w, "Failed to fetch liked songs", http.StatusInternalServerError)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+// HandleLibraryContains answers, for a comma separated list of song IDs in
+// the "ids" query parameter, which of them the caller has liked.
+func (h *LibraryHandler) HandleLibraryContains(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Could not get user ID from context", http.StatusInternalServerError)
+		return
+	}
+	var songIDs []string
+	for _, id := range strings.Split(r.URL.Query().Get("ids"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			songIDs = append(songIDs, id)
+		}
+	}
+	if len(songIDs) == 0 {
+		http.Error(w, "ids is required", http.StatusBadRequest)
+		return
+	}
+	if len(songIDs) > maxContainsIDs {
+		http.Error(w, "Too many ids", http.StatusBadRequest)
+		return
+	}
+	contains, err := h.Store.LibraryContains(userID, songIDs)
+	if err != nil {
+		http.Error(w, "Failed to check library", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(contains)
+}
@@ -0,0 +1,200 @@
+package handler
+
+import (
+	"database/sql"
+	"el-music-be/internal/database"
+	"el-music-be/internal/entitlement"
+	"el-music-be/internal/streaming"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// offlineLicenseTTL is how long a device may stay offline before its
+	// downloads stop playing.
+	offlineLicenseTTL  = 30 * 24 * time.Hour
+	maxOfflineLicenses = 10000
+	maxDeviceIDLength  = 100
+)
+
+type OfflineHandler struct {
+	Store  *database.PostgresStore
+	Signer *streaming.Signer
+	Policy *entitlement.Policy
+}
+
+func NewOfflineHandler(store *database.PostgresStore, signer *streaming.Signer, policy *entitlement.Policy) *OfflineHandler {
+	return &OfflineHandler{Store: store, Signer: signer, Policy: policy}
+}
+
+type GrantLicenseRequest struct {
+	SongID   string `json:"song_id"`
+	DeviceID string `json:"device_id"`
+}
+
+type RenewLicensesRequest struct {
+	DeviceID string `json:"device_id"`
+}
+
+func validDeviceID(deviceID string) bool {
+	return deviceID != "" && len(deviceID) <= maxDeviceIDLength
+}
+
+// licenseExpiry never lets a license outlive the subscription it was granted
+// under.
+func (h *OfflineHandler) licenseExpiry(userID string) (time.Time, error) {
+	user, err := h.Store.GetUserByID(userID)
+	if err != nil {
+		return time.Time{}, err
+	}
+	expires := time.Now().Add(offlineLicenseTTL)
+	if user.SubscriptionExpiresAt.Valid && user.SubscriptionExpiresAt.Time.Before(expires) {
+		expires = user.SubscriptionExpiresAt.Time
+	}
+	return expires, nil
+}
+
+// HandleGrantLicense licenses a song for download to one device and returns
+// a signed URL to download it from.
+func (h *OfflineHandler) HandleGrantLicense(w http.ResponseWriter, r *http.Request) {
+	subject := entitlementSubject(r)
+	if subject.UserID == "" {
+		http.Error(w, "Could not get user ID from context", http.StatusInternalServerError)
+		return
+	}
+	if !subject.Subscribed {
+		http.Error(w, "Offline downloads require a premium subscription", http.StatusForbidden)
+		return
+	}
+	var req GrantLicenseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.DeviceID = strings.TrimSpace(req.DeviceID)
+	if req.SongID == "" || !validDeviceID(req.DeviceID) {
+		http.Error(w, "song_id and a device_id of at most 100 characters are required", http.StatusBadRequest)
+		return
+	}
+
+	src, err := h.Store.GetStreamSource(req.SongID)
+	if err != nil {
+		http.Error(w, "Song not found", http.StatusNotFound)
+		return
+	}
+	decision := h.Policy.Decide(subject, streamContent(src))
+	if !decision.Allowed || !decision.Offline || decision.PreviewMs > 0 {
+		reason := decision.Reason
+		if reason == "" {
+			reason = "This song cannot be downloaded"
+		}
+		http.Error(w, reason, http.StatusForbidden)
+		return
+	}
+	rendition := chooseRendition(src.Renditions, decision.MaxQuality)
+	if rendition == nil {
+		http.Error(w, "Audio not available", http.StatusNotFound)
+		return
+	}
+
+	expires, err := h.licenseExpiry(subject.UserID)
+	if err != nil {
+		http.Error(w, "Failed to grant license", http.StatusInternalServerError)
+		return
+	}
+	license, err := h.Store.GrantOfflineLicense(subject.UserID, req.SongID, req.DeviceID, expires, maxOfflineLicenses)
+	if err != nil {
+		if errors.Is(err, database.ErrOfflineLimitReached) {
+			http.Error(w, fmt.Sprintf("You can download at most %d songs across your devices", maxOfflineLicenses), http.StatusConflict)
+		} else {
+			http.Error(w, "Failed to grant license", http.StatusInternalServerError)
+		}
+		return
+	}
+	license.DownloadURL, _ = signedAudioURL(h.Signer, subject.UserID, req.SongID, rendition, 0, true)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(license)
+}
+
+// HandleGetLicenses lists licenses, optionally of one device, so the app can
+// delete downloads that are no longer active.
+func (h *OfflineHandler) HandleGetLicenses(w http.ResponseWriter, r *http.Request) {
+	subject := entitlementSubject(r)
+	if subject.UserID == "" {
+		http.Error(w, "Could not get user ID from context", http.StatusInternalServerError)
+		return
+	}
+	licenses, err := h.Store.GetOfflineLicenses(subject.UserID, r.URL.Query().Get("device_id"))
+	if err != nil {
+		http.Error(w, "Failed to fetch licenses", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(licenses)
+}
+
+// HandleRenewLicenses extends the active licenses of a device. Apps call it
+// whenever they are online; it fails once the subscription has lapsed, so
+// downloads expire at the latest offlineLicenseTTL later.
+func (h *OfflineHandler) HandleRenewLicenses(w http.ResponseWriter, r *http.Request) {
+	subject := entitlementSubject(r)
+	if subject.UserID == "" {
+		http.Error(w, "Could not get user ID from context", http.StatusInternalServerError)
+		return
+	}
+	if !subject.Subscribed {
+		http.Error(w, "Offline downloads require a premium subscription", http.StatusForbidden)
+		return
+	}
+	var req RenewLicensesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.DeviceID = strings.TrimSpace(req.DeviceID)
+	if !validDeviceID(req.DeviceID) {
+		http.Error(w, "device_id of at most 100 characters is required", http.StatusBadRequest)
+		return
+	}
+	expires, err := h.licenseExpiry(subject.UserID)
+	if err == nil {
+		err = h.Store.RenewOfflineLicenses(subject.UserID, req.DeviceID, expires)
+	}
+	if err != nil {
+		http.Error(w, "Failed to renew licenses", http.StatusInternalServerError)
+		return
+	}
+	licenses, err := h.Store.GetOfflineLicenses(subject.UserID, req.DeviceID)
+	if err != nil {
+		http.Error(w, "Failed to fetch licenses", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(licenses)
+}
+
+// HandleRevokeLicense removes a download, freeing its place under the cap.
+func (h *OfflineHandler) HandleRevokeLicense(w http.ResponseWriter, r *http.Request) {
+	subject := entitlementSubject(r)
+	if subject.UserID == "" {
+		http.Error(w, "Could not get user ID from context", http.StatusInternalServerError)
+		return
+	}
+	if err := h.Store.RevokeOfflineLicense(subject.UserID, mux.Vars(r)["id"]); err != nil {
+		if errors.Is(err, sql.ErrNoRows) || strings.Contains(err.Error(), "invalid input syntax") {
+			http.Error(w, "License not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to revoke license", http.StatusInternalServerError)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "License revoked"})
+}
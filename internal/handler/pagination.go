@@ -0,0 +1,24 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 50
+)
+
+// parseLimit reads the "limit" query parameter, falling back to the default
+// page size and clamping it to maxPageLimit.
+func parseLimit(r *http.Request) int {
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 {
+		return defaultPageLimit
+	}
+	if limit > maxPageLimit {
+		return maxPageLimit
+	}
+	return limit
+}
@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"el-music-be/internal/database"
+	"el-music-be/internal/middleware"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const maxClockSkew = 5 * time.Minute
+
+var playContextTypes = map[string]bool{
+	"":         true,
+	"playlist": true,
+	"search":   true,
+	"album":    true,
+	"artist":   true,
+	"radio":    true,
+	"library":  true,
+}
+
+type PlayHandler struct {
+	Store *database.PostgresStore
+}
+
+func NewPlayHandler(store *database.PostgresStore) *PlayHandler {
+	return &PlayHandler{Store: store}
+}
+
+type RecordPlayRequest struct {
+	SongID      string     `json:"song_id"`
+	StartedAt   *time.Time `json:"started_at"`
+	MsPlayed    int        `json:"ms_played"`
+	ContextType string     `json:"context_type"`
+	ContextID   string     `json:"context_id"`
+	Device      string     `json:"device"`
+}
+
+func (h *PlayHandler) HandleRecordPlay(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Could not get user ID from context", http.StatusInternalServerError)
+		return
+	}
+	var req RecordPlayRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.SongID == "" {
+		http.Error(w, "song_id is required", http.StatusBadRequest)
+		return
+	}
+	if req.MsPlayed < 0 {
+		http.Error(w, "ms_played must not be negative", http.StatusBadRequest)
+		return
+	}
+	if !playContextTypes[req.ContextType] {
+		http.Error(w, "Invalid context_type", http.StatusBadRequest)
+		return
+	}
+	if len(req.Device) > 100 || len(req.ContextID) > 100 {
+		http.Error(w, "device and context_id must be at most 100 characters", http.StatusBadRequest)
+		return
+	}
+
+	startedAt := time.Now()
+	if req.StartedAt != nil {
+		if req.StartedAt.After(startedAt.Add(maxClockSkew)) {
+			http.Error(w, "started_at must not be in the future", http.StatusBadRequest)
+			return
+		}
+		startedAt = *req.StartedAt
+	}
+
+	event := &database.PlayEvent{
+		UserID:      userID,
+		SongID:      req.SongID,
+		StartedAt:   startedAt,
+		MsPlayed:    req.MsPlayed,
+		ContextType: req.ContextType,
+		ContextID:   req.ContextID,
+		Device:      req.Device,
+	}
+	if err := h.Store.CreatePlayEvent(event); err != nil {
+		if strings.Contains(err.Error(), "foreign key") || strings.Contains(err.Error(), "invalid input syntax") {
+			http.Error(w, "Song not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to record play", http.StatusInternalServerError)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(event)
+}
@@ -1,10 +1,13 @@
 package handler
 
 import (
+	"database/sql"
 	"el-music-be/internal/database"
 	"el-music-be/internal/middleware"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/gorilla/mux"
@@ -18,37 +21,71 @@ func NewPlaylistHandler(store *database.PostgresStore) *PlaylistHandler {
 	return &PlaylistHandler{Store: store}
 }
 
-type CreatePlaylistRequest struct {
-	Name string `json:"name"`
-}
-
+// AddSongRequest adds a song at Position, or at the end when it is left out.
+// SnapshotID, when set, must match the playlist's current snapshot. With
+// SkipDuplicates a song already in the playlist is rejected instead of added
+// again.
 type AddSongRequest struct {
-	SongID string `json:"song_id"`
+	SongID         string `json:"song_id"`
+	Position       *int   `json:"position"`
+	SnapshotID     string `json:"snapshot_id"`
+	SkipDuplicates bool   `json:"skip_duplicates"`
 }
 
-func (h *PlaylistHandler) HandleRemoveSongFromPlaylist(w http.ResponseWriter, r *http.Request) {
+const snapshotConflictMessage = "Playlist has changed since the given snapshot_id"
+
+// removeEntries runs a removal of playlist entries for the current user,
+// passing the ?snapshot_id= the client edited.
+func (h *PlaylistHandler) removeEntries(w http.ResponseWriter, r *http.Request, remove func(userID, snapshot string) (string, error)) {
 	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
 	if !ok {
 		http.Error(w, "Could not get user ID from context", http.StatusInternalServerError)
 		return
 	}
-	vars := mux.Vars(r)
-	playlistID := vars["playlistId"]
-	songID := vars["songId"]
-
-	err := h.Store.RemoveSongFromPlaylist(playlistID, songID, userID)
+	snapshot, err := remove(userID, r.URL.Query().Get("snapshot_id"))
 	if err != nil {
-		if strings.Contains(err.Error(), "user does not own this playlist") {
+		switch {
+		case errors.Is(err, database.ErrNotPlaylistOwner):
 			http.Error(w, "Forbidden", http.StatusForbidden)
-		} else {
-			http.Error(w, "Failed to remove song", http.StatusNotFound)
+		case errors.Is(err, database.ErrSnapshotMismatch):
+			http.Error(w, snapshotConflictMessage, http.StatusConflict)
+		case errors.Is(err, database.ErrPlaylistEntryNotFound), errors.Is(err, sql.ErrNoRows),
+			strings.Contains(err.Error(), "invalid input syntax"):
+			http.Error(w, "Song not found in playlist", http.StatusNotFound)
+		default:
+			http.Error(w, "Failed to remove song", http.StatusInternalServerError)
 		}
 		return
 	}
-
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Song removed from playlist successfully"})
+	json.NewEncoder(w).Encode(map[string]string{"message": "Song removed from playlist successfully", "snapshot_id": snapshot})
+}
+
+// HandleRemoveSongFromPlaylist removes every entry of a song.
+func (h *PlaylistHandler) HandleRemoveSongFromPlaylist(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	h.removeEntries(w, r, func(userID, snapshot string) (string, error) {
+		return h.Store.RemoveSongFromPlaylist(vars["playlistId"], vars["songId"], userID, snapshot)
+	})
+}
+
+func (h *PlaylistHandler) HandleRemovePlaylistEntry(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	h.removeEntries(w, r, func(userID, snapshot string) (string, error) {
+		return h.Store.RemovePlaylistEntry(vars["playlistId"], vars["entryId"], userID, snapshot)
+	})
+}
+
+func (h *PlaylistHandler) HandleRemovePlaylistPosition(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	position, err := strconv.Atoi(vars["position"])
+	if err != nil {
+		http.Error(w, "Invalid position", http.StatusBadRequest)
+		return
+	}
+	h.removeEntries(w, r, func(userID, snapshot string) (string, error) {
+		return h.Store.RemovePlaylistPosition(vars["playlistId"], position, userID, snapshot)
+	})
 }
 
 func (h *PlaylistHandler) HandleAddSongToPlaylist(w http.ResponseWriter, r *http.Request) {
@@ -64,12 +101,18 @@ func (h *PlaylistHandler) HandleAddSongToPlaylist(w http.ResponseWriter, r *http
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
-	err := h.Store.AddSongToPlaylist(playlistID, req.SongID, userID)
+	entryID, snapshot, err := h.Store.AddSongToPlaylist(playlistID, req.SongID, userID, req.Position, req.SnapshotID, req.SkipDuplicates)
 	if err != nil {
-		if strings.Contains(err.Error(), "user does not own this playlist") {
+		if errors.Is(err, database.ErrNotPlaylistOwner) {
 			http.Error(w, "Forbidden", http.StatusForbidden)
-		} else if strings.Contains(err.Error(), "duplicate key") {
+		} else if errors.Is(err, database.ErrSnapshotMismatch) {
+			http.Error(w, snapshotConflictMessage, http.StatusConflict)
+		} else if errors.Is(err, database.ErrSongInPlaylist) {
 			http.Error(w, "Song already in playlist", http.StatusConflict)
+		} else if errors.Is(err, database.ErrSongNotFound) {
+			http.Error(w, "Song not found", http.StatusNotFound)
+		} else if errors.Is(err, sql.ErrNoRows) || strings.Contains(err.Error(), "invalid input syntax") {
+			http.Error(w, "Playlist not found", http.StatusNotFound)
 		} else {
 			http.Error(w, "Failed to add song to playlist", http.StatusInternalServerError)
 		}
@@ -77,7 +120,11 @@ func (h *PlaylistHandler) HandleAddSongToPlaylist(w http.ResponseWriter, r *http
 	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Song added to playlist successfully"})
+	json.NewEncoder(w).Encode(map[string]string{
+		"message":     "Song added to playlist successfully",
+		"entry_id":    entryID,
+		"snapshot_id": snapshot,
+	})
 }
 
 func (h *PlaylistHandler) HandleGetUserPlaylists(w http.ResponseWriter, r *http.Request) {
@@ -101,12 +148,17 @@ func (h *PlaylistHandler) HandleCreatePlaylist(w http.ResponseWriter, r *http.Re
 		http.Error(w, "Could not get user ID from context", http.StatusInternalServerError)
 		return
 	}
-	var req CreatePlaylistRequest
+	var req database.PlaylistInput
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
-	playlist, err := h.Store.CreatePlaylist(req.Name, userID)
+	req.Normalize()
+	if err := req.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	playlist, err := h.Store.CreatePlaylist(&req, userID)
 	if err != nil {
 		http.Error(w, "Failed to create playlist", http.StatusInternalServerError)
 		return
@@ -132,3 +184,209 @@ func (h *PlaylistHandler) HandleGetPlaylistByID(w http.ResponseWriter, r *http.R
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(playlist)
 }
+
+// HandleUpdatePlaylist changes the name, description or cover of a playlist
+// the user owns. Fields left out of the body keep their value.
+func (h *PlaylistHandler) HandleUpdatePlaylist(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Could not get user ID from context", http.StatusInternalServerError)
+		return
+	}
+	var req database.PlaylistUpdate
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Normalize()
+	if err := req.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	playlist, err := h.Store.UpdatePlaylist(mux.Vars(r)["id"], userID, &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, database.ErrNotPlaylistOwner):
+			http.Error(w, "Forbidden", http.StatusForbidden)
+		case errors.Is(err, sql.ErrNoRows), strings.Contains(err.Error(), "invalid input syntax"):
+			http.Error(w, "Playlist not found", http.StatusNotFound)
+		default:
+			http.Error(w, "Failed to update playlist", http.StatusInternalServerError)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(playlist)
+}
+
+func (h *PlaylistHandler) HandleDeletePlaylist(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Could not get user ID from context", http.StatusInternalServerError)
+		return
+	}
+	if err := h.Store.DeletePlaylist(mux.Vars(r)["id"], userID); err != nil {
+		switch {
+		case errors.Is(err, database.ErrNotPlaylistOwner):
+			http.Error(w, "Forbidden", http.StatusForbidden)
+		case errors.Is(err, sql.ErrNoRows), strings.Contains(err.Error(), "invalid input syntax"):
+			http.Error(w, "Playlist not found", http.StatusNotFound)
+		default:
+			http.Error(w, "Failed to delete playlist", http.StatusInternalServerError)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Playlist deleted successfully"})
+}
+
+// HandleReorderPlaylist moves a range of songs to another position and
+// returns the new snapshot ID.
+func (h *PlaylistHandler) HandleReorderPlaylist(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Could not get user ID from context", http.StatusInternalServerError)
+		return
+	}
+	var req database.PlaylistMove
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Normalize()
+	if err := req.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	snapshot, err := h.Store.ReorderPlaylist(mux.Vars(r)["id"], userID, &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, database.ErrNotPlaylistOwner):
+			http.Error(w, "Forbidden", http.StatusForbidden)
+		case errors.Is(err, database.ErrSnapshotMismatch):
+			http.Error(w, snapshotConflictMessage, http.StatusConflict)
+		case errors.Is(err, database.ErrPlaylistRange):
+			http.Error(w, "range_start, range_length and insert_before must lie within the playlist", http.StatusBadRequest)
+		case errors.Is(err, sql.ErrNoRows), strings.Contains(err.Error(), "invalid input syntax"):
+			http.Error(w, "Playlist not found", http.StatusNotFound)
+		default:
+			http.Error(w, "Failed to reorder playlist", http.StatusInternalServerError)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"snapshot_id": snapshot})
+}
+
+// writeBatchError answers a failed batch edit of a playlist.
+func writeBatchError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, database.ErrNotPlaylistOwner):
+		http.Error(w, "Forbidden", http.StatusForbidden)
+	case errors.Is(err, database.ErrSnapshotMismatch):
+		http.Error(w, snapshotConflictMessage, http.StatusConflict)
+	case errors.Is(err, sql.ErrNoRows), strings.Contains(err.Error(), "invalid input syntax"):
+		http.Error(w, "Playlist not found", http.StatusNotFound)
+	default:
+		http.Error(w, "Failed to update playlist", http.StatusInternalServerError)
+	}
+}
+
+// HandleAddSongsToPlaylist adds up to database.MaxPlaylistBatch songs at
+// once and reports for each whether it was added.
+func (h *PlaylistHandler) HandleAddSongsToPlaylist(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Could not get user ID from context", http.StatusInternalServerError)
+		return
+	}
+	var req database.PlaylistBatchAdd
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Normalize()
+	if err := req.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	result, err := h.Store.AddSongsToPlaylist(mux.Vars(r)["id"], userID, &req)
+	if err != nil {
+		writeBatchError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// HandleRemovePlaylistEntries removes up to database.MaxPlaylistBatch entries
+// at once and reports for each whether it was removed.
+func (h *PlaylistHandler) HandleRemovePlaylistEntries(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Could not get user ID from context", http.StatusInternalServerError)
+		return
+	}
+	var req database.PlaylistBatchRemove
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Normalize()
+	if err := req.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	result, err := h.Store.RemovePlaylistEntries(mux.Vars(r)["id"], userID, &req)
+	if err != nil {
+		writeBatchError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// HandleGetSharedPlaylist opens a share link of an unlisted or public
+// playlist.
+func (h *PlaylistHandler) HandleGetSharedPlaylist(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Could not get user ID from context", http.StatusInternalServerError)
+		return
+	}
+	playlist, err := h.Store.GetSharedPlaylist(mux.Vars(r)["token"], userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Playlist not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to fetch playlist", http.StatusInternalServerError)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(playlist)
+}
+
+// HandleRegenerateShareToken gives a playlist a new share token, revoking
+// links that were shared with the old one.
+func (h *PlaylistHandler) HandleRegenerateShareToken(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Could not get user ID from context", http.StatusInternalServerError)
+		return
+	}
+	token, err := h.Store.RegenerateShareToken(mux.Vars(r)["id"], userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, database.ErrNotPlaylistOwner):
+			http.Error(w, "Forbidden", http.StatusForbidden)
+		case errors.Is(err, sql.ErrNoRows), strings.Contains(err.Error(), "invalid input syntax"):
+			http.Error(w, "Playlist not found", http.StatusNotFound)
+		default:
+			http.Error(w, "Failed to regenerate share token", http.StatusInternalServerError)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"share_token": token})
+}
@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"database/sql"
+	"el-music-be/internal/database"
+	"el-music-be/internal/middleware"
+	"el-music-be/internal/radio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+type RadioHandler struct {
+	Radio *radio.Engine
+}
+
+func NewRadioHandler(engine *radio.Engine) *RadioHandler {
+	return &RadioHandler{Radio: engine}
+}
+
+// queryIDs reads a parameter that may be repeated or hold comma separated
+// IDs.
+func queryIDs(r *http.Request, name string) []string {
+	var ids []string
+	for _, value := range r.URL.Query()[name] {
+		for _, id := range strings.Split(value, ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
+
+func (h *RadioHandler) writeStationPage(w http.ResponseWriter, r *http.Request, userID string, seed database.StationSeed) {
+	page, err := h.Radio.Page(userID, seed, r.URL.Query().Get("cursor"), parseLimit(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, database.ErrInvalidCursor):
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+		case strings.Contains(err.Error(), "invalid input syntax"):
+			http.Error(w, "Invalid seed", http.StatusBadRequest)
+		default:
+			http.Error(w, "Failed to fetch station", http.StatusInternalServerError)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+// HandleGetRadio returns a page of the station seeded by ?seed_song= and
+// ?seed_artist=. Follow next_cursor for more; the station does not end.
+func (h *RadioHandler) HandleGetRadio(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Could not get user ID from context", http.StatusInternalServerError)
+		return
+	}
+	seed := database.StationSeed{SongIDs: queryIDs(r, "seed_song"), ArtistIDs: queryIDs(r, "seed_artist")}
+	seeds := len(seed.SongIDs) + len(seed.ArtistIDs)
+	if seeds == 0 || seeds > radio.MaxSeeds {
+		http.Error(w, fmt.Sprintf("Between 1 and %d seed_song and seed_artist values are required", radio.MaxSeeds), http.StatusBadRequest)
+		return
+	}
+	h.writeStationPage(w, r, userID, seed)
+}
+
+// HandleGetAutoplay continues playback after a playlist or album ends, given
+// as ?context_type=playlist|album&context_id=.
+func (h *RadioHandler) HandleGetAutoplay(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Could not get user ID from context", http.StatusInternalServerError)
+		return
+	}
+	query := r.URL.Query()
+	seed, err := h.Radio.ContextSeed(userID, query.Get("context_type"), query.Get("context_id"))
+	if err != nil {
+		switch {
+		case errors.Is(err, radio.ErrUnknownContext):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, sql.ErrNoRows), strings.Contains(err.Error(), "invalid input syntax"):
+			http.Error(w, "Context not found", http.StatusNotFound)
+		default:
+			http.Error(w, "Failed to fetch station", http.StatusInternalServerError)
+		}
+		return
+	}
+	h.writeStationPage(w, r, userID, seed)
+}
@@ -2,8 +2,10 @@ package handler
 
 import (
 	"el-music-be/internal/database"
+	"el-music-be/internal/middleware"
 	"encoding/json"
 	"net/http"
+	"strings"
 )
 
 type SearchHandler struct {
@@ -15,6 +17,11 @@ func NewSearchHandler(store *database.PostgresStore) *SearchHandler {
 }
 
 func (h *SearchHandler) HandleSearchSongs(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Could not get user ID from context", http.StatusInternalServerError)
+		return
+	}
 	query := r.URL.Query().Get("q")
 	if query == "" {
 		// Return empty list if query is empty
@@ -23,7 +30,7 @@ func (h *SearchHandler) HandleSearchSongs(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	songs, err := h.Store.SearchSongs(query)
+	songs, err := h.Store.SearchSongs(query, userID)
 	if err != nil {
 		http.Error(w, "Failed to search songs", http.StatusInternalServerError)
 		return
@@ -32,3 +39,20 @@ func (h *SearchHandler) HandleSearchSongs(w http.ResponseWriter, r *http.Request
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(songs)
 }
+
+// HandleSearchPlaylists finds public playlists by name or description.
+func (h *SearchHandler) HandleSearchPlaylists(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]database.Playlist{})
+		return
+	}
+	playlists, err := h.Store.SearchPublicPlaylists(query, parseLimit(r))
+	if err != nil {
+		http.Error(w, "Failed to search playlists", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(playlists)
+}
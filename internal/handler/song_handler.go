@@ -1,37 +1,112 @@
 package handler
 
 import (
+	"database/sql"
 	"el-music-be/internal/database"
+	"el-music-be/internal/middleware"
+	"el-music-be/internal/recommend"
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
 )
 
+const relatedSongsLimit = 10
+
 type SongHandler struct {
-	Store *database.PostgresStore
+	Store       *database.PostgresStore
+	Recommender *recommend.Engine
+}
+
+func NewSongHandler(store *database.PostgresStore, recommender *recommend.Engine) *SongHandler {
+	return &SongHandler{Store: store, Recommender: recommender}
 }
 
-func NewSongHandler(store *database.PostgresStore) *SongHandler {
-	return &SongHandler{Store: store}
+type SetCategoriesRequest struct {
+	CategoryIDs []string `json:"category_ids"`
 }
 
 func (h *SongHandler) HandleGetRecentlyPlayed(w http.ResponseWriter, r *http.Request) {
-	songs, err := h.Store.GetRecentlyPlayed()
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Could not get user ID from context", http.StatusInternalServerError)
+		return
+	}
+	page, err := h.Store.GetRecentlyPlayed(userID, r.URL.Query().Get("cursor"), parseLimit(r))
 	if err != nil {
-		http.Error(w, "Failed to fetch songs", http.StatusInternalServerError)
+		if errors.Is(err, database.ErrInvalidCursor) {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+		} else {
+			http.Error(w, "Failed to fetch songs", http.StatusInternalServerError)
+		}
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(songs)
+	json.NewEncoder(w).Encode(page)
 }
 
 func (h *SongHandler) HandleGetMadeForYou(w http.ResponseWriter, r *http.Request) {
-	songs, err := h.Store.GetMadeForYou()
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Could not get user ID from context", http.StatusInternalServerError)
+		return
+	}
+	mixes, err := h.Recommender.MixesForUser(userID)
+	if err != nil {
+		http.Error(w, "Failed to fetch mixes", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(mixes)
+}
+
+func (h *SongHandler) HandleGetMyCategories(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Could not get user ID from context", http.StatusInternalServerError)
+		return
+	}
+	categories, err := h.Store.GetUserCategories(userID)
 	if err != nil {
-		http.Error(w, "Failed to fetch songs", http.StatusInternalServerError)
+		http.Error(w, "Failed to fetch categories", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(categories)
+}
+
+func (h *SongHandler) HandleSetMyCategories(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Could not get user ID from context", http.StatusInternalServerError)
+		return
+	}
+	var req SetCategoriesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
+	if err := h.Store.SetUserCategories(userID, req.CategoryIDs); err != nil {
+		if strings.Contains(err.Error(), "foreign key") || strings.Contains(err.Error(), "invalid input syntax") {
+			http.Error(w, "Invalid categories", http.StatusBadRequest)
+		} else {
+			http.Error(w, "Failed to update categories", http.StatusInternalServerError)
+		}
+		return
+	}
+	// Users without history get their mixes from these categories, so do not
+	// make them wait for the next background run.
+	go func() {
+		if err := h.Recommender.RecomputeUser(userID); err != nil {
+			log.Printf("Could not compute mixes for user %s: %v", userID, err)
+		}
+	}()
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(songs)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Categories updated successfully"})
 }
 
 func (h *SongHandler) HandleGetSearchCategories(w http.ResponseWriter, r *http.Request) {
@@ -43,3 +118,89 @@ func (h *SongHandler) HandleGetSearchCategories(w http.ResponseWriter, r *http.R
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(categories)
 }
+
+// HandleGetSongAnalysis returns the waveform and audio features of a song.
+// ?points= narrows the waveform to the level with that many peaks.
+func (h *SongHandler) HandleGetSongAnalysis(w http.ResponseWriter, r *http.Request) {
+	analysis, err := h.Store.GetSongAnalysis(mux.Vars(r)["id"])
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) || strings.Contains(err.Error(), "invalid input syntax") {
+			http.Error(w, "Analysis not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to fetch analysis", http.StatusInternalServerError)
+		}
+		return
+	}
+	if points := r.URL.Query().Get("points"); points != "" {
+		n, err := strconv.Atoi(points)
+		if err != nil {
+			http.Error(w, "Invalid points", http.StatusBadRequest)
+			return
+		}
+		var levels []database.WaveformLevel
+		for _, level := range analysis.Waveform {
+			if level.Points == n {
+				levels = append(levels, level)
+			}
+		}
+		if levels == nil {
+			http.Error(w, "No waveform with that many points", http.StatusNotFound)
+			return
+		}
+		analysis.Waveform = levels
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(analysis)
+}
+
+// HandleGetSong returns the song page. It supports conditional GET, so
+// clients can revalidate a cached copy with If-None-Match.
+func (h *SongHandler) HandleGetSong(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Could not get user ID from context", http.StatusInternalServerError)
+		return
+	}
+	song, err := h.Store.GetSongDetail(mux.Vars(r)["id"], userID, relatedSongsLimit)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) || strings.Contains(err.Error(), "invalid input syntax") {
+			http.Error(w, "Song not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to fetch song", http.StatusInternalServerError)
+		}
+		return
+	}
+	writeJSONWithETag(w, r, song)
+}
+
+// HandleGetCategory returns a category page: a page of its songs and the
+// playlists curated for it.
+func (h *SongHandler) HandleGetCategory(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Could not get user ID from context", http.StatusInternalServerError)
+		return
+	}
+	categoryID := mux.Vars(r)["id"]
+	category, err := h.Store.GetCategory(categoryID)
+	if err != nil {
+		http.Error(w, "Category not found", http.StatusNotFound)
+		return
+	}
+	songs, err := h.Store.GetCategorySongs(categoryID, userID, r.URL.Query().Get("cursor"), parseLimit(r))
+	if err != nil {
+		if errors.Is(err, database.ErrInvalidCursor) {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+		} else {
+			http.Error(w, "Failed to fetch songs", http.StatusInternalServerError)
+		}
+		return
+	}
+	playlists, err := h.Store.GetCategoryPlaylists(categoryID)
+	if err != nil {
+		http.Error(w, "Failed to fetch playlists", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(database.CategoryPage{Category: *category, Songs: songs, Playlists: playlists})
+}
@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"database/sql"
+	"el-music-be/internal/middleware"
+	"el-music-be/internal/stats"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+type StatsHandler struct {
+	Stats *stats.Summarizer
+}
+
+func NewStatsHandler(summarizer *stats.Summarizer) *StatsHandler {
+	return &StatsHandler{Stats: summarizer}
+}
+
+// HandleGetMyStats returns the user's top songs, artists and categories and
+// minutes listened over ?range=4w|6m|all, 4w by default.
+func (h *StatsHandler) HandleGetMyStats(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Could not get user ID from context", http.StatusInternalServerError)
+		return
+	}
+	statsRange := r.URL.Query().Get("range")
+	if statsRange == "" {
+		statsRange = stats.RangeFourWeeks
+	}
+	result, err := h.Stats.Stats(userID, statsRange)
+	if err != nil {
+		if errors.Is(err, stats.ErrInvalidRange) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "Failed to fetch stats", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// HandleGetMyWrapped returns the user's published recap of a year.
+func (h *StatsHandler) HandleGetMyWrapped(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok {
+		http.Error(w, "Could not get user ID from context", http.StatusInternalServerError)
+		return
+	}
+	year, err := strconv.Atoi(mux.Vars(r)["year"])
+	if err != nil {
+		http.Error(w, "Invalid year", http.StatusBadRequest)
+		return
+	}
+	recap, err := h.Stats.Store.GetWrappedRecap(userID, year)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Recap not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to fetch recap", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(recap)
+}
+
+// HandleGetSharedWrapped returns a recap by its share token. It needs no
+// login so shared cards open for anyone.
+func (h *StatsHandler) HandleGetSharedWrapped(w http.ResponseWriter, r *http.Request) {
+	recap, err := h.Stats.Store.GetSharedWrappedRecap(mux.Vars(r)["token"])
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Recap not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to fetch recap", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(recap)
+}
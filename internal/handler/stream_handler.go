@@ -0,0 +1,422 @@
+package handler
+
+import (
+	"el-music-be/internal/audio"
+	"el-music-be/internal/database"
+	"el-music-be/internal/entitlement"
+	"el-music-be/internal/middleware"
+	"el-music-be/internal/storage"
+	"el-music-be/internal/streaming"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// minStreamedMs is how much of a song has to be served before the stream
+// counts as a play.
+const minStreamedMs = 30000
+
+type StreamHandler struct {
+	Store   *database.PostgresStore
+	Storage storage.Backend
+	Signer  *streaming.Signer
+	Policy  *entitlement.Policy
+
+	mu        sync.Mutex
+	playbacks map[string]*playback
+}
+
+// playback is what one signed URL or HLS session has been served so far. It
+// is kept in memory, so when requests of one playback are spread over several
+// servers each only counts what it served itself and a play may not be logged.
+type playback struct {
+	served  int64
+	logged  bool
+	expires time.Time
+}
+
+func NewStreamHandler(store *database.PostgresStore, backend storage.Backend, signer *streaming.Signer, policy *entitlement.Policy) *StreamHandler {
+	h := &StreamHandler{Store: store, Storage: backend, Signer: signer, Policy: policy, playbacks: make(map[string]*playback)}
+	go h.prunePlaybacks(time.Minute)
+	return h
+}
+
+type StreamURLResponse struct {
+	URL       string              `json:"url"`
+	ExpiresAt time.Time           `json:"expires_at"`
+	Quality   entitlement.Quality `json:"quality"`
+	PreviewMs int                 `json:"preview_ms,omitempty"`
+}
+
+// streamResource is what a stream URL grants access to. Quality, preview
+// length and whether it is an offline download are part of it, so they cannot
+// be changed without the signature breaking.
+func streamResource(songID, quality string, previewMs int, download bool) string {
+	if download {
+		return fmt.Sprintf("download:%s:%s:%d", songID, quality, previewMs)
+	}
+	return fmt.Sprintf("song:%s:%s:%d", songID, quality, previewMs)
+}
+
+// signedAudioURL returns a URL for HandleStreamAudio that is valid for the
+// signer's TTL.
+func signedAudioURL(signer *streaming.Signer, userID, songID string, rendition *database.Rendition, previewMs int, download bool) (string, time.Time) {
+	query, expires := signer.Sign(streamResource(songID, rendition.Quality, previewMs, download), userID, time.Now())
+	query.Set("quality", rendition.Quality)
+	query.Set("preview", strconv.Itoa(previewMs))
+	if download {
+		query.Set("download", "1")
+	}
+	return "/api/v1/stream/" + songID + "/audio?" + query.Encode(), expires
+}
+
+func entitlementSubject(r *http.Request) entitlement.Subject {
+	userID, _ := r.Context().Value(middleware.UserIDKey).(string)
+	isSubscribed, _ := r.Context().Value(middleware.IsSubscribedKey).(bool)
+	return entitlement.Subject{UserID: userID, Subscribed: isSubscribed}
+}
+
+func streamContent(src *database.StreamSource) entitlement.Content {
+	return entitlement.Content{
+		SongID:      src.SongID,
+		DurationMs:  src.DurationMs,
+		PremiumOnly: src.PremiumOnly,
+		Explicit:    src.Explicit,
+	}
+}
+
+// chooseRendition returns the best rendition that does not exceed maxQuality.
+// Songs uploaded only as lossless or high bitrate files have nothing at
+// standard quality, so when every rendition is above maxQuality the lowest
+// one is played rather than none.
+func chooseRendition(renditions []database.Rendition, maxQuality entitlement.Quality) *database.Rendition {
+	var best, lowest *database.Rendition
+	for i := range renditions {
+		rank := entitlement.Quality(renditions[i].Quality).Rank()
+		if rank == 0 {
+			continue
+		}
+		if lowest == nil || rank < entitlement.Quality(lowest.Quality).Rank() ||
+			(rank == entitlement.Quality(lowest.Quality).Rank() && renditions[i].BitrateKbps < lowest.BitrateKbps) {
+			lowest = &renditions[i]
+		}
+		if rank > maxQuality.Rank() {
+			continue
+		}
+		if best == nil || rank > entitlement.Quality(best.Quality).Rank() ||
+			(rank == entitlement.Quality(best.Quality).Rank() && renditions[i].BitrateKbps > best.BitrateKbps) {
+			best = &renditions[i]
+		}
+	}
+	if best == nil {
+		return lowest
+	}
+	return best
+}
+
+// HandleGetStreamURL issues a short-lived signed URL for the audio of a song,
+// at the quality and length the listener is entitled to.
+func (h *StreamHandler) HandleGetStreamURL(w http.ResponseWriter, r *http.Request) {
+	subject := entitlementSubject(r)
+	if subject.UserID == "" {
+		http.Error(w, "Could not get user ID from context", http.StatusInternalServerError)
+		return
+	}
+	songID := mux.Vars(r)["songId"]
+	src, err := h.Store.GetStreamSource(songID)
+	if err != nil {
+		http.Error(w, "Song not found", http.StatusNotFound)
+		return
+	}
+	decision := h.Policy.Decide(subject, streamContent(src))
+	if !decision.Allowed {
+		http.Error(w, decision.Reason, http.StatusForbidden)
+		return
+	}
+	rendition := chooseRendition(src.Renditions, decision.MaxQuality)
+	if rendition == nil {
+		http.Error(w, "Audio not available", http.StatusNotFound)
+		return
+	}
+
+	url, expires := signedAudioURL(h.Signer, subject.UserID, songID, rendition, decision.PreviewMs, false)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(StreamURLResponse{
+		URL:       url,
+		ExpiresAt: expires,
+		Quality:   entitlement.Quality(rendition.Quality),
+		PreviewMs: decision.PreviewMs,
+	})
+}
+
+// HandleStreamAudio serves the audio behind a signed URL. It needs no
+// Authorization header, so audio elements can load it directly.
+func (h *StreamHandler) HandleStreamAudio(w http.ResponseWriter, r *http.Request) {
+	songID := mux.Vars(r)["songId"]
+	query := r.URL.Query()
+	quality := query.Get("quality")
+	previewMs, _ := strconv.Atoi(query.Get("preview"))
+	download := query.Get("download") == "1"
+	userID, err := h.Signer.Verify(streamResource(songID, quality, previewMs, download), query, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	// Looking the song up again means deleting or unpublishing it revokes
+	// URLs that have not expired yet.
+	src, err := h.Store.GetStreamSource(songID)
+	if err != nil {
+		http.Error(w, "Song not found", http.StatusNotFound)
+		return
+	}
+	var rendition *database.Rendition
+	for i := range src.Renditions {
+		if src.Renditions[i].Quality == quality {
+			rendition = &src.Renditions[i]
+		}
+	}
+	if rendition == nil {
+		http.Error(w, "Audio not available", http.StatusNotFound)
+		return
+	}
+	// External audio cannot be cut to a preview, so it is only played
+	// whole.
+	if rendition.ExternalURL != "" {
+		if previewMs > 0 {
+			http.Error(w, "Audio not available", http.StatusNotFound)
+			return
+		}
+		h.proxyExternalAudio(w, r, userID, src, rendition.ExternalURL, download)
+		return
+	}
+	object, info, err := h.Storage.Open(rendition.AudioKey)
+	if err != nil {
+		log.Printf("Could not open audio of song %s: %v", songID, err)
+		http.Error(w, "Audio not available", http.StatusNotFound)
+		return
+	}
+	defer object.Close()
+
+	etag := fmt.Sprintf(`"%s-%s-%x-%x"`, src.SongID, quality, info.Size, info.ModTime.UnixNano())
+	var content io.ReadSeeker = object
+	size := info.Size
+	if previewMs > 0 {
+		size = previewLength(object, rendition.AudioFormat, info.Size, src.DurationMs, previewMs)
+		content = &limitedReadSeeker{r: object, size: size}
+		etag = fmt.Sprintf(`"%s-%s-%x-%x-p%d"`, src.SongID, quality, info.Size, info.ModTime.UnixNano(), previewMs)
+	}
+
+	contentType := audio.ContentType(rendition.AudioFormat)
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "private, max-age=0")
+	cw := &countingWriter{ResponseWriter: w}
+	http.ServeContent(cw, r, "", info.ModTime, content)
+
+	// Previews are samples and downloads are stored for later, not plays.
+	if r.Method == http.MethodGet && cw.written > 0 && previewMs == 0 && !download {
+		h.maybeLogPlay(r, userID, src, size, cw.written)
+	}
+}
+
+// proxyExternalAudio streams audio that is still hosted at a song's external
+// song_url through this handler, forwarding the Range header, so listeners
+// never learn the URL and access ends with the signed URL like it does for
+// stored audio.
+func (h *StreamHandler) proxyExternalAudio(w http.ResponseWriter, r *http.Request, userID string, src *database.StreamSource, externalURL string, download bool) {
+	req, err := http.NewRequestWithContext(r.Context(), r.Method, externalURL, nil)
+	if err != nil {
+		log.Printf("Invalid external audio URL of song %s: %v", src.SongID, err)
+		http.Error(w, "Audio not available", http.StatusNotFound)
+		return
+	}
+	if rangeHeader := r.Header.Get("Range"); rangeHeader != "" {
+		req.Header.Set("Range", rangeHeader)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Printf("Could not fetch external audio of song %s: %v", src.SongID, err)
+		http.Error(w, "Audio not available", http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent &&
+		resp.StatusCode != http.StatusRequestedRangeNotSatisfiable {
+		log.Printf("External audio of song %s answered %s", src.SongID, resp.Status)
+		http.Error(w, "Audio not available", http.StatusBadGateway)
+		return
+	}
+
+	for _, name := range []string{"Content-Type", "Content-Length", "Content-Range", "Accept-Ranges", "Last-Modified"} {
+		if value := resp.Header.Get(name); value != "" {
+			w.Header().Set(name, value)
+		}
+	}
+	w.Header().Set("Cache-Control", "private, max-age=0")
+	w.WriteHeader(resp.StatusCode)
+	cw := &countingWriter{ResponseWriter: w}
+	io.Copy(cw, resp.Body)
+
+	size := resp.ContentLength
+	if _, total, found := strings.Cut(resp.Header.Get("Content-Range"), "/"); found {
+		size, _ = strconv.ParseInt(total, 10, 64)
+	}
+	if r.Method == http.MethodGet && cw.written > 0 && !download {
+		h.maybeLogPlay(r, userID, src, size, cw.written)
+	}
+}
+
+// previewLength estimates how many bytes hold the first previewMs of audio,
+// assuming a constant bitrate after any leading ID3 tag.
+func previewLength(object io.ReadSeeker, format string, size int64, durationMs, previewMs int) int64 {
+	if durationMs <= 0 || previewMs >= durationMs {
+		return size
+	}
+	var leading int64
+	if format == audio.FormatMP3 {
+		header := make([]byte, 10)
+		if _, err := io.ReadFull(object, header); err == nil {
+			leading = min(audio.ID3v2Size(header), size)
+		}
+	}
+	return leading + (size-leading)*int64(previewMs)/int64(durationMs)
+}
+
+// maybeLogPlay adds the bytes written by one request to what its signed URL
+// has served and records a play once that total reaches minStreamedMs of
+// audio. Players fetch a song in many range requests, and a single request
+// for a range late in the file does not count as listening to it.
+func (h *StreamHandler) maybeLogPlay(r *http.Request, userID string, src *database.StreamSource, size, written int64) {
+	if size <= 0 || src.DurationMs <= 0 {
+		return
+	}
+	key := r.URL.Query().Get("sig")
+	served := h.addServed(key, written)
+	threshold := size * int64(min(minStreamedMs, src.DurationMs)) / int64(src.DurationMs)
+	if served < threshold {
+		return
+	}
+	msPlayed := int(min(served, size) * int64(src.DurationMs) / size)
+	h.recordPlayOnce(key, userID, src.SongID, msPlayed)
+}
+
+// addServed adds amount to what the playback under key has been served and
+// returns the new total.
+func (h *StreamHandler) addServed(key string, amount int64) int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	p := h.playbackLocked(key)
+	p.served += amount
+	return p.served
+}
+
+// playbackLocked returns the playback under key, creating it if needed. h.mu
+// must be held.
+func (h *StreamHandler) playbackLocked(key string) *playback {
+	p, ok := h.playbacks[key]
+	if !ok {
+		p = &playback{expires: time.Now().Add(h.Signer.TTL)}
+		h.playbacks[key] = p
+	}
+	return p
+}
+
+// prunePlaybacks drops playbacks whose URLs have expired every interval,
+// forever.
+func (h *StreamHandler) prunePlaybacks(interval time.Duration) {
+	for range time.Tick(interval) {
+		now := time.Now()
+		h.mu.Lock()
+		for key, p := range h.playbacks {
+			if now.After(p.expires) {
+				delete(h.playbacks, key)
+			}
+		}
+		h.mu.Unlock()
+	}
+}
+
+// recordPlayOnce logs a play unless one was already logged under key, which
+// identifies one playback such as a signed URL or an HLS session.
+func (h *StreamHandler) recordPlayOnce(key, userID, songID string, msPlayed int) {
+	now := time.Now()
+	h.mu.Lock()
+	p := h.playbackLocked(key)
+	done := p.logged
+	p.logged = true
+	h.mu.Unlock()
+	if done {
+		return
+	}
+
+	event := &database.PlayEvent{
+		UserID:    userID,
+		SongID:    songID,
+		StartedAt: now,
+		MsPlayed:  msPlayed,
+		Device:    "stream",
+	}
+	if err := h.Store.CreatePlayEvent(event); err != nil {
+		log.Printf("Could not record streamed play of song %s: %v", songID, err)
+	}
+}
+
+// limitedReadSeeker exposes only the first size bytes of r.
+type limitedReadSeeker struct {
+	r    io.ReadSeeker
+	size int64
+	pos  int64
+}
+
+func (l *limitedReadSeeker) Read(p []byte) (int, error) {
+	if l.pos >= l.size {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > l.size-l.pos {
+		p = p[:l.size-l.pos]
+	}
+	n, err := l.r.Read(p)
+	l.pos += int64(n)
+	return n, err
+}
+
+func (l *limitedReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += l.pos
+	case io.SeekEnd:
+		offset += l.size
+	}
+	if offset < 0 {
+		return 0, errors.New("seek before start of file")
+	}
+	if _, err := l.r.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+	l.pos = offset
+	return offset, nil
+}
+
+type countingWriter struct {
+	http.ResponseWriter
+	written int64
+}
+
+func (w *countingWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	w.written += int64(n)
+	return n, err
+}
@@ -0,0 +1,137 @@
+package hls
+
+import (
+	"bytes"
+	"el-music-be/internal/database"
+	"el-music-be/internal/storage"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	DefaultSegmentDuration = 6 * time.Second
+	packageBatchSize       = 100
+)
+
+// SegmentKey is the storage key of a segment in a package.
+func SegmentKey(prefix string, index int) string {
+	return fmt.Sprintf("%s/%d.mp3", prefix, index)
+}
+
+// Packager segments renditions that have no up-to-date HLS package.
+type Packager struct {
+	Store           *database.PostgresStore
+	Storage         storage.Backend
+	SegmentDuration time.Duration
+}
+
+func NewPackager(store *database.PostgresStore, backend storage.Backend) *Packager {
+	return &Packager{Store: store, Storage: backend, SegmentDuration: DefaultSegmentDuration}
+}
+
+// Run packages pending renditions every interval, forever.
+func (p *Packager) Run(interval time.Duration) {
+	for {
+		if err := p.PackagePending(); err != nil {
+			log.Printf("HLS packaging job failed: %v", err)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// PackagePending packages one batch of pending renditions. Renditions that
+// fail with a storage error are logged and retried later.
+func (p *Packager) PackagePending() error {
+	pending, err := p.Store.GetUnpackagedRenditions(packageBatchSize)
+	if err != nil {
+		return err
+	}
+	for _, r := range pending {
+		if err := p.PackageRendition(r); err != nil {
+			log.Printf("Could not package %s rendition of song %s: %v", r.Quality, r.SongID, err)
+		}
+	}
+	return nil
+}
+
+// PackageRendition segments one rendition into a fresh key prefix, so players
+// still fetching the previous package are not affected, then swaps the
+// package in and deletes the old segments. A file that cannot be segmented is
+// recorded as a failed package. Storage errors are recorded as failures to
+// retry later, so a missing file does not hold up the queue, and returned.
+func (p *Packager) PackageRendition(r database.PendingRendition) error {
+	pkg := &database.HLSPackage{
+		SongID:    r.SongID,
+		Quality:   r.Quality,
+		SourceKey: r.AudioKey,
+		KeyPrefix: fmt.Sprintf("hls/%s/%s-%s", r.SongID, r.Quality, uuid.New().String()[:8]),
+	}
+	object, _, err := p.Storage.Open(r.AudioKey)
+	if err != nil {
+		return p.retryLater(pkg, err)
+	}
+	written := 0
+	var storageErr error
+	durations, info, err := SegmentMP3(object, p.SegmentDuration, func(index int, data []byte) error {
+		if _, storageErr = p.Storage.Put(SegmentKey(pkg.KeyPrefix, index), bytes.NewReader(data)); storageErr != nil {
+			return storageErr
+		}
+		written++
+		return nil
+	})
+	object.Close()
+	if err != nil {
+		p.deleteSegments(pkg.KeyPrefix, written)
+		if storageErr != nil {
+			return p.retryLater(pkg, storageErr)
+		}
+		log.Printf("Could not package %s rendition of song %s: %v", r.Quality, r.SongID, err)
+		pkg.KeyPrefix = ""
+		pkg.Error = err.Error()
+	} else {
+		pkg.SegmentDurations = durations
+		pkg.BitrateKbps = info.BitrateKbps
+		pkg.SampleRate = info.SampleRate
+		pkg.Channels = info.Channels
+	}
+
+	previous, err := p.Store.SaveHLSPackage(pkg)
+	if err != nil {
+		p.deleteSegments(pkg.KeyPrefix, len(pkg.SegmentDurations))
+		return err
+	}
+	if previous != nil && previous.KeyPrefix != "" {
+		p.deleteSegments(previous.KeyPrefix, len(previous.SegmentDurations))
+	}
+	return nil
+}
+
+// retryLater records a storage failure so the rendition is packaged again
+// after a while, and returns the failure.
+func (p *Packager) retryLater(pkg *database.HLSPackage, failure error) error {
+	pkg.KeyPrefix = ""
+	pkg.Error = failure.Error()
+	pkg.RetryLater = true
+	previous, err := p.Store.SaveHLSPackage(pkg)
+	if err != nil {
+		return err
+	}
+	if previous != nil && previous.KeyPrefix != "" {
+		p.deleteSegments(previous.KeyPrefix, len(previous.SegmentDurations))
+	}
+	return failure
+}
+
+func (p *Packager) deleteSegments(prefix string, count int) {
+	if prefix == "" {
+		return
+	}
+	for i := 0; i < count; i++ {
+		if err := p.Storage.Delete(SegmentKey(prefix, i)); err != nil {
+			log.Printf("Could not delete HLS segment %s: %v", SegmentKey(prefix, i), err)
+		}
+	}
+}
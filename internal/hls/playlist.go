@@ -0,0 +1,58 @@
+package hls
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+const ContentType = "application/vnd.apple.mpegurl"
+
+type Variant struct {
+	URI          string
+	BandwidthBps int
+}
+
+// MasterPlaylist lists the renditions a player can switch between.
+func MasterPlaylist(variants []Variant) string {
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-INDEPENDENT-SEGMENTS\n")
+	for _, v := range variants {
+		fmt.Fprintf(&b, "#EXT-X-STREAM-INF:BANDWIDTH=%d,CODECS=\"%s\"\n%s\n", v.BandwidthBps, Codecs, v.URI)
+	}
+	return b.String()
+}
+
+// MediaPlaylist lists the segments of one rendition; uri returns the URI of
+// the segment at an index.
+func MediaPlaylist(durations []float64, uri func(index int) string) string {
+	target := 1.0
+	for _, d := range durations {
+		target = math.Max(target, d)
+	}
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n")
+	fmt.Fprintf(&b, "#EXT-X-TARGETDURATION:%d\n", int(math.Ceil(target)))
+	b.WriteString("#EXT-X-MEDIA-SEQUENCE:0\n#EXT-X-PLAYLIST-TYPE:VOD\n")
+	for i, d := range durations {
+		fmt.Fprintf(&b, "#EXTINF:%.3f,\n%s\n", d, uri(i))
+	}
+	b.WriteString("#EXT-X-ENDLIST\n")
+	return b.String()
+}
+
+// SegmentsFor returns how many segments are needed to cover the first ms
+// milliseconds, or all of them when ms is 0.
+func SegmentsFor(durations []float64, ms int) int {
+	if ms <= 0 {
+		return len(durations)
+	}
+	var elapsed float64
+	for i, d := range durations {
+		if elapsed*1000 >= float64(ms) {
+			return i
+		}
+		elapsed += d
+	}
+	return len(durations)
+}
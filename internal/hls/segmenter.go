@@ -0,0 +1,112 @@
+// Package hls packages songs for HTTP Live Streaming without ffmpeg: MP3
+// renditions are cut into packed audio segments at frame boundaries, and
+// playlists are rendered on request so every session gets its own signed
+// segment URLs.
+//
+// Nothing is transcoded. The bitrate ladder of a song is the MP3 renditions
+// uploaded for it, usually one standard and one high quality file. Songs
+// that only have FLAC, WAV, M4A or OGG renditions, or only an external
+// song_url, get no HLS package and are played through the progressive stream
+// URL instead.
+package hls
+
+import (
+	"bytes"
+	"el-music-be/internal/audio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+)
+
+// Codecs is the RFC 6381 codec string of MP3 audio.
+const Codecs = "mp4a.40.34"
+
+// StreamInfo describes the audio that was segmented.
+type StreamInfo struct {
+	SampleRate  int
+	Channels    int
+	BitrateKbps int
+}
+
+// SegmentMP3 cuts an MP3 stream into segments of about target length,
+// starting each at a frame boundary, and passes every segment to write.
+// Each segment starts with the ID3 timestamp tag that packed audio segments
+// need so players can line them up. It returns the segment durations in
+// seconds.
+func SegmentMP3(r io.Reader, target time.Duration, write func(index int, data []byte) error) ([]float64, StreamInfo, error) {
+	var (
+		info          StreamInfo
+		durations     []float64
+		buf           bytes.Buffer
+		totalSamples  int64
+		segmentStart  int64
+		segmentFrames int
+		totalBytes    int64
+	)
+	flush := func() error {
+		if segmentFrames == 0 {
+			return nil
+		}
+		pts := segmentStart * 90000 / int64(info.SampleRate)
+		data := append(timestampTag(pts), buf.Bytes()...)
+		if err := write(len(durations), data); err != nil {
+			return err
+		}
+		durations = append(durations, float64(totalSamples-segmentStart)/float64(info.SampleRate))
+		buf.Reset()
+		segmentStart = totalSamples
+		segmentFrames = 0
+		return nil
+	}
+	targetSeconds := target.Seconds()
+	err := audio.ReadMPEGFrames(r, func(h audio.FrameHeader, frame []byte) error {
+		if info.SampleRate == 0 {
+			info.SampleRate, info.Channels = h.SampleRate, h.Channels
+		}
+		// Frames that change the sample rate mid stream are junk that
+		// happened to look like a header.
+		if h.SampleRate != info.SampleRate {
+			return nil
+		}
+		buf.Write(frame)
+		segmentFrames++
+		totalSamples += int64(h.SamplesPerFrame)
+		totalBytes += int64(len(frame))
+		if float64(totalSamples-segmentStart)/float64(info.SampleRate) >= targetSeconds {
+			return flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, info, err
+	}
+	if err := flush(); err != nil {
+		return nil, info, err
+	}
+	if len(durations) == 0 {
+		return nil, info, errors.New("no MPEG audio frames found")
+	}
+	info.BitrateKbps = int(totalBytes * 8 * int64(info.SampleRate) / totalSamples / 1000)
+	return durations, info, nil
+}
+
+// timestampTag builds the ID3v2.4 tag with the PRIV frame that carries the
+// 33 bit MPEG-2 presentation timestamp of the first sample in a segment.
+func timestampTag(pts int64) []byte {
+	owner := "com.apple.streaming.transportStreamTimestamp\x00"
+	body := make([]byte, len(owner)+8)
+	copy(body, owner)
+	binary.BigEndian.PutUint64(body[len(owner):], uint64(pts)&0x1FFFFFFFF)
+
+	frame := append([]byte("PRIV"), syncsafe(len(body))...)
+	frame = append(frame, 0, 0)
+	frame = append(frame, body...)
+
+	tag := append([]byte{'I', 'D', '3', 4, 0, 0}, syncsafe(len(frame))...)
+	return append(tag, frame...)
+}
+
+func syncsafe(n int) []byte {
+	return []byte{byte(n >> 21 & 0x7f), byte(n >> 14 & 0x7f), byte(n >> 7 & 0x7f), byte(n & 0x7f)}
+}
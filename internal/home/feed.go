@@ -0,0 +1,142 @@
+// Package home assembles the home screen from the shelves editors configure.
+package home
+
+import (
+	"database/sql"
+	"el-music-be/internal/database"
+	"errors"
+	"log"
+	"strings"
+	"time"
+)
+
+const newReleaseWindow = 28 * 24 * time.Hour
+
+// defaultChartType is shown by chart shelves that do not name a chart.
+const defaultChartType = database.ChartWeekly
+
+// Listener is who the home screen is built for.
+type Listener struct {
+	UserID     string
+	Country    string
+	Subscribed bool
+}
+
+// Shelf is one row of the home screen. Only the field matching Kind is set.
+type Shelf struct {
+	ID         string              `json:"id"`
+	Kind       string              `json:"kind"`
+	Title      string              `json:"title"`
+	Songs      []database.Song     `json:"songs,omitempty"`
+	Mixes      []database.Mix      `json:"mixes,omitempty"`
+	Playlists  []database.Playlist `json:"playlists,omitempty"`
+	Categories []database.Category `json:"categories,omitempty"`
+}
+
+type Feed struct {
+	Store *database.PostgresStore
+}
+
+func NewFeed(store *database.PostgresStore) *Feed {
+	return &Feed{Store: store}
+}
+
+// Build returns the shelves that target the listener, in order. Shelves that
+// turn out empty are left out, and a shelf that fails to load is logged and
+// left out rather than failing the whole screen.
+func (f *Feed) Build(listener Listener) ([]Shelf, error) {
+	configs, err := f.Store.GetHomeShelvesFor(listener.Country, listener.Subscribed)
+	if err != nil {
+		return nil, err
+	}
+	shelves := make([]Shelf, 0, len(configs))
+	for _, config := range configs {
+		shelf, err := f.fill(config, listener)
+		if err != nil {
+			log.Printf("Could not load home shelf %s: %v", config.ID, err)
+			continue
+		}
+		if len(shelf.Songs) == 0 && len(shelf.Mixes) == 0 && len(shelf.Playlists) == 0 && len(shelf.Categories) == 0 {
+			continue
+		}
+		shelves = append(shelves, *shelf)
+	}
+	return shelves, nil
+}
+
+func (f *Feed) fill(config database.HomeShelfConfig, listener Listener) (*Shelf, error) {
+	shelf := &Shelf{ID: config.ID, Kind: config.Kind, Title: config.Title}
+	var err error
+	switch config.Kind {
+	case database.ShelfRecentlyPlayed:
+		var page *database.Page[database.PlayedSong]
+		page, err = f.Store.GetRecentlyPlayed(listener.UserID, "", config.Limit)
+		if err == nil {
+			for _, played := range page.Items {
+				shelf.Songs = append(shelf.Songs, played.Song)
+			}
+		}
+	case database.ShelfMadeForYou:
+		shelf.Mixes, err = f.Store.GetUserMixes(listener.UserID)
+		if len(shelf.Mixes) > config.Limit {
+			shelf.Mixes = shelf.Mixes[:config.Limit]
+		}
+	case database.ShelfNewReleases:
+		shelf.Songs, err = f.Store.GetNewReleases(listener.UserID, time.Now().Add(-newReleaseWindow), config.Limit)
+	case database.ShelfChart:
+		shelf.Songs, err = f.chartSongs(config, listener)
+	case database.ShelfPlaylists:
+		shelf.Playlists, err = f.Store.GetPlaylistsByIDs(limitIDs(config.ItemIDs, config.Limit))
+	case database.ShelfCategories:
+		if len(config.ItemIDs) > 0 {
+			shelf.Categories, err = f.Store.GetCategoriesByIDs(limitIDs(config.ItemIDs, config.Limit))
+		} else {
+			shelf.Categories, err = f.Store.GetSearchCategories()
+			if len(shelf.Categories) > config.Limit {
+				shelf.Categories = shelf.Categories[:config.Limit]
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return shelf, nil
+}
+
+// chartSongs returns the top of the chart a shelf names in item_ids. Shelves
+// without one show the weekly chart of the listener's country, or the global
+// one when the country has no chart yet.
+func (f *Feed) chartSongs(config database.HomeShelfConfig, listener Listener) ([]database.Song, error) {
+	chartIDs := config.ItemIDs
+	if len(chartIDs) == 0 {
+		if listener.Country != "" {
+			chartIDs = append(chartIDs, database.ChartID(defaultChartType, strings.ToLower(listener.Country)))
+		}
+		chartIDs = append(chartIDs, database.ChartID(defaultChartType, database.ChartScopeGlobal))
+	}
+	for _, chartID := range chartIDs {
+		chart, err := f.Store.GetChart(chartID, listener.UserID)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		songs := make([]database.Song, 0, config.Limit)
+		for _, entry := range chart.Entries {
+			if len(songs) == config.Limit {
+				break
+			}
+			songs = append(songs, entry.Song)
+		}
+		return songs, nil
+	}
+	return nil, nil
+}
+
+func limitIDs(ids []string, limit int) []string {
+	if len(ids) > limit {
+		return ids[:limit]
+	}
+	return ids
+}
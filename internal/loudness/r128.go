@@ -0,0 +1,181 @@
+// Package loudness measures integrated loudness as specified by EBU R128
+// (ITU-R BS.1770-4) and the sample peak of decoded audio.
+package loudness
+
+import "math"
+
+const (
+	absoluteGate = -70.0
+	relativeGate = -10.0
+	// ReferenceLUFS is the target of ReplayGain 2.0.
+	ReferenceLUFS = -18.0
+)
+
+// biquad is a second order IIR filter in direct form II transposed.
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	z1, z2             float64
+}
+
+func (f *biquad) process(x float64) float64 {
+	y := f.b0*x + f.z1
+	f.z1 = f.b1*x - f.a1*y + f.z2
+	f.z2 = f.b2*x - f.a2*y
+	return y
+}
+
+// kWeighting returns the two stage K-weighting filter of BS.1770 for a
+// sample rate: a high shelf modelling the head, then a high pass.
+func kWeighting(sampleRate int) [2]biquad {
+	rate := float64(sampleRate)
+
+	f0, gain, q := 1681.974450955533, 3.999843853973347, 0.7071752369554196
+	k := math.Tan(math.Pi * f0 / rate)
+	vh := math.Pow(10, gain/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+	a0 := 1 + k/q + k*k
+	shelf := biquad{
+		b0: (vh + vb*k/q + k*k) / a0,
+		b1: 2 * (k*k - vh) / a0,
+		b2: (vh - vb*k/q + k*k) / a0,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+
+	f0, q = 38.13547087602444, 0.5003270373238773
+	k = math.Tan(math.Pi * f0 / rate)
+	a0 = 1 + k/q + k*k
+	highPass := biquad{
+		b0: 1,
+		b1: -2,
+		b2: 1,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+	return [2]biquad{shelf, highPass}
+}
+
+// channelWeight follows BS.1770 for 5.0 (L R C Ls Rs) and 5.1
+// (L R C LFE Ls Rs) layouts: surround channels count 1.41 and the LFE channel
+// is ignored. Every other channel counts 1.
+func channelWeight(channel, channels int) float64 {
+	switch {
+	case channels == 5 && channel >= 3:
+		return 1.41
+	case channels == 6 && channel == 3:
+		return 0
+	case channels == 6 && channel >= 4:
+		return 1.41
+	}
+	return 1
+}
+
+// Meter accumulates interleaved samples. Gating blocks are 400 ms long and
+// overlap by 75%, so energy is summed in 100 ms steps.
+type Meter struct {
+	channels    int
+	filters     [][2]biquad
+	weights     []float64
+	stepSamples int
+
+	stepEnergy float64
+	stepFill   int
+	steps      []float64 // the last four 100 ms step energies
+	blocks     []float64 // mean square of every complete 400 ms block
+	peak       float64
+	samples    int64
+}
+
+func NewMeter(sampleRate, channels int) *Meter {
+	m := &Meter{
+		channels:    channels,
+		filters:     make([][2]biquad, channels),
+		weights:     make([]float64, channels),
+		stepSamples: sampleRate / 10,
+	}
+	for ch := range m.filters {
+		m.filters[ch] = kWeighting(sampleRate)
+		m.weights[ch] = channelWeight(ch, channels)
+	}
+	return m
+}
+
+// Write adds interleaved samples scaled to [-1, 1]; len(samples) must be a
+// multiple of the channel count.
+func (m *Meter) Write(samples []float64) {
+	for i := 0; i+m.channels <= len(samples); i += m.channels {
+		for ch := 0; ch < m.channels; ch++ {
+			x := samples[i+ch]
+			if a := math.Abs(x); a > m.peak {
+				m.peak = a
+			}
+			f := &m.filters[ch]
+			y := f[1].process(f[0].process(x))
+			m.stepEnergy += m.weights[ch] * y * y
+		}
+		m.samples++
+		if m.stepFill++; m.stepFill == m.stepSamples {
+			m.endStep()
+		}
+	}
+}
+
+func (m *Meter) endStep() {
+	m.steps = append(m.steps, m.stepEnergy)
+	if len(m.steps) > 4 {
+		m.steps = m.steps[1:]
+	}
+	m.stepEnergy, m.stepFill = 0, 0
+	if len(m.steps) == 4 {
+		sum := m.steps[0] + m.steps[1] + m.steps[2] + m.steps[3]
+		m.blocks = append(m.blocks, sum/float64(4*m.stepSamples))
+	}
+}
+
+func blockLoudness(meanSquare float64) float64 {
+	return -0.691 + 10*math.Log10(meanSquare)
+}
+
+// IntegratedLoudness returns the gated loudness in LUFS, or -Inf for audio
+// that is silent or shorter than one 400 ms block.
+func (m *Meter) IntegratedLoudness() float64 {
+	var sum float64
+	var count int
+	for _, z := range m.blocks {
+		if z > 0 && blockLoudness(z) > absoluteGate {
+			sum += z
+			count++
+		}
+	}
+	if count == 0 {
+		return math.Inf(-1)
+	}
+	threshold := blockLoudness(sum/float64(count)) + relativeGate
+	sum, count = 0, 0
+	for _, z := range m.blocks {
+		if z > 0 && blockLoudness(z) > absoluteGate && blockLoudness(z) > threshold {
+			sum += z
+			count++
+		}
+	}
+	if count == 0 {
+		return math.Inf(-1)
+	}
+	return blockLoudness(sum / float64(count))
+}
+
+// Peak is the largest absolute sample value seen, where 1 is full scale.
+func (m *Meter) Peak() float64 {
+	return m.peak
+}
+
+// Frames is the number of sample frames written so far.
+func (m *Meter) Frames() int64 {
+	return m.samples
+}
+
+// ReplayGain is the gain in dB that brings audio of the given loudness to
+// ReferenceLUFS.
+func ReplayGain(lufs float64) float64 {
+	return ReferenceLUFS - lufs
+}
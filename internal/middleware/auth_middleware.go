@@ -15,6 +15,8 @@ type contextKey string
 
 const UserIDKey contextKey = "userID"
 const IsSubscribedKey contextKey = "isSubscribed"
+const IsAdminKey contextKey = "isAdmin"
+const CountryKey contextKey = "country"
 
 func JWTMiddleware(store *database.PostgresStore) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
@@ -51,7 +53,22 @@ func JWTMiddleware(store *database.PostgresStore) func(http.Handler) http.Handle
 
 			ctx := context.WithValue(r.Context(), UserIDKey, claims.UserID)
 			ctx = context.WithValue(ctx, IsSubscribedKey, isSubscribed)
+			ctx = context.WithValue(ctx, IsAdminKey, user.IsAdmin)
+			ctx = context.WithValue(ctx, CountryKey, user.Country)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
+
+// RequireAdmin rejects requests from users who are not admins. It must run
+// after JWTMiddleware.
+func RequireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		isAdmin, _ := r.Context().Value(IsAdminKey).(bool)
+		if !isAdmin {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,148 @@
+// Package radio builds endless stations of songs related to a seed, for song
+// and artist radio and for autoplay after a playlist or album ends.
+package radio
+
+import (
+	"crypto/sha256"
+	"el-music-be/internal/database"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// MaxSeeds bounds how many songs and artists a station is seeded with.
+	MaxSeeds = 5
+	// recentWindow is how far back songs the listener played are skipped.
+	recentWindow = 24 * time.Hour
+	// contextSeeds is how many songs from the end of a playlist or album seed
+	// its autoplay station.
+	contextSeeds = 10
+)
+
+const (
+	ContextPlaylist = "playlist"
+	ContextAlbum    = "album"
+)
+
+var ErrUnknownContext = errors.New("context_type must be playlist or album")
+
+type Engine struct {
+	Store *database.PostgresStore
+}
+
+func NewEngine(store *database.PostgresStore) *Engine {
+	return &Engine{Store: store}
+}
+
+// ContextSeed seeds an autoplay station with the last songs of a playlist or
+// album, and keeps all of its songs out of the station.
+func (e *Engine) ContextSeed(userID, contextType, contextID string) (database.StationSeed, error) {
+	var songIDs []string
+	switch contextType {
+	case ContextPlaylist:
+		playlist, err := e.Store.GetPlaylistByID(contextID, userID)
+		if err != nil {
+			return database.StationSeed{}, err
+		}
+		for _, song := range playlist.Songs {
+			songIDs = append(songIDs, song.ID)
+		}
+	case ContextAlbum:
+		album, err := e.Store.GetAlbumByID(contextID, userID)
+		if err != nil {
+			return database.StationSeed{}, err
+		}
+		for _, track := range album.Tracks {
+			songIDs = append(songIDs, track.ID)
+		}
+	default:
+		return database.StationSeed{}, ErrUnknownContext
+	}
+	return database.StationSeed{
+		SongIDs: songIDs[max(0, len(songIDs)-contextSeeds):],
+		Exclude: songIDs,
+	}, nil
+}
+
+// Page returns the next songs of a station. When the ranked songs run out the
+// station starts another round, which may repeat songs but in a different
+// order, so there is always a next page while the catalog has songs.
+func (e *Engine) Page(userID string, seed database.StationSeed, cursor string, limit int) (*database.Page[database.Song], error) {
+	round, score, tiebreak, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+	key := stationKey(seed)
+	page := &database.Page[database.Song]{Items: make([]database.Song, 0, limit)}
+	seen := make(map[string]bool, limit)
+	for attempt := 0; attempt < 2 && len(page.Items) < limit; attempt++ {
+		// The first round skips what the listener just heard; later rounds
+		// cannot, or a small catalog would leave the station silent.
+		var excludeSince *time.Time
+		if round == 0 {
+			since := time.Now().Add(-recentWindow)
+			excludeSince = &since
+		}
+		want := limit - len(page.Items)
+		tracks, err := e.Store.GetStationTracks(userID, seed, key+"/"+strconv.Itoa(round), excludeSince, score, tiebreak, want)
+		if err != nil {
+			return nil, err
+		}
+		for _, track := range tracks {
+			score, tiebreak = track.Score, track.Tiebreak
+			if !seen[track.ID] {
+				seen[track.ID] = true
+				page.Items = append(page.Items, track.Song)
+			}
+		}
+		if len(tracks) < want {
+			round, score, tiebreak = round+1, "", ""
+		}
+	}
+	if len(page.Items) > 0 {
+		page.NextCursor = encodeCursor(round, score, tiebreak)
+	}
+	return page, nil
+}
+
+// stationKey identifies a station by its seed, independent of seed order.
+func stationKey(seed database.StationSeed) string {
+	parts := append(append([]string{}, seed.SongIDs...), seed.ArtistIDs...)
+	sort.Strings(parts)
+	sum := sha256.Sum256([]byte(strings.Join(parts, ",")))
+	return hex.EncodeToString(sum[:8])
+}
+
+func encodeCursor(round int, score, tiebreak string) string {
+	raw := strconv.Itoa(round) + "|" + score + "|" + tiebreak
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(cursor string) (int, string, string, error) {
+	if cursor == "" {
+		return 0, "", "", nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, "", "", database.ErrInvalidCursor
+	}
+	parts := strings.Split(string(raw), "|")
+	if len(parts) != 3 {
+		return 0, "", "", database.ErrInvalidCursor
+	}
+	round, err := strconv.Atoi(parts[0])
+	if err != nil || round < 0 {
+		return 0, "", "", database.ErrInvalidCursor
+	}
+	if parts[1] != "" {
+		if _, err := strconv.ParseFloat(parts[1], 64); err != nil || parts[2] == "" {
+			return 0, "", "", database.ErrInvalidCursor
+		}
+	}
+	return round, parts[1], parts[2], nil
+}
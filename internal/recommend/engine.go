@@ -0,0 +1,258 @@
+package recommend
+
+import (
+	"el-music-be/internal/database"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+)
+
+const (
+	historyWindow    = 90 * 24 * time.Hour
+	popularityWindow = 30 * 24 * time.Hour
+	// minMsPlayed is how long a song must play before it counts as a listen.
+	minMsPlayed   = 30000
+	maxNeighbors  = 50
+	maxSeeds      = 100
+	maxMixes      = 3
+	minMixSongs   = 5
+	maxMixSongs   = 30
+	discoverTitle = "Discover Mix"
+)
+
+// Engine builds the personalised "Made For You" mixes. Similarities and
+// mixes are recomputed in the background and cached in the database.
+type Engine struct {
+	Store *database.PostgresStore
+}
+
+func NewEngine(store *database.PostgresStore) *Engine {
+	return &Engine{Store: store}
+}
+
+// Run recomputes all recommendations every interval, forever.
+func (e *Engine) Run(interval time.Duration) {
+	for {
+		start := time.Now()
+		if err := e.RecomputeAll(); err != nil {
+			log.Printf("Recommendation job failed: %v", err)
+		} else {
+			log.Printf("Recommendation job finished in %s", time.Since(start))
+		}
+		time.Sleep(interval)
+	}
+}
+
+func (e *Engine) RecomputeAll() error {
+	baskets, err := e.Store.GetCooccurrenceBaskets(time.Now().Add(-historyWindow), minMsPlayed)
+	if err != nil {
+		return err
+	}
+	if err := e.Store.ReplaceSongSimilarities(itemSimilarities(baskets, maxNeighbors)); err != nil {
+		return err
+	}
+	userIDs, err := e.Store.GetUserIDsForRecommendation()
+	if err != nil {
+		return err
+	}
+	for _, userID := range userIDs {
+		if err := e.RecomputeUser(userID); err != nil {
+			log.Printf("Could not compute mixes for user %s: %v", userID, err)
+		}
+	}
+	return nil
+}
+
+// MixesForUser returns the cached mixes of a user, computing them on the spot
+// only for users the background job has not seen yet. Users for whom nothing
+// could be computed get no mixes until the next run.
+func (e *Engine) MixesForUser(userID string) ([]database.Mix, error) {
+	mixes, err := e.Store.GetUserMixes(userID)
+	if err != nil || len(mixes) > 0 {
+		return mixes, err
+	}
+	computed, err := e.Store.HasComputedMixes(userID)
+	if err != nil || computed {
+		return mixes, err
+	}
+	if err := e.RecomputeUser(userID); err != nil {
+		return nil, err
+	}
+	return e.Store.GetUserMixes(userID)
+}
+
+func (e *Engine) RecomputeUser(userID string) error {
+	seeds, err := e.Store.GetUserSeeds(userID, time.Now().Add(-historyWindow), minMsPlayed, maxSeeds)
+	if err != nil {
+		return err
+	}
+	var mixes []database.Mix
+	if len(seeds) > 0 {
+		seedIDs := make([]string, len(seeds))
+		for i, seed := range seeds {
+			seedIDs[i] = seed.SongID
+		}
+		neighbors, err := e.Store.GetSongNeighbors(seedIDs)
+		if err != nil {
+			return err
+		}
+		mixes = buildMixes(seeds, neighbors)
+	}
+	if len(mixes) == 0 {
+		mixes, err = e.coldStartMixes(userID)
+		if err != nil {
+			return err
+		}
+	}
+	return e.Store.ReplaceUserMixes(userID, mixes)
+}
+
+// coldStartMixes serves users without usable history: the most popular songs
+// in each category they picked, then the most popular songs overall.
+func (e *Engine) coldStartMixes(userID string) ([]database.Mix, error) {
+	since := time.Now().Add(-popularityWindow)
+	categories, err := e.Store.GetUserCategories(userID)
+	if err != nil {
+		return nil, err
+	}
+	var mixes []database.Mix
+	for _, category := range categories {
+		if len(mixes) == maxMixes-1 {
+			break
+		}
+		songIDs, err := e.Store.GetPopularSongIDs(since, category.ID, maxMixSongs)
+		if err != nil {
+			return nil, err
+		}
+		if len(songIDs) < minMixSongs {
+			continue
+		}
+		mixes = append(mixes, popularityMix(
+			"Popular in "+category.Name,
+			"Because you like "+category.Name,
+			songIDs,
+		))
+	}
+	songIDs, err := e.Store.GetPopularSongIDs(since, "", maxMixSongs)
+	if err != nil {
+		return nil, err
+	}
+	if len(songIDs) > 0 {
+		mixes = append(mixes, popularityMix("Popular Right Now", "Popular with listeners this month", songIDs))
+	}
+	return mixes, nil
+}
+
+func popularityMix(title, explanation string, songIDs []string) database.Mix {
+	mix := database.Mix{Title: title, Explanation: explanation}
+	for _, id := range songIDs {
+		mix.Songs = append(mix.Songs, database.MixSong{Song: database.Song{ID: id}})
+	}
+	return mix
+}
+
+type candidate struct {
+	songID   string
+	score    float64
+	bestSeed *database.SeedSong
+	bestPart float64
+}
+
+// buildMixes scores unheard songs by their similarity to the user's seeds and
+// groups them into one mix per artist the user listens to most, explaining
+// each song by the seed that contributed most to its score.
+func buildMixes(seeds []database.SeedSong, neighbors map[string][]database.SongNeighbor) []database.Mix {
+	known := make(map[string]bool, len(seeds))
+	for _, seed := range seeds {
+		known[seed.SongID] = true
+	}
+	candidates := make(map[string]*candidate)
+	for i := range seeds {
+		seed := &seeds[i]
+		for _, n := range neighbors[seed.SongID] {
+			if known[n.SongID] {
+				continue
+			}
+			c, ok := candidates[n.SongID]
+			if !ok {
+				c = &candidate{songID: n.SongID}
+				candidates[n.SongID] = c
+			}
+			part := seed.Weight * n.Score
+			c.score += part
+			if part > c.bestPart {
+				c.bestPart = part
+				c.bestSeed = seed
+			}
+		}
+	}
+
+	type group struct {
+		artist     string
+		score      float64
+		candidates []*candidate
+	}
+	groups := make(map[string]*group)
+	for _, c := range candidates {
+		g, ok := groups[c.bestSeed.Artist]
+		if !ok {
+			g = &group{artist: c.bestSeed.Artist}
+			groups[c.bestSeed.Artist] = g
+		}
+		g.score += c.score
+		g.candidates = append(g.candidates, c)
+	}
+	ordered := make([]*group, 0, len(groups))
+	for _, g := range groups {
+		sortCandidates(g.candidates)
+		ordered = append(ordered, g)
+	}
+	sort.Slice(ordered, func(i, j int) bool {
+		if ordered[i].score != ordered[j].score {
+			return ordered[i].score > ordered[j].score
+		}
+		return ordered[i].artist < ordered[j].artist
+	})
+
+	var mixes []database.Mix
+	var leftovers []*candidate
+	for _, g := range ordered {
+		if len(mixes) < maxMixes-1 && len(g.candidates) >= minMixSongs {
+			mixes = append(mixes, candidateMix(g.artist+" Mix", g.candidates))
+		} else {
+			leftovers = append(leftovers, g.candidates...)
+		}
+	}
+	if len(leftovers) >= minMixSongs {
+		sortCandidates(leftovers)
+		mixes = append(mixes, candidateMix(discoverTitle, leftovers))
+	}
+	return mixes
+}
+
+func candidateMix(title string, candidates []*candidate) database.Mix {
+	if len(candidates) > maxMixSongs {
+		candidates = candidates[:maxMixSongs]
+	}
+	mix := database.Mix{
+		Title:       title,
+		Explanation: fmt.Sprintf("Because you played %s", candidates[0].bestSeed.Title),
+	}
+	for _, c := range candidates {
+		mix.Songs = append(mix.Songs, database.MixSong{
+			Song:   database.Song{ID: c.songID},
+			Reason: fmt.Sprintf("Because you played %s", c.bestSeed.Title),
+		})
+	}
+	return mix
+}
+
+func sortCandidates(candidates []*candidate) {
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].score != candidates[j].score {
+			return candidates[i].score > candidates[j].score
+		}
+		return candidates[i].songID < candidates[j].songID
+	})
+}
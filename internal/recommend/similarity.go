@@ -0,0 +1,71 @@
+package recommend
+
+import (
+	"el-music-be/internal/database"
+	"math"
+	"sort"
+)
+
+// maxBasketSize bounds the quadratic pair counting for very large playlists
+// and very heavy listeners.
+const maxBasketSize = 200
+
+type songPair struct {
+	a, b string
+}
+
+// itemSimilarities computes item-to-item cosine similarity from how often two
+// songs occur together in the same basket, keeping the k best neighbours of
+// every song.
+func itemSimilarities(baskets [][]string, k int) map[string][]database.SongNeighbor {
+	occurrences := make(map[string]int)
+	cooccurrences := make(map[songPair]int)
+	for _, basket := range baskets {
+		basket = uniqueSongs(basket)
+		if len(basket) > maxBasketSize {
+			basket = basket[:maxBasketSize]
+		}
+		for i, a := range basket {
+			occurrences[a]++
+			for _, b := range basket[i+1:] {
+				if b < a {
+					cooccurrences[songPair{b, a}]++
+				} else {
+					cooccurrences[songPair{a, b}]++
+				}
+			}
+		}
+	}
+
+	neighbors := make(map[string][]database.SongNeighbor)
+	for pair, count := range cooccurrences {
+		score := float64(count) / math.Sqrt(float64(occurrences[pair.a])*float64(occurrences[pair.b]))
+		neighbors[pair.a] = append(neighbors[pair.a], database.SongNeighbor{SongID: pair.b, Score: score})
+		neighbors[pair.b] = append(neighbors[pair.b], database.SongNeighbor{SongID: pair.a, Score: score})
+	}
+	for songID, list := range neighbors {
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].Score != list[j].Score {
+				return list[i].Score > list[j].Score
+			}
+			return list[i].SongID < list[j].SongID
+		})
+		if len(list) > k {
+			list = list[:k]
+		}
+		neighbors[songID] = list
+	}
+	return neighbors
+}
+
+func uniqueSongs(songIDs []string) []string {
+	seen := make(map[string]bool, len(songIDs))
+	unique := make([]string, 0, len(songIDs))
+	for _, id := range songIDs {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,61 @@
+package releaseradar
+
+import (
+	"el-music-be/internal/database"
+	"log"
+	"time"
+)
+
+const (
+	releaseWindow = 7 * 24 * time.Hour
+	maxSongs      = 30
+)
+
+// Generator builds every listener's weekly release radar from new releases
+// by the artists they follow.
+type Generator struct {
+	Store *database.PostgresStore
+}
+
+func NewGenerator(store *database.PostgresStore) *Generator {
+	return &Generator{Store: store}
+}
+
+// Run generates the release radars that are missing for the current week,
+// then sleeps until the next week starts, forever.
+func (g *Generator) Run() {
+	for {
+		weekStart := currentWeekStart(time.Now())
+		if err := g.GenerateStale(weekStart); err != nil {
+			log.Printf("Release radar job failed: %v", err)
+		}
+		time.Sleep(time.Until(weekStart.AddDate(0, 0, 7)))
+	}
+}
+
+func (g *Generator) GenerateStale(weekStart time.Time) error {
+	userIDs, err := g.Store.GetUserIDsWithStaleReleaseRadar(weekStart)
+	if err != nil {
+		return err
+	}
+	for _, userID := range userIDs {
+		songIDs, err := g.Store.GetNewReleaseSongIDs(userID, weekStart.Add(-releaseWindow), maxSongs)
+		if err != nil {
+			log.Printf("Could not find new releases for user %s: %v", userID, err)
+			continue
+		}
+		if err := g.Store.ReplaceReleaseRadar(userID, songIDs, weekStart); err != nil {
+			log.Printf("Could not generate release radar for user %s: %v", userID, err)
+		}
+	}
+	return nil
+}
+
+// currentWeekStart returns the most recent Friday at midnight UTC, the day new
+// music comes out.
+func currentWeekStart(now time.Time) time.Time {
+	now = now.UTC()
+	daysSinceFriday := (int(now.Weekday()) - int(time.Friday) + 7) % 7
+	day := now.AddDate(0, 0, -daysSinceFriday)
+	return time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,83 @@
+// Package stats summarises a listener's play events: rolling listening
+// statistics and the yearly Wrapped recap.
+package stats
+
+import (
+	"el-music-be/internal/database"
+	"errors"
+	"time"
+)
+
+const (
+	// minMsPlayed is how long a song must play before it counts as a play.
+	minMsPlayed = 30000
+	topLimit    = 10
+)
+
+const (
+	RangeFourWeeks = "4w"
+	RangeSixMonths = "6m"
+	RangeAll       = "all"
+)
+
+var ErrInvalidRange = errors.New("range must be 4w, 6m or all")
+
+type ListeningStats struct {
+	Range           string                 `json:"range"`
+	Since           *time.Time             `json:"since"`
+	MinutesListened int64                  `json:"minutes_listened"`
+	Plays           int64                  `json:"plays"`
+	TopSongs        []database.TopSong     `json:"top_songs"`
+	TopArtists      []database.TopArtist   `json:"top_artists"`
+	TopCategories   []database.TopCategory `json:"top_categories"`
+}
+
+type Summarizer struct {
+	Store *database.PostgresStore
+}
+
+func NewSummarizer(store *database.PostgresStore) *Summarizer {
+	return &Summarizer{Store: store}
+}
+
+// rangeStart returns where a range starts, or nil for all time.
+func rangeStart(statsRange string, now time.Time) (*time.Time, error) {
+	var since time.Time
+	switch statsRange {
+	case RangeFourWeeks:
+		since = now.AddDate(0, 0, -28)
+	case RangeSixMonths:
+		since = now.AddDate(0, -6, 0)
+	case RangeAll:
+		return nil, nil
+	default:
+		return nil, ErrInvalidRange
+	}
+	return &since, nil
+}
+
+// Stats returns a user's listening statistics over a range ending now.
+func (s *Summarizer) Stats(userID, statsRange string) (*ListeningStats, error) {
+	since, err := rangeStart(statsRange, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	window := database.StatsWindow{Since: since}
+	result := &ListeningStats{Range: statsRange, Since: since}
+	totals, err := s.Store.GetListeningTotals(userID, window, minMsPlayed)
+	if err != nil {
+		return nil, err
+	}
+	result.MinutesListened = totals.MsPlayed / 60000
+	result.Plays = totals.Plays
+	if result.TopSongs, err = s.Store.GetTopSongs(userID, window, minMsPlayed, topLimit); err != nil {
+		return nil, err
+	}
+	if result.TopArtists, err = s.Store.GetTopArtists(userID, window, minMsPlayed, topLimit); err != nil {
+		return nil, err
+	}
+	if result.TopCategories, err = s.Store.GetTopCategories(userID, window, minMsPlayed, topLimit); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,192 @@
+package stats
+
+import (
+	"el-music-be/internal/database"
+	"encoding/json"
+	"log"
+	"time"
+)
+
+const (
+	recapListLimit = 5
+	// recapMonth is when a year's recap is published. It covers plays from
+	// the start of the year until then.
+	recapMonth = time.December
+)
+
+// Recap is the card data of a yearly recap. It copies names and images so the
+// recap reads the same after the catalog changes.
+type Recap struct {
+	Year          int           `json:"year"`
+	PeriodStart   time.Time     `json:"period_start"`
+	PeriodEnd     time.Time     `json:"period_end"`
+	TotalMinutes  int64         `json:"total_minutes"`
+	Plays         int64         `json:"plays"`
+	DaysListened  int           `json:"days_listened"`
+	LongestStreak Streak        `json:"longest_streak"`
+	TopGenre      string        `json:"top_genre"`
+	TopGenres     []string      `json:"top_genres"`
+	TopSongs      []RecapSong   `json:"top_songs"`
+	TopArtists    []RecapArtist `json:"top_artists"`
+}
+
+type RecapSong struct {
+	ID       string `json:"id"`
+	Title    string `json:"title"`
+	Artist   string `json:"artist"`
+	ImageURL string `json:"imageUrl"`
+	Plays    int64  `json:"plays"`
+}
+
+type RecapArtist struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	ImageURL string `json:"imageUrl"`
+	Plays    int64  `json:"plays"`
+}
+
+// Streak is a run of consecutive days with at least one play. Dates are
+// YYYY-MM-DD in UTC and empty when there is no streak.
+type Streak struct {
+	Days  int    `json:"days"`
+	Start string `json:"start,omitempty"`
+	End   string `json:"end,omitempty"`
+}
+
+// RecapYear returns the latest year whose recap is published by now.
+func RecapYear(now time.Time) int {
+	now = now.UTC()
+	if now.Month() >= recapMonth {
+		return now.Year()
+	}
+	return now.Year() - 1
+}
+
+func recapWindow(year int) database.StatsWindow {
+	start := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(year, recapMonth, 1, 0, 0, 0, 0, time.UTC)
+	return database.StatsWindow{Since: &start, Until: &end}
+}
+
+// Run publishes the recaps that are due, then again every interval, forever.
+func (s *Summarizer) Run(interval time.Duration) {
+	for {
+		if err := s.PublishRecaps(RecapYear(time.Now())); err != nil {
+			log.Printf("Wrapped job failed: %v", err)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// PublishRecaps generates the recap of year for every listener who does not
+// have one yet. Published recaps are never regenerated. Once a run publishes
+// every due recap the year is marked complete and later runs return at once;
+// plays synced with a backdated start after that get no recap.
+func (s *Summarizer) PublishRecaps(year int) error {
+	completed, err := s.Store.HasCompletedWrappedRun(year)
+	if err != nil || completed {
+		return err
+	}
+	window := recapWindow(year)
+	userIDs, err := s.Store.GetUserIDsDueForRecap(year, window, minMsPlayed)
+	if err != nil {
+		return err
+	}
+	failed := false
+	for _, userID := range userIDs {
+		recap, err := s.BuildRecap(userID, year)
+		if err != nil {
+			log.Printf("Could not build %d recap for user %s: %v", year, userID, err)
+			failed = true
+			continue
+		}
+		data, err := json.Marshal(recap)
+		if err != nil {
+			return err
+		}
+		if err := s.Store.SaveWrappedRecap(userID, year, data); err != nil {
+			log.Printf("Could not publish %d recap for user %s: %v", year, userID, err)
+			failed = true
+		}
+	}
+	if failed {
+		return nil
+	}
+	return s.Store.CompleteWrappedRun(year)
+}
+
+func (s *Summarizer) BuildRecap(userID string, year int) (*Recap, error) {
+	window := recapWindow(year)
+	recap := &Recap{
+		Year:        year,
+		PeriodStart: *window.Since,
+		PeriodEnd:   *window.Until,
+		TopGenres:   make([]string, 0, recapListLimit),
+		TopSongs:    make([]RecapSong, 0, recapListLimit),
+		TopArtists:  make([]RecapArtist, 0, recapListLimit),
+	}
+	totals, err := s.Store.GetListeningTotals(userID, window, minMsPlayed)
+	if err != nil {
+		return nil, err
+	}
+	recap.TotalMinutes = totals.MsPlayed / 60000
+	recap.Plays = totals.Plays
+
+	days, err := s.Store.GetListeningDays(userID, window, minMsPlayed)
+	if err != nil {
+		return nil, err
+	}
+	recap.DaysListened = len(days)
+	recap.LongestStreak = longestStreak(days)
+
+	genres, err := s.Store.GetTopGenres(userID, window, minMsPlayed, recapListLimit)
+	if err != nil {
+		return nil, err
+	}
+	for _, genre := range genres {
+		recap.TopGenres = append(recap.TopGenres, genre.Genre)
+	}
+	if len(recap.TopGenres) > 0 {
+		recap.TopGenre = recap.TopGenres[0]
+	}
+
+	songs, err := s.Store.GetTopSongs(userID, window, minMsPlayed, recapListLimit)
+	if err != nil {
+		return nil, err
+	}
+	for _, song := range songs {
+		recap.TopSongs = append(recap.TopSongs, RecapSong{
+			ID: song.ID, Title: song.Title, Artist: song.Artist, ImageURL: song.ImageURL, Plays: song.Plays,
+		})
+	}
+	artists, err := s.Store.GetTopArtists(userID, window, minMsPlayed, recapListLimit)
+	if err != nil {
+		return nil, err
+	}
+	for _, artist := range artists {
+		recap.TopArtists = append(recap.TopArtists, RecapArtist{
+			ID: artist.ID, Name: artist.Name, ImageURL: artist.ImageURL, Plays: artist.Plays,
+		})
+	}
+	return recap, nil
+}
+
+// longestStreak finds the longest run of consecutive days in sorted days.
+// The earliest run wins a tie.
+func longestStreak(days []time.Time) Streak {
+	var best Streak
+	runStart := 0
+	for i := range days {
+		if i > 0 && !days[i].Equal(days[i-1].AddDate(0, 0, 1)) {
+			runStart = i
+		}
+		if length := i - runStart + 1; length > best.Days {
+			best = Streak{
+				Days:  length,
+				Start: days[runStart].Format(time.DateOnly),
+				End:   days[i].Format(time.DateOnly),
+			}
+		}
+	}
+	return best
+}
@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var ErrInvalidKey = errors.New("invalid storage key")
+
+type Object interface {
+	io.ReadSeeker
+	io.Closer
+}
+
+type ObjectInfo struct {
+	Size    int64
+	ModTime time.Time
+}
+
+// Backend stores files under slash separated keys such as "audio/<id>.mp3".
+// Local disk is the only implementation so far; an S3-compatible one only
+// needs to satisfy the same interface.
+type Backend interface {
+	Put(key string, r io.Reader) (int64, error)
+	Open(key string) (Object, ObjectInfo, error)
+	Delete(key string) error
+	// URL returns a location that identifies the object internally. It is not
+	// meant to be handed to clients.
+	URL(key string) string
+}
+
+type LocalBackend struct {
+	Root string
+}
+
+func NewLocalBackend(root string) (*LocalBackend, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, err
+	}
+	return &LocalBackend{Root: root}, nil
+}
+
+// NewBackendFromEnv returns the backend configured by STORAGE_DIR, defaulting
+// to ./data on local disk.
+func NewBackendFromEnv() (Backend, error) {
+	root := os.Getenv("STORAGE_DIR")
+	if root == "" {
+		root = "data"
+	}
+	return NewLocalBackend(root)
+}
+
+func (b *LocalBackend) path(key string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(key))
+	if key == "" || filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", ErrInvalidKey
+	}
+	return filepath.Join(b.Root, clean), nil
+}
+
+// Put writes the object to a temporary file first, so readers never see a
+// partially written object.
+func (b *LocalBackend) Put(key string, r io.Reader) (int64, error) {
+	path, err := b.path(key)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return 0, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+	n, err := io.Copy(tmp, r)
+	if err != nil {
+		tmp.Close()
+		return 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, err
+	}
+	return n, os.Rename(tmp.Name(), path)
+}
+
+func (b *LocalBackend) Open(key string) (Object, ObjectInfo, error) {
+	path, err := b.path(key)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, ObjectInfo{}, err
+	}
+	return f, ObjectInfo{Size: stat.Size(), ModTime: stat.ModTime()}, nil
+}
+
+func (b *LocalBackend) Delete(key string) error {
+	path, err := b.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (b *LocalBackend) URL(key string) string {
+	return "local://" + key
+}
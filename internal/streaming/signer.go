@@ -0,0 +1,81 @@
+// Package streaming signs the short-lived URLs that audio is served from, so
+// clients never learn where the audio is stored and access can be cut off by
+// letting URLs expire.
+package streaming
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"el-music-be/internal/auth"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+const DefaultTTL = 15 * time.Minute
+
+var (
+	ErrInvalidSignature = errors.New("invalid stream signature")
+	ErrExpired          = errors.New("stream URL has expired")
+)
+
+type Signer struct {
+	key []byte
+	TTL time.Duration
+}
+
+func NewSigner(key []byte, ttl time.Duration) *Signer {
+	return &Signer{key: key, TTL: ttl}
+}
+
+// NewSignerFromEnv signs with STREAM_SIGNING_KEY, falling back to the JWT key,
+// and lets STREAM_URL_TTL (a Go duration such as "10m") override the TTL.
+func NewSignerFromEnv() *Signer {
+	key := auth.JwtKey
+	if secret := os.Getenv("STREAM_SIGNING_KEY"); secret != "" {
+		key = []byte(secret)
+	}
+	ttl := DefaultTTL
+	if d, err := time.ParseDuration(os.Getenv("STREAM_URL_TTL")); err == nil && d > 0 {
+		ttl = d
+	}
+	return NewSigner(key, ttl)
+}
+
+func (s *Signer) signature(resource, userID string, expires int64) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(resource + "\n" + userID + "\n" + strconv.FormatInt(expires, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Sign grants userID access to resource until now plus the TTL and returns
+// the query parameters that prove it.
+func (s *Signer) Sign(resource, userID string, now time.Time) (url.Values, time.Time) {
+	expires := now.Add(s.TTL).Truncate(time.Second)
+	q := url.Values{}
+	q.Set("user", userID)
+	q.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+	q.Set("sig", s.signature(resource, userID, expires.Unix()))
+	return q, expires
+}
+
+// Verify checks the query parameters of a signed URL for resource and returns
+// the user it was issued to.
+func (s *Signer) Verify(resource string, q url.Values, now time.Time) (string, error) {
+	userID := q.Get("user")
+	expires, err := strconv.ParseInt(q.Get("expires"), 10, 64)
+	if err != nil || userID == "" {
+		return "", ErrInvalidSignature
+	}
+	expected := s.signature(resource, userID, expires)
+	if !hmac.Equal([]byte(expected), []byte(q.Get("sig"))) {
+		return "", ErrInvalidSignature
+	}
+	if now.Unix() > expires {
+		return "", ErrExpired
+	}
+	return userID, nil
+}
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS play_events (
+    id           UUID        NOT NULL DEFAULT gen_random_uuid(),
+    user_id      UUID        NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    song_id      UUID        NOT NULL REFERENCES songs(id),
+    started_at   TIMESTAMPTZ NOT NULL,
+    ms_played    INTEGER     NOT NULL CHECK (ms_played >= 0),
+    context_type TEXT        NOT NULL DEFAULT '',
+    context_id   TEXT        NOT NULL DEFAULT '',
+    device       TEXT        NOT NULL DEFAULT '',
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (id, started_at)
+) PARTITION BY RANGE (started_at);
+
+CREATE TABLE IF NOT EXISTS play_events_default PARTITION OF play_events DEFAULT;
+
+CREATE INDEX IF NOT EXISTS idx_play_events_user_started ON play_events (user_id, started_at DESC);
+CREATE INDEX IF NOT EXISTS idx_play_events_song_started ON play_events (song_id, started_at DESC);
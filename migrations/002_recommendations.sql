@@ -0,0 +1,40 @@
+CREATE TABLE IF NOT EXISTS song_categories (
+    song_id     UUID NOT NULL REFERENCES songs(id) ON DELETE CASCADE,
+    category_id UUID NOT NULL REFERENCES categories(id) ON DELETE CASCADE,
+    PRIMARY KEY (song_id, category_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_song_categories_category ON song_categories (category_id);
+
+CREATE TABLE IF NOT EXISTS user_categories (
+    user_id     UUID        NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    category_id UUID        NOT NULL REFERENCES categories(id) ON DELETE CASCADE,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, category_id)
+);
+
+CREATE TABLE IF NOT EXISTS song_similarities (
+    song_id         UUID             NOT NULL REFERENCES songs(id) ON DELETE CASCADE,
+    similar_song_id UUID             NOT NULL REFERENCES songs(id) ON DELETE CASCADE,
+    score           DOUBLE PRECISION NOT NULL,
+    PRIMARY KEY (song_id, similar_song_id)
+);
+
+CREATE TABLE IF NOT EXISTS user_mixes (
+    id           UUID        PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id      UUID        NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    position     INTEGER     NOT NULL,
+    title        TEXT        NOT NULL,
+    explanation  TEXT        NOT NULL DEFAULT '',
+    generated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_mixes_user ON user_mixes (user_id, position);
+
+CREATE TABLE IF NOT EXISTS user_mix_songs (
+    mix_id   UUID    NOT NULL REFERENCES user_mixes(id) ON DELETE CASCADE,
+    song_id  UUID    NOT NULL REFERENCES songs(id) ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    reason   TEXT    NOT NULL DEFAULT '',
+    PRIMARY KEY (mix_id, song_id)
+);
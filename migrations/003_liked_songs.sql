@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS liked_songs (
+    user_id  UUID        NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    song_id  UUID        NOT NULL REFERENCES songs(id) ON DELETE CASCADE,
+    liked_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, song_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_liked_songs_user_liked_at ON liked_songs (user_id, liked_at DESC);
@@ -0,0 +1,75 @@
+CREATE TABLE IF NOT EXISTS artists (
+    id         UUID        PRIMARY KEY DEFAULT gen_random_uuid(),
+    name       TEXT        NOT NULL,
+    image_url  TEXT        NOT NULL DEFAULT '',
+    bio        TEXT        NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_artists_name ON artists (lower(name));
+
+CREATE TABLE IF NOT EXISTS albums (
+    id           UUID        PRIMARY KEY DEFAULT gen_random_uuid(),
+    title        TEXT        NOT NULL,
+    artist_id    UUID        NOT NULL REFERENCES artists(id),
+    album_type   TEXT        NOT NULL DEFAULT 'album' CHECK (album_type IN ('album', 'single', 'ep', 'compilation')),
+    release_date DATE,
+    image_url    TEXT        NOT NULL DEFAULT '',
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_albums_artist ON albums (artist_id, release_date DESC);
+
+CREATE TABLE IF NOT EXISTS song_artists (
+    song_id   UUID    NOT NULL REFERENCES songs(id) ON DELETE CASCADE,
+    artist_id UUID    NOT NULL REFERENCES artists(id) ON DELETE CASCADE,
+    role      TEXT    NOT NULL CHECK (role IN ('primary', 'featured', 'producer')),
+    position  INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (song_id, artist_id, role)
+);
+
+CREATE INDEX IF NOT EXISTS idx_song_artists_artist ON song_artists (artist_id, role);
+
+ALTER TABLE songs ADD COLUMN IF NOT EXISTS album_id UUID REFERENCES albums(id);
+ALTER TABLE songs ADD COLUMN IF NOT EXISTS track_number INTEGER;
+ALTER TABLE songs ADD COLUMN IF NOT EXISTS disc_number INTEGER NOT NULL DEFAULT 1;
+
+CREATE INDEX IF NOT EXISTS idx_songs_album ON songs (album_id, disc_number, track_number);
+
+-- Backfill artists and credits from the free-text songs.artist column.
+-- "A, B & C feat. D, E" credits A, B and C as primary and D and E as
+-- featured artists. songs.artist is kept as the display credit line.
+-- Albums cannot be derived from the existing data and are left empty.
+CREATE TEMPORARY TABLE artist_credit_backfill AS
+WITH parts AS (
+    SELECT id AS song_id,
+           split_part(regexp_replace(artist, '\s+(feat\.?|ft\.?|featuring)\s+', '|', 'i'), '|', 1) AS main_part,
+           split_part(regexp_replace(artist, '\s+(feat\.?|ft\.?|featuring)\s+', '|', 'i'), '|', 2) AS featured_part
+    FROM songs
+    WHERE NOT EXISTS (SELECT 1 FROM song_artists sa WHERE sa.song_id = songs.id)
+)
+SELECT song_id, btrim(t.name) AS name, 'primary' AS role, t.ord - 1 AS position
+FROM parts, regexp_split_to_table(main_part, '\s*(,|&)\s*') WITH ORDINALITY AS t(name, ord)
+UNION ALL
+SELECT song_id, btrim(t.name), 'featured', t.ord - 1
+FROM parts, regexp_split_to_table(featured_part, '\s*(,|&)\s*') WITH ORDINALITY AS t(name, ord)
+WHERE featured_part <> '';
+
+DELETE FROM artist_credit_backfill WHERE name = '';
+
+INSERT INTO artists (name)
+SELECT DISTINCT ON (lower(b.name)) b.name
+FROM artist_credit_backfill b
+WHERE NOT EXISTS (SELECT 1 FROM artists a WHERE lower(a.name) = lower(b.name))
+ORDER BY lower(b.name), b.name;
+
+INSERT INTO song_artists (song_id, artist_id, role, position)
+SELECT DISTINCT ON (b.song_id, a.id, b.role) b.song_id, a.id, b.role, b.position
+FROM artist_credit_backfill b
+INNER JOIN LATERAL (
+    SELECT id FROM artists WHERE lower(name) = lower(b.name) ORDER BY created_at, id LIMIT 1
+) a ON true
+ORDER BY b.song_id, a.id, b.role, b.position
+ON CONFLICT DO NOTHING;
+
+DROP TABLE artist_credit_backfill;
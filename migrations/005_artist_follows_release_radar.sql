@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS artist_follows (
+    user_id     UUID        NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    artist_id   UUID        NOT NULL REFERENCES artists(id) ON DELETE CASCADE,
+    followed_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, artist_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_artist_follows_artist ON artist_follows (artist_id);
+CREATE INDEX IF NOT EXISTS idx_artist_follows_user_followed_at ON artist_follows (user_id, followed_at DESC);
+
+-- Generated playlists such as the weekly release radar are owned by the system
+-- user and point at the listener they were generated for.
+INSERT INTO users (id, name, email, password_hash, is_verified)
+VALUES ('00000000-0000-0000-0000-000000000001', 'El Music', 'system@elmusic.invalid', '!', false)
+ON CONFLICT DO NOTHING;
+
+ALTER TABLE playlists ADD COLUMN IF NOT EXISTS kind TEXT NOT NULL DEFAULT 'user';
+ALTER TABLE playlists ADD COLUMN IF NOT EXISTS generated_for UUID REFERENCES users(id) ON DELETE CASCADE;
+ALTER TABLE playlists ADD COLUMN IF NOT EXISTS generated_at TIMESTAMPTZ;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_playlists_generated ON playlists (kind, generated_for) WHERE kind <> 'user';
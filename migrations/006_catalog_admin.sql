@@ -0,0 +1,24 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS is_admin BOOLEAN NOT NULL DEFAULT false;
+
+ALTER TABLE songs ADD COLUMN IF NOT EXISTS duration_ms INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE songs ADD COLUMN IF NOT EXISTS isrc TEXT;
+ALTER TABLE songs ADD COLUMN IF NOT EXISTS genre TEXT NOT NULL DEFAULT '';
+ALTER TABLE songs ADD COLUMN IF NOT EXISTS explicit BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE songs ADD COLUMN IF NOT EXISTS release_date DATE;
+ALTER TABLE songs ADD COLUMN IF NOT EXISTS available BOOLEAN NOT NULL DEFAULT true;
+ALTER TABLE songs ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+ALTER TABLE songs ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+ALTER TABLE songs ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_songs_isrc ON songs (isrc);
+
+CREATE TABLE IF NOT EXISTS song_audit_log (
+    id         UUID        PRIMARY KEY DEFAULT gen_random_uuid(),
+    song_id    UUID        NOT NULL REFERENCES songs(id) ON DELETE CASCADE,
+    admin_id   UUID        NOT NULL REFERENCES users(id),
+    action     TEXT        NOT NULL CHECK (action IN ('create', 'update', 'delete', 'restore')),
+    changes    JSONB       NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_song_audit_log_song ON song_audit_log (song_id, created_at DESC);
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS catalog_imports (
+    id         UUID        PRIMARY KEY DEFAULT gen_random_uuid(),
+    admin_id   UUID        NOT NULL REFERENCES users(id),
+    filename   TEXT        NOT NULL DEFAULT '',
+    dry_run    BOOLEAN     NOT NULL,
+    report     JSONB       NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,7 @@
+ALTER TABLE songs ADD COLUMN IF NOT EXISTS audio_key TEXT;
+ALTER TABLE songs ADD COLUMN IF NOT EXISTS audio_format TEXT;
+ALTER TABLE songs ADD COLUMN IF NOT EXISTS is_draft BOOLEAN NOT NULL DEFAULT false;
+
+ALTER TABLE song_audit_log DROP CONSTRAINT IF EXISTS song_audit_log_action_check;
+ALTER TABLE song_audit_log ADD CONSTRAINT song_audit_log_action_check
+    CHECK (action IN ('create', 'update', 'delete', 'restore', 'publish'));
@@ -0,0 +1,21 @@
+ALTER TABLE songs ADD COLUMN IF NOT EXISTS premium_only BOOLEAN NOT NULL DEFAULT false;
+
+-- Each song can be stored at several qualities; playback picks the best one
+-- the listener is entitled to.
+CREATE TABLE IF NOT EXISTS song_renditions (
+    song_id      UUID        NOT NULL REFERENCES songs(id) ON DELETE CASCADE,
+    quality      TEXT        NOT NULL CHECK (quality IN ('standard', 'high')),
+    audio_key    TEXT        NOT NULL,
+    audio_format TEXT        NOT NULL,
+    bitrate_kbps INTEGER     NOT NULL DEFAULT 0,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (song_id, quality)
+);
+
+-- Earlier uploads only have their original file. Lossless originals count as
+-- high quality, everything else as standard so free users keep access.
+INSERT INTO song_renditions (song_id, quality, audio_key, audio_format)
+SELECT id, CASE WHEN audio_format = 'flac' THEN 'high' ELSE 'standard' END, audio_key, COALESCE(audio_format, '')
+FROM songs
+WHERE audio_key IS NOT NULL
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,16 @@
+-- HLS packaging of song renditions. Segments live in storage under
+-- key_prefix as <index>.mp3; a rendition is repackaged when its source file
+-- changes.
+CREATE TABLE IF NOT EXISTS hls_packages (
+    song_id           UUID               NOT NULL REFERENCES songs(id) ON DELETE CASCADE,
+    quality           TEXT               NOT NULL,
+    source_key        TEXT               NOT NULL,
+    key_prefix        TEXT               NOT NULL DEFAULT '',
+    bitrate_kbps      INTEGER            NOT NULL DEFAULT 0,
+    sample_rate       INTEGER            NOT NULL DEFAULT 0,
+    channels          INTEGER            NOT NULL DEFAULT 0,
+    segment_durations DOUBLE PRECISION[] NOT NULL DEFAULT '{}',
+    error             TEXT               NOT NULL DEFAULT '',
+    packaged_at       TIMESTAMPTZ        NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (song_id, quality)
+);
@@ -0,0 +1,14 @@
+-- One row per song downloaded to a device. Revoking a license deletes it;
+-- the app removes downloads whose license is missing or no longer active.
+CREATE TABLE IF NOT EXISTS offline_licenses (
+    id         UUID        PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id    UUID        NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    song_id    UUID        NOT NULL REFERENCES songs(id) ON DELETE CASCADE,
+    device_id  TEXT        NOT NULL,
+    issued_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    renewed_at TIMESTAMPTZ,
+    expires_at TIMESTAMPTZ NOT NULL,
+    UNIQUE (user_id, device_id, song_id)
+);
+
+CREATE INDEX IF NOT EXISTS offline_licenses_user_expires_idx ON offline_licenses (user_id, expires_at);
@@ -0,0 +1,8 @@
+-- Loudness analysis results. analysis_source_key is the rendition the values
+-- were measured on; a song is analysed again when it changes.
+ALTER TABLE songs ADD COLUMN IF NOT EXISTS loudness_lufs DOUBLE PRECISION;
+ALTER TABLE songs ADD COLUMN IF NOT EXISTS track_peak DOUBLE PRECISION;
+ALTER TABLE songs ADD COLUMN IF NOT EXISTS replay_gain_db DOUBLE PRECISION;
+ALTER TABLE songs ADD COLUMN IF NOT EXISTS analysis_source_key TEXT;
+ALTER TABLE songs ADD COLUMN IF NOT EXISTS analysis_error TEXT NOT NULL DEFAULT '';
+ALTER TABLE songs ADD COLUMN IF NOT EXISTS analyzed_at TIMESTAMPTZ;
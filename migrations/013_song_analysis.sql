@@ -0,0 +1,14 @@
+-- Audio features measured alongside loudness. Waveform holds peaks between 0
+-- and 1 at several resolutions.
+CREATE TABLE IF NOT EXISTS song_analysis (
+    song_id             UUID             PRIMARY KEY REFERENCES songs(id) ON DELETE CASCADE,
+    duration_ms         INTEGER          NOT NULL,
+    bpm                 DOUBLE PRECISION,
+    leading_silence_ms  INTEGER          NOT NULL DEFAULT 0,
+    trailing_silence_ms INTEGER          NOT NULL DEFAULT 0,
+    waveform            JSONB            NOT NULL DEFAULT '[]',
+    analyzed_at         TIMESTAMPTZ      NOT NULL DEFAULT NOW()
+);
+
+-- Analyse every song again so the new features are filled in.
+UPDATE songs SET analysis_source_key = NULL;
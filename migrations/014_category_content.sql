@@ -0,0 +1,27 @@
+-- Categories are browsable pages: an ordered list of songs and of curated
+-- playlists. Positions are contiguous from 0 within a category.
+ALTER TABLE song_categories ADD COLUMN IF NOT EXISTS position INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE song_categories ADD COLUMN IF NOT EXISTS added_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+
+UPDATE song_categories sc
+SET position = ranked.position
+FROM (
+    SELECT sc.song_id, sc.category_id,
+           ROW_NUMBER() OVER (PARTITION BY sc.category_id ORDER BY s.title, s.id) - 1 AS position
+    FROM song_categories sc
+    INNER JOIN songs s ON s.id = sc.song_id
+) ranked
+WHERE sc.song_id = ranked.song_id AND sc.category_id = ranked.category_id;
+
+CREATE INDEX IF NOT EXISTS idx_song_categories_position ON song_categories (category_id, position);
+
+CREATE TABLE IF NOT EXISTS category_playlists (
+    category_id UUID        NOT NULL REFERENCES categories(id) ON DELETE CASCADE,
+    playlist_id UUID        NOT NULL REFERENCES playlists(id) ON DELETE CASCADE,
+    position    INTEGER     NOT NULL,
+    added_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (category_id, playlist_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_category_playlists_position ON category_playlists (category_id, position);
+CREATE INDEX IF NOT EXISTS idx_category_playlists_playlist ON category_playlists (playlist_id);
@@ -0,0 +1,34 @@
+-- ISO 3166-1 alpha-2 code of where the listener is, used to target content.
+-- Empty when unknown.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS country TEXT NOT NULL DEFAULT '';
+
+-- Shelves of the home screen, configured by editors. item_ids lists the
+-- playlists of a playlists shelf or the categories of a categories shelf.
+-- An empty countries list targets every country.
+CREATE TABLE IF NOT EXISTS home_shelves (
+    id         UUID        PRIMARY KEY DEFAULT gen_random_uuid(),
+    position   INTEGER     NOT NULL,
+    kind       TEXT        NOT NULL CHECK (kind IN ('recently_played', 'made_for_you', 'new_releases', 'playlists', 'chart', 'categories')),
+    title      TEXT        NOT NULL,
+    countries  TEXT[]      NOT NULL DEFAULT '{}',
+    tier       TEXT        NOT NULL DEFAULT 'all' CHECK (tier IN ('all', 'free', 'premium')),
+    item_ids   TEXT[]      NOT NULL DEFAULT '{}',
+    item_limit INTEGER     NOT NULL DEFAULT 10 CHECK (item_limit > 0),
+    enabled    BOOLEAN     NOT NULL DEFAULT true,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_home_shelves_position ON home_shelves (position);
+
+-- Start with the shelves the home screen showed before it was configurable.
+INSERT INTO home_shelves (position, kind, title)
+SELECT v.position, v.kind, v.title
+FROM (VALUES
+    (0, 'recently_played', 'Recently played'),
+    (1, 'made_for_you', 'Made for you'),
+    (2, 'new_releases', 'New releases'),
+    (3, 'chart', 'Top songs this week'),
+    (4, 'categories', 'Browse all')
+) AS v(position, kind, title)
+WHERE NOT EXISTS (SELECT 1 FROM home_shelves);
@@ -0,0 +1,24 @@
+-- Charts are materialized by the chart job. chart_id is "<type>-<scope>",
+-- e.g. "daily-global", "weekly-id" or "trending-us", where scope is "global"
+-- or a lowercase country code.
+CREATE TABLE IF NOT EXISTS chart_snapshots (
+    id           UUID        PRIMARY KEY DEFAULT gen_random_uuid(),
+    chart_id     TEXT        NOT NULL,
+    chart_type   TEXT        NOT NULL CHECK (chart_type IN ('daily', 'weekly', 'trending')),
+    scope        TEXT        NOT NULL,
+    period_start TIMESTAMPTZ NOT NULL,
+    period_end   TIMESTAMPTZ NOT NULL,
+    generated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (chart_id, period_start)
+);
+
+CREATE INDEX IF NOT EXISTS idx_chart_snapshots_type ON chart_snapshots (chart_type, period_start);
+
+CREATE TABLE IF NOT EXISTS chart_entries (
+    snapshot_id       UUID    NOT NULL REFERENCES chart_snapshots(id) ON DELETE CASCADE,
+    position          INTEGER NOT NULL,
+    song_id           UUID    NOT NULL REFERENCES songs(id) ON DELETE CASCADE,
+    plays             BIGINT  NOT NULL,
+    previous_position INTEGER,
+    PRIMARY KEY (snapshot_id, position)
+);
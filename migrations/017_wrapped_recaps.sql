@@ -0,0 +1,11 @@
+-- Yearly listening recaps. data is written once by the recap job and never
+-- recomputed, so a published recap does not change when plays or the catalog
+-- do. share_token lets the owner share the recap without signing in.
+CREATE TABLE IF NOT EXISTS wrapped_recaps (
+    user_id      UUID        NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    year         INTEGER     NOT NULL,
+    data         JSONB       NOT NULL,
+    share_token  TEXT        NOT NULL UNIQUE,
+    published_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, year)
+);
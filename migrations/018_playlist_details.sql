@@ -0,0 +1,5 @@
+-- Playlists carry a description and a cover image set by their owner.
+-- updated_at moves whenever the details or the songs of a playlist change.
+ALTER TABLE playlists ADD COLUMN IF NOT EXISTS description TEXT NOT NULL DEFAULT '';
+ALTER TABLE playlists ADD COLUMN IF NOT EXISTS image_url TEXT NOT NULL DEFAULT '';
+ALTER TABLE playlists ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
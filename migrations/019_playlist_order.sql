@@ -0,0 +1,18 @@
+-- Playlist songs are ordered by position, contiguous from 0 within a
+-- playlist. version counts the changes to a playlist; clients send it back as
+-- the snapshot ID of the playlist they edited so concurrent edits from
+-- another device are rejected instead of interleaved.
+ALTER TABLE playlist_songs ADD COLUMN IF NOT EXISTS position INTEGER NOT NULL DEFAULT 0;
+
+UPDATE playlist_songs ps
+SET position = ranked.position
+FROM (
+    SELECT playlist_id, song_id,
+           ROW_NUMBER() OVER (PARTITION BY playlist_id ORDER BY added_at, song_id) - 1 AS position
+    FROM playlist_songs
+) ranked
+WHERE ps.playlist_id = ranked.playlist_id AND ps.song_id = ranked.song_id;
+
+CREATE INDEX IF NOT EXISTS idx_playlist_songs_position ON playlist_songs (playlist_id, position);
+
+ALTER TABLE playlists ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;
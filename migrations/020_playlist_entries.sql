@@ -0,0 +1,8 @@
+-- Each song in a playlist is an entry with its own ID, so the same song can
+-- appear more than once and be removed one entry at a time.
+ALTER TABLE playlist_songs ADD COLUMN IF NOT EXISTS id UUID NOT NULL DEFAULT gen_random_uuid();
+
+ALTER TABLE playlist_songs DROP CONSTRAINT IF EXISTS playlist_songs_pkey;
+ALTER TABLE playlist_songs ADD CONSTRAINT playlist_songs_pkey PRIMARY KEY (id);
+
+CREATE INDEX IF NOT EXISTS idx_playlist_songs_song ON playlist_songs (playlist_id, song_id);
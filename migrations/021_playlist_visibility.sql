@@ -0,0 +1,14 @@
+-- Playlists are private to their owner, unlisted (readable through a share
+-- link) or public (readable by everyone and found by search). share_token is
+-- the secret of the share link; replacing it revokes old links. Playlists
+-- curated into categories or onto the home screen were readable by everyone
+-- before, so they become public.
+ALTER TABLE playlists ADD COLUMN IF NOT EXISTS visibility TEXT NOT NULL DEFAULT 'private'
+    CHECK (visibility IN ('private', 'unlisted', 'public'));
+ALTER TABLE playlists ADD COLUMN IF NOT EXISTS share_token TEXT NOT NULL DEFAULT gen_random_uuid()::text;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_playlists_share_token ON playlists (share_token);
+
+UPDATE playlists SET visibility = 'public'
+WHERE id IN (SELECT playlist_id FROM category_playlists)
+    OR id::text IN (SELECT unnest(item_ids) FROM home_shelves WHERE kind = 'playlists');
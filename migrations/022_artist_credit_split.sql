@@ -0,0 +1,118 @@
+-- The artist backfill split credit lines on "&" as well as on commas, which
+-- turned acts such as "Simon & Garfunkel" into two made-up artists. Credit
+-- lines are now only split on commas, except inside the names listed in
+-- artist_name_exceptions, which the upload path reads too. Songs whose
+-- credits are still exactly what the backfill produced are credited again,
+-- and the made-up artists nobody else uses are removed.
+CREATE TABLE IF NOT EXISTS artist_name_exceptions (
+    name TEXT PRIMARY KEY
+);
+
+INSERT INTO artist_name_exceptions (name) VALUES
+    ('Earth, Wind & Fire'),
+    ('Crosby, Stills, Nash & Young'),
+    ('Crosby, Stills & Nash'),
+    ('Emerson, Lake & Palmer'),
+    ('Blood, Sweat & Tears'),
+    ('Peter, Paul and Mary'),
+    ('Tyler, the Creator')
+ON CONFLICT DO NOTHING;
+
+CREATE OR REPLACE FUNCTION pg_temp.split_artist_names(names TEXT)
+RETURNS TABLE (artist_name TEXT, ord BIGINT) LANGUAGE plpgsql AS $$
+DECLARE
+    known TEXT;
+    pos   INTEGER;
+BEGIN
+    FOR known IN SELECT e.name FROM artist_name_exceptions e ORDER BY length(e.name) DESC LOOP
+        pos := strpos(lower(names), lower(known));
+        WHILE pos > 0 LOOP
+            names := overlay(names PLACING replace(substr(names, pos, length(known)), ',', E'\x1f')
+                             FROM pos FOR length(known));
+            pos := strpos(lower(names), lower(known));
+        END LOOP;
+    END LOOP;
+    RETURN QUERY
+    SELECT btrim(replace(t.part, E'\x1f', ',')), t.n
+    FROM regexp_split_to_table(names, '\s*,\s*') WITH ORDINALITY AS t(part, n);
+END;
+$$;
+
+CREATE TEMPORARY TABLE artist_credit_resplit AS
+WITH parts AS (
+    SELECT id AS song_id,
+           split_part(regexp_replace(artist, '\s+(feat\.?|ft\.?|featuring)\s+', '|', 'i'), '|', 1) AS main_part,
+           split_part(regexp_replace(artist, '\s+(feat\.?|ft\.?|featuring)\s+', '|', 'i'), '|', 2) AS featured_part
+    FROM songs
+    WHERE artist LIKE '%&%'
+),
+old_split AS (
+    SELECT song_id, btrim(t.name) AS name, 'primary' AS role
+    FROM parts, regexp_split_to_table(main_part, '\s*(,|&)\s*') AS t(name)
+    UNION
+    SELECT song_id, btrim(t.name), 'featured'
+    FROM parts, regexp_split_to_table(featured_part, '\s*(,|&)\s*') AS t(name)
+    WHERE featured_part <> ''
+),
+new_split AS (
+    SELECT song_id, t.artist_name AS name, 'primary' AS role, t.ord - 1 AS position
+    FROM parts, pg_temp.split_artist_names(main_part) AS t
+    UNION ALL
+    SELECT song_id, t.artist_name, 'featured', t.ord - 1
+    FROM parts, pg_temp.split_artist_names(featured_part) AS t
+    WHERE featured_part <> ''
+),
+affected AS (
+    SELECT p.song_id
+    FROM parts p
+    WHERE (
+        SELECT array_agg(DISTINCT lower(a.name) || '/' || sa.role ORDER BY lower(a.name) || '/' || sa.role)
+        FROM song_artists sa INNER JOIN artists a ON a.id = sa.artist_id
+        WHERE sa.song_id = p.song_id
+    ) = (
+        SELECT array_agg(DISTINCT lower(o.name) || '/' || o.role ORDER BY lower(o.name) || '/' || o.role)
+        FROM old_split o WHERE o.song_id = p.song_id AND o.name <> ''
+    ) AND (
+        SELECT array_agg(DISTINCT lower(o.name) || '/' || o.role ORDER BY lower(o.name) || '/' || o.role)
+        FROM old_split o WHERE o.song_id = p.song_id AND o.name <> ''
+    ) IS DISTINCT FROM (
+        SELECT array_agg(DISTINCT lower(n.name) || '/' || n.role ORDER BY lower(n.name) || '/' || n.role)
+        FROM new_split n WHERE n.song_id = p.song_id AND n.name <> ''
+    )
+)
+SELECT n.song_id, n.name, n.role, n.position
+FROM new_split n
+INNER JOIN affected USING (song_id)
+WHERE n.name <> '';
+
+CREATE TEMPORARY TABLE artist_credit_dropped AS
+SELECT DISTINCT sa.artist_id
+FROM song_artists sa
+WHERE sa.song_id IN (SELECT song_id FROM artist_credit_resplit);
+
+DELETE FROM song_artists
+WHERE song_id IN (SELECT song_id FROM artist_credit_resplit);
+
+INSERT INTO artists (name)
+SELECT DISTINCT ON (lower(r.name)) r.name
+FROM artist_credit_resplit r
+WHERE NOT EXISTS (SELECT 1 FROM artists a WHERE lower(a.name) = lower(r.name))
+ORDER BY lower(r.name), r.name;
+
+INSERT INTO song_artists (song_id, artist_id, role, position)
+SELECT DISTINCT ON (r.song_id, a.id, r.role) r.song_id, a.id, r.role, r.position
+FROM artist_credit_resplit r
+INNER JOIN LATERAL (
+    SELECT id FROM artists WHERE lower(name) = lower(r.name) ORDER BY created_at, id LIMIT 1
+) a ON true
+ORDER BY r.song_id, a.id, r.role, r.position
+ON CONFLICT DO NOTHING;
+
+DELETE FROM artists a
+WHERE a.id IN (SELECT artist_id FROM artist_credit_dropped)
+    AND a.bio = '' AND a.image_url = ''
+    AND NOT EXISTS (SELECT 1 FROM song_artists sa WHERE sa.artist_id = a.id)
+    AND NOT EXISTS (SELECT 1 FROM albums al WHERE al.artist_id = a.id);
+
+DROP TABLE artist_credit_dropped;
+DROP TABLE artist_credit_resplit;
@@ -0,0 +1,24 @@
+-- songs.play_count is rolled up from play_events once a day, so the song page
+-- reads one column instead of counting plays, and the count only changes
+-- once a day. play_count_rollup holds how far plays have been counted; plays
+-- of the last full day are left to the next rollup in case they arrive late.
+ALTER TABLE songs ADD COLUMN IF NOT EXISTS play_count BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS play_count_rollup (
+    id           BOOLEAN     PRIMARY KEY DEFAULT true CHECK (id),
+    rolled_up_to TIMESTAMPTZ NOT NULL
+);
+
+INSERT INTO play_count_rollup (rolled_up_to)
+VALUES (date_trunc('day', NOW() AT TIME ZONE 'UTC') AT TIME ZONE 'UTC' - INTERVAL '1 day')
+ON CONFLICT DO NOTHING;
+
+UPDATE songs s
+SET play_count = c.plays
+FROM (
+    SELECT song_id, COUNT(*) AS plays
+    FROM play_events
+    WHERE started_at < (SELECT rolled_up_to FROM play_count_rollup)
+    GROUP BY song_id
+) c
+WHERE s.id = c.song_id;
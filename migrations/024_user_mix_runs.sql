@@ -0,0 +1,10 @@
+-- user_mix_runs records when the mixes of a user were last computed, so a
+-- user whose computation found nothing is not recomputed on every request.
+CREATE TABLE IF NOT EXISTS user_mix_runs (
+    user_id     UUID        PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    computed_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO user_mix_runs (user_id, computed_at)
+SELECT user_id, MAX(generated_at) FROM user_mixes GROUP BY user_id
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,5 @@
+-- Renditions whose file could not be read from storage are recorded with a
+-- retry time, backing off with every failed attempt, so they do not hold up
+-- the packaging queue.
+ALTER TABLE hls_packages ADD COLUMN IF NOT EXISTS attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE hls_packages ADD COLUMN IF NOT EXISTS retry_at TIMESTAMPTZ;
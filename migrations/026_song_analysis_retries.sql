@@ -0,0 +1,5 @@
+-- Songs whose audio could not be read from storage are analysed again at
+-- analysis_retry_at, backing off with every failed attempt, so they do not
+-- hold up the analysis queue.
+ALTER TABLE songs ADD COLUMN IF NOT EXISTS analysis_attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE songs ADD COLUMN IF NOT EXISTS analysis_retry_at TIMESTAMPTZ;
@@ -0,0 +1,4 @@
+-- Radio stations fill up with the most played songs, read from the rolled-up
+-- songs.play_count.
+CREATE INDEX IF NOT EXISTS idx_songs_play_count ON songs (play_count DESC)
+    WHERE deleted_at IS NULL AND available;
@@ -0,0 +1,6 @@
+-- wrapped_runs marks a recap year as done once every user with plays in it
+-- has a recap, so the recap job stops looking for users due for that year.
+CREATE TABLE IF NOT EXISTS wrapped_runs (
+    year         INTEGER     PRIMARY KEY,
+    completed_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);